@@ -35,6 +35,7 @@ func TestAPINotification(t *testing.T) {
 
 	assert.Len(t, apiNL, 1)
 	assert.EqualValues(t, 5, apiNL[0].ID)
+	assert.Equal(t, "1", resp.Header().Get("X-Total-Count"))
 
 	// test filter
 	before := "2000-01-01T01%3A06%3A59%2B00%3A00" //946688819
@@ -63,9 +64,18 @@ func TestAPINotification(t *testing.T) {
 	assert.EqualValues(t, 4, apiNL[0].ID)
 
 	// -- GET /notifications/threads/{id} --
-	// get forbidden
+	// notifications of other users are hidden
 	req = NewRequest(t, "GET", fmt.Sprintf("/api/v1/notifications/threads/%d?token=%s", 1, token))
-	resp = session.MakeRequest(t, req, http.StatusForbidden)
+	resp = session.MakeRequest(t, req, http.StatusNotFound)
+
+	// but not from administrators
+	adminSession := loginUser(t, "user1")
+	adminToken := getTokenForLoggedInUser(t, adminSession)
+	req = NewRequest(t, "GET", fmt.Sprintf("/api/v1/notifications/threads/%d?token=%s", thread5.ID, adminToken))
+	resp = adminSession.MakeRequest(t, req, http.StatusOK)
+	var apiAdminN api.NotificationThread
+	DecodeJSON(t, resp, &apiAdminN)
+	assert.EqualValues(t, 5, apiAdminN.ID)
 
 	// get own
 	req = NewRequest(t, "GET", fmt.Sprintf("/api/v1/notifications/threads/%d?token=%s", thread5.ID, token))
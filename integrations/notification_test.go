@@ -0,0 +1,72 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package integrations
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+	"code.gitea.io/gitea/modules/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationOpen(t *testing.T) {
+	defer prepareTestEnv(t)()
+
+	session := loginUser(t, "user2")
+
+	// the notifications link to their threads
+	req := NewRequest(t, "GET", "/notifications")
+	resp := session.MakeRequest(t, req, http.StatusOK)
+	htmlDoc := NewHTMLParser(t, resp.Body)
+	assert.EqualValues(t, 1, htmlDoc.doc.Find(`a[href="/notifications/threads/4"]`).Length())
+
+	req = NewRequest(t, "GET", "/notifications/threads/4")
+	resp = session.MakeRequest(t, req, http.StatusFound)
+	assert.EqualValues(t, setting.AppURL+"user2/repo1/issues/4", test.RedirectURL(resp))
+
+	notification := models.AssertExistsAndLoadBean(t, &models.Notification{ID: 4}).(*models.Notification)
+	assert.Equal(t, models.NotificationStatusRead, notification.Status)
+	assert.NotZero(t, notification.OpenedUnix)
+
+	// the notifications of other users can not be opened
+	req = NewRequest(t, "GET", "/notifications/threads/1")
+	session.MakeRequest(t, req, http.StatusNotFound)
+	notification = models.AssertExistsAndLoadBean(t, &models.Notification{ID: 1}).(*models.Notification)
+	assert.Zero(t, notification.OpenedUnix)
+}
+
+func TestNotificationReviewRequest(t *testing.T) {
+	defer prepareTestEnv(t)()
+
+	repo := models.AssertExistsAndLoadBean(t, &models.Repository{ID: 1}).(*models.Repository)
+	reviewer := models.AssertExistsAndLoadBean(t, &models.User{ID: 4}).(*models.User)
+	assert.NoError(t, repo.AddCollaborator(reviewer))
+
+	// assigning a pull request requests the review of the assignee
+	session := loginUser(t, "user2")
+	req := NewRequestWithValues(t, "POST", "/user2/repo1/issues/assignee", map[string]string{
+		"_csrf":     GetCSRF(t, session, "/user2/repo1/issues/1"),
+		"issue_ids": "2",
+		"id":        fmt.Sprint(reviewer.ID),
+	})
+	session.MakeRequest(t, req, http.StatusOK)
+
+	// the notification is created asynchronously
+	notification := &models.Notification{UserID: reviewer.ID, IssueID: 2}
+	for i := 0; i < 50 && !models.BeanExists(t, notification); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	notification = models.AssertExistsAndLoadBean(t, notification).(*models.Notification)
+	assert.Equal(t, models.NotificationStatusUnread, notification.Status)
+	assert.Equal(t, models.NotificationReasonReviewRequested, notification.Reason)
+	assert.Equal(t, models.NotificationActionReviewRequested, notification.Action)
+	assert.EqualValues(t, 2, notification.UpdatedBy)
+}
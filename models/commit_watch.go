@@ -0,0 +1,52 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+)
+
+// CommitWatch is a subscription of a user to the discussion of a single commit,
+// independent of whether the user watches the repository.
+type CommitWatch struct {
+	ID          int64              `xorm:"pk autoincr"`
+	UserID      int64              `xorm:"UNIQUE(watch) NOT NULL"`
+	RepoID      int64              `xorm:"UNIQUE(watch) NOT NULL"`
+	CommitID    string             `xorm:"VARCHAR(40) UNIQUE(watch) NOT NULL"`
+	CreatedUnix timeutil.TimeStamp `xorm:"created NOT NULL"`
+}
+
+func isCommitWatching(e Engine, userID, repoID int64, commitID string) (bool, error) {
+	return e.Get(&CommitWatch{UserID: userID, RepoID: repoID, CommitID: commitID})
+}
+
+// IsCommitWatching checks if the user watches the commit
+func IsCommitWatching(userID, repoID int64, commitID string) (bool, error) {
+	return isCommitWatching(x, userID, repoID, commitID)
+}
+
+// WatchCommit subscribes the user to the notifications of the commit
+func WatchCommit(userID, repoID int64, commitID string) error {
+	watching, err := isCommitWatching(x, userID, repoID, commitID)
+	if err != nil || watching {
+		return err
+	}
+	_, err = x.Insert(&CommitWatch{UserID: userID, RepoID: repoID, CommitID: commitID})
+	return err
+}
+
+// UnwatchCommit unsubscribes the user from the notifications of the commit
+func UnwatchCommit(userID, repoID int64, commitID string) error {
+	_, err := x.Delete(&CommitWatch{UserID: userID, RepoID: repoID, CommitID: commitID})
+	return err
+}
+
+func getCommitWatchers(e Engine, repoID int64, commitID string) ([]*CommitWatch, error) {
+	watches := make([]*CommitWatch, 0, 10)
+	return watches, e.
+		Where("repo_id = ?", repoID).
+		And("commit_id = ?", commitID).
+		Find(&watches)
+}
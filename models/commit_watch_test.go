@@ -0,0 +1,33 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchCommit(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	const commitID = "65f1bf27bc3bf70f64657658635e66094edbcb4d"
+
+	assert.NoError(t, WatchCommit(2, 1, commitID))
+	// watching twice is a no-op
+	assert.NoError(t, WatchCommit(2, 1, commitID))
+	AssertCount(t, &CommitWatch{}, 1)
+
+	watching, err := IsCommitWatching(2, 1, commitID)
+	assert.NoError(t, err)
+	assert.True(t, watching)
+
+	assert.NoError(t, UnwatchCommit(2, 1, commitID))
+	AssertNotExistsBean(t, &CommitWatch{UserID: 2, RepoID: 1, CommitID: commitID})
+
+	watching, err = IsCommitWatching(2, 1, commitID)
+	assert.NoError(t, err)
+	assert.False(t, watching)
+}
@@ -604,7 +604,7 @@ func (issue *Issue) ReadBy(userID int64) error {
 		return err
 	}
 
-	return setNotificationStatusReadIfUnread(x, userID, issue.ID)
+	return setNotificationStatusReadIfUnread(x, userID, issue)
 }
 
 func updateIssueCols(e Engine, issue *Issue, cols ...string) error {
@@ -657,6 +657,16 @@ func (issue *Issue) changeStatus(e *xorm.Session, doer *User, isClosed bool) (*C
 		return nil, err
 	}
 
+	// Reminders about closed issues are cancelled and the closer has seen the issue
+	if isClosed {
+		if err = deleteIssueNotificationReminders(e, issue.ID); err != nil {
+			return nil, err
+		}
+		if err = setNotificationStatusReadIfUnread(e, doer.ID, issue); err != nil {
+			return nil, err
+		}
+	}
+
 	// Update issue count of labels
 	if err = issue.getLabels(e); err != nil {
 		return nil, err
@@ -55,6 +55,31 @@ func UpdateIssueUserByRead(uid, issueID int64) error {
 	return err
 }
 
+// markIssueUserRead sets the issue as read by the user, so the issue lists do not show it as new anymore.
+// Unlike UpdateIssueUserByRead it creates the issue-user relation if the user has none yet, e.g. a watcher
+// reading the notification of the issue, see setNotificationStatus.
+func markIssueUserRead(e Engine, uid, issueID int64) error {
+	iu := &IssueUser{
+		UID:     uid,
+		IssueID: issueID,
+	}
+	has, err := e.Get(iu)
+	if err != nil {
+		return err
+	}
+	if !has {
+		iu.IsRead = true
+		_, err = e.Insert(iu)
+		return err
+	}
+	if iu.IsRead {
+		return nil
+	}
+	iu.IsRead = true
+	_, err = e.ID(iu.ID).Cols("is_read").Update(iu)
+	return err
+}
+
 // UpdateIssueUsersByMentions updates issue-user pairs by mentioning.
 func UpdateIssueUsersByMentions(ctx DBContext, issueID int64, uids []int64) error {
 	for _, uid := range uids {
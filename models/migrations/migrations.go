@@ -292,6 +292,46 @@ var migrations = []Migration{
 	NewMigration("Add block on rejected reviews branch protection", addBlockOnRejectedReviews),
 	// v118 -> v119
 	NewMigration("Add commit id and stale to reviews", addReviewCommitAndStale),
+	// v119 -> v120
+	NewMigration("Add first_read_unix on table notification", addFirstReadUnixOnNotification),
+	// v120 -> v121
+	NewMigration("Add subject_title and subject_url on table notification", addSubjectOnNotification),
+	// v121 -> v122
+	NewMigration("Add snoozed_until_unix on table notification", addSnoozedUntilUnixOnNotification),
+	// v122 -> v123
+	NewMigration("Add reason on table notification", addReasonOnNotification),
+	// v123 -> v124
+	NewMigration("Add notification_reminder table", addNotificationReminderTable),
+	// v124 -> v125
+	NewMigration("Add action on table notification", addActionOnNotification),
+	// v125 -> v126
+	NewMigration("Add team_notification table", addTeamNotificationTable),
+	// v126 -> v127
+	NewMigration("Add commit_watch table", addCommitWatchTable),
+	// v127 -> v128
+	NewMigration("Add notification_tag table", addNotificationTagTable),
+	// v128 -> v129
+	NewMigration("Add read_unix on table notification", addReadUnixOnNotification),
+	// v129 -> v130
+	NewMigration("Add mail_sent_unix on table notification", addMailSentUnixOnNotification),
+	// v130 -> v131
+	NewMigration("Add delivery status on table notification", addDeliveryStatusOnNotification),
+	// v131 -> v132
+	NewMigration("Add opened_unix on table notification", addOpenedUnixOnNotification),
+	// v132 -> v133
+	NewMigration("Add inbox index on table notification", addInboxIndexOnNotification),
+	// v133 -> v134
+	NewMigration("Add pin_note on table notification", addPinNoteOnNotification),
+	// v134 -> v135
+	NewMigration("Add snooze_condition on table notification", addSnoozeConditionOnNotification),
+	// v135 -> v136
+	NewMigration("Add read_subject_state on table notification", addReadSubjectStateOnNotification),
+	// v136 -> v137
+	NewMigration("Add email_frequency and last_emailed_unix on table user", addEmailFrequencyOnUser),
+	// v137 -> v138
+	NewMigration("Add bot_notifications_opt_in on table user", addBotNotificationsOptInOnUser),
+	// v138 -> v139
+	NewMigration("Add deleted_unix on table notification", addDeletedUnixOnNotification),
 }
 
 // Migrate database to current version
@@ -0,0 +1,26 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/xorm"
+)
+
+func addFirstReadUnixOnNotification(x *xorm.Engine) error {
+	type Notification struct {
+		ID            int64              `xorm:"pk autoincr"`
+		FirstReadUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	}
+
+	if err := x.Sync2(new(Notification)); err != nil {
+		return err
+	}
+
+	// Read (2) and pinned (3) notifications have been read at least once, the last update is the best guess we have
+	_, err := x.Exec("UPDATE `notification` SET `first_read_unix` = `updated_unix` WHERE `status` IN (?, ?) AND `first_read_unix` = 0", 2, 3)
+	return err
+}
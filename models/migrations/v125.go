@@ -0,0 +1,24 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/xorm"
+)
+
+func addTeamNotificationTable(x *xorm.Engine) error {
+	type TeamNotification struct {
+		ID             int64              `xorm:"pk autoincr"`
+		TeamID         int64              `xorm:"UNIQUE(s) NOT NULL"`
+		NotificationID int64              `xorm:"UNIQUE(s) NOT NULL"`
+		ClaimedBy      int64              `xorm:"INDEX NOT NULL DEFAULT 0"`
+		ClaimedUnix    timeutil.TimeStamp `xorm:"NOT NULL DEFAULT 0"`
+		CreatedUnix    timeutil.TimeStamp `xorm:"created NOT NULL"`
+	}
+
+	return x.Sync2(new(TeamNotification))
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/xorm"
+)
+
+func addCommitWatchTable(x *xorm.Engine) error {
+	type CommitWatch struct {
+		ID          int64              `xorm:"pk autoincr"`
+		UserID      int64              `xorm:"UNIQUE(watch) NOT NULL"`
+		RepoID      int64              `xorm:"UNIQUE(watch) NOT NULL"`
+		CommitID    string             `xorm:"VARCHAR(40) UNIQUE(watch) NOT NULL"`
+		CreatedUnix timeutil.TimeStamp `xorm:"created NOT NULL"`
+	}
+
+	return x.Sync2(new(CommitWatch))
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/xorm"
+)
+
+func addNotificationTagTable(x *xorm.Engine) error {
+	type NotificationTag struct {
+		ID             int64              `xorm:"pk autoincr"`
+		UserID         int64              `xorm:"INDEX NOT NULL"`
+		NotificationID int64              `xorm:"UNIQUE(s) NOT NULL"`
+		Name           string             `xorm:"VARCHAR(50) UNIQUE(s) NOT NULL"`
+		Color          string             `xorm:"VARCHAR(7) NOT NULL"`
+		CreatedUnix    timeutil.TimeStamp `xorm:"created NOT NULL"`
+	}
+
+	return x.Sync2(new(NotificationTag))
+}
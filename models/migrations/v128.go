@@ -0,0 +1,26 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/xorm"
+)
+
+func addReadUnixOnNotification(x *xorm.Engine) error {
+	type Notification struct {
+		ID       int64              `xorm:"pk autoincr"`
+		ReadUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	}
+
+	if err := x.Sync2(new(Notification)); err != nil {
+		return err
+	}
+
+	// Without history the first read is the best guess for the last read of notifications which are not unread (1)
+	_, err := x.Exec("UPDATE `notification` SET `read_unix` = `first_read_unix` WHERE `status` <> ?", 1)
+	return err
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"xorm.io/xorm"
+)
+
+func addDeliveryStatusOnNotification(x *xorm.Engine) error {
+	type Notification struct {
+		ID               int64 `xorm:"pk autoincr"`
+		DeliveryStatus   uint8 `xorm:"SMALLINT INDEX NOT NULL DEFAULT 0"`
+		DeliveryAttempts int   `xorm:"NOT NULL DEFAULT 0"`
+	}
+
+	if err := x.Sync2(new(Notification)); err != nil {
+		return err
+	}
+
+	// Existing notifications must not be delivered again, mark them as delivered (1)
+	_, err := x.Exec("UPDATE `notification` SET `delivery_status` = ?", 1)
+	return err
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/xorm"
+)
+
+func addInboxIndexOnNotification(x *xorm.Engine) error {
+	type Notification struct {
+		ID          int64              `xorm:"pk autoincr"`
+		UserID      int64              `xorm:"INDEX INDEX(inbox) NOT NULL"`
+		Status      uint8              `xorm:"SMALLINT INDEX INDEX(inbox) NOT NULL"`
+		Source      uint8              `xorm:"SMALLINT INDEX INDEX(inbox) NOT NULL"`
+		UpdatedUnix timeutil.TimeStamp `xorm:"updated INDEX INDEX(inbox) NOT NULL"`
+	}
+
+	return x.Sync2(new(Notification))
+}
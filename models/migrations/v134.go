@@ -0,0 +1,18 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"xorm.io/xorm"
+)
+
+func addSnoozeConditionOnNotification(x *xorm.Engine) error {
+	type Notification struct {
+		ID              int64  `xorm:"pk autoincr"`
+		SnoozeCondition string `xorm:"VARCHAR(32) INDEX NOT NULL DEFAULT ''"`
+	}
+
+	return x.Sync2(new(Notification))
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"xorm.io/xorm"
+)
+
+func addBotNotificationsOptInOnUser(x *xorm.Engine) error {
+	type User struct {
+		ID                    int64 `xorm:"pk autoincr"`
+		BotNotificationsOptIn bool  `xorm:"NOT NULL DEFAULT false"`
+	}
+
+	return x.Sync2(new(User))
+}
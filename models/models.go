@@ -87,6 +87,10 @@ func init() {
 		new(Notice),
 		new(EmailAddress),
 		new(Notification),
+		new(NotificationReminder),
+		new(TeamNotification),
+		new(CommitWatch),
+		new(NotificationTag),
 		new(IssueUser),
 		new(LFSMetaObject),
 		new(TwoFactor),
@@ -5,13 +5,27 @@
 package models
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 
+	"code.gitea.io/gitea/modules/generate"
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/markup"
 	"code.gitea.io/gitea/modules/setting"
 	api "code.gitea.io/gitea/modules/structs"
 	"code.gitea.io/gitea/modules/timeutil"
 
+	"github.com/unknwon/com"
 	"xorm.io/builder"
 	"xorm.io/xorm"
 )
@@ -30,6 +44,8 @@ const (
 	NotificationStatusRead
 	// NotificationStatusPinned represents a pinned notification
 	NotificationStatusPinned
+	// NotificationStatusDone represents a notification the user is done with, it is archived until new activity happens
+	NotificationStatusDone
 )
 
 const (
@@ -39,32 +55,330 @@ const (
 	NotificationSourcePullRequest
 	// NotificationSourceCommit is a notification of a commit
 	NotificationSourceCommit
+	// NotificationSourceSystem is a notification broadcasted by an administrator
+	NotificationSourceSystem
+	// NotificationSourceRepository is a notification about the repository itself, e.g. a failed mirror sync
+	NotificationSourceRepository
 )
 
-// Notification represents a notification
+// notificationSourceDefaultStatus contains the status new notifications of a source are created with.
+// Low priority sources may start read so they appear in the history without raising the unread count.
+// Sources which are not listed start unread, callers which want a notification to start read set its status.
+var notificationSourceDefaultStatus = map[NotificationSource]NotificationStatus{}
+
+// NotificationEvent is the kind of event which creates or updates issue notifications
+type NotificationEvent uint8
+
+const (
+	// NotificationEventComment is a comment, or any other activity which only notifies watchers
+	NotificationEventComment NotificationEvent = iota
+	// NotificationEventClose is an issue or pull request being closed
+	NotificationEventClose
+	// NotificationEventReopen is an issue or pull request being reopened
+	NotificationEventReopen
+	// NotificationEventMerge is a pull request being merged
+	NotificationEventMerge
+)
+
+// isStateChange returns true if the event changes the state of the issue,
+// which also notifies the poster of the issue if somebody else changed the state
+func (event NotificationEvent) isStateChange() bool {
+	return event == NotificationEventClose || event == NotificationEventReopen || event == NotificationEventMerge
+}
+
+// Action returns the notification action of the event
+func (event NotificationEvent) Action() string {
+	switch event {
+	case NotificationEventClose:
+		return NotificationActionClosed
+	case NotificationEventReopen:
+		return NotificationActionReopened
+	case NotificationEventMerge:
+		return NotificationActionMerged
+	default:
+		return NotificationActionCommented
+	}
+}
+
+// Actions describing the event which created or updated a notification the last time
+const (
+	NotificationActionCommented  = "commented"
+	NotificationActionClosed     = "closed"
+	NotificationActionReopened   = "reopened"
+	NotificationActionMerged     = "merged"
+	NotificationActionPushed     = "pushed"
+	NotificationActionReacted    = "reacted"
+	NotificationActionSubscribed = "subscribed"
+)
+
+// NotificationActionMirrorFailed is the action of the notifications of repository admins about failed mirror syncs
+const NotificationActionMirrorFailed = "mirror_failed"
+
+// NotificationActionCoalesced is the action of the notifications collecting the issue notifications of a repository
+// which exceeded setting.Service.NotificationRepoCap, followed by the number of collected notifications
+const NotificationActionCoalesced = "coalesced"
+
+// Review verdicts stored as action of the notifications of pull request authors about reviews
+const (
+	NotificationActionReviewApprove = "approve"
+	NotificationActionReviewReject  = "reject"
+	NotificationActionReviewComment = "comment"
+)
+
+// Actions of the notifications of reviewers about review requests
+const (
+	NotificationActionReviewRequested   = "review_requested"
+	NotificationActionReReviewRequested = "re_review_requested"
+)
+
+// Reasons why a user received a notification
+const (
+	// NotificationReasonSubscribed is used when the user watches the issue or the repository
+	NotificationReasonSubscribed = "subscribed"
+	// NotificationReasonPush is used when new commits have been pushed to a pull request the user reviews
+	NotificationReasonPush = "push"
+	// NotificationReasonReaction is used when somebody reacted to a comment of the user
+	NotificationReasonReaction = "reaction"
+	// NotificationReasonReview is used when somebody reviewed a pull request of the user
+	NotificationReasonReview = "review"
+	// NotificationReasonReviewRequested is used when somebody requested a review of the user
+	NotificationReasonReviewRequested = "review_requested"
+	// NotificationReasonMention is used when somebody mentioned the user in an issue or comment
+	NotificationReasonMention = "mention"
+)
+
+func defaultNotificationStatus(source NotificationSource) NotificationStatus {
+	if status, ok := notificationSourceDefaultStatus[source]; ok {
+		return status
+	}
+	return NotificationStatusUnread
+}
+
+// String returns the lower case name of the status, e.g. "unread"
+func (status NotificationStatus) String() string {
+	switch status {
+	case NotificationStatusUnread:
+		return "unread"
+	case NotificationStatusRead:
+		return "read"
+	case NotificationStatusPinned:
+		return "pinned"
+	case NotificationStatusDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// String returns the lower case name of the source, e.g. "pull" for pull requests
+func (source NotificationSource) String() string {
+	switch source {
+	case NotificationSourceIssue:
+		return "issue"
+	case NotificationSourcePullRequest:
+		return "pull"
+	case NotificationSourceCommit:
+		return "commit"
+	case NotificationSourceSystem:
+		return "system"
+	case NotificationSourceRepository:
+		return "repository"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNotificationNotExist represents an error that a notification does not exist
+type ErrNotificationNotExist struct {
+	ID int64
+}
+
+// IsErrNotificationNotExist checks if an error is an ErrNotificationNotExist.
+func IsErrNotificationNotExist(err error) bool {
+	_, ok := err.(ErrNotificationNotExist)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrNotificationNotExist) Error() string {
+	return fmt.Sprintf("notification does not exist [id: %d]", err.ID)
+}
+
+// ErrNotificationForbidden represents an error that a notification belongs to another user.
+// Handlers should treat it like ErrNotificationNotExist to not reveal the notifications of other users.
+type ErrNotificationForbidden struct {
+	ID     int64
+	UserID int64
+}
+
+// IsErrNotificationForbidden checks if an error is an ErrNotificationForbidden.
+func IsErrNotificationForbidden(err error) bool {
+	_, ok := err.(ErrNotificationForbidden)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrNotificationForbidden) Error() string {
+	return fmt.Sprintf("notification belongs to another user [id: %d, user_id: %d]", err.ID, err.UserID)
+}
+
+// ErrNotificationUndoTokenNotExist represents an error that an undo token is unknown or expired
+type ErrNotificationUndoTokenNotExist struct {
+	Token string
+}
+
+// IsErrNotificationUndoTokenNotExist checks if an error is an ErrNotificationUndoTokenNotExist.
+func IsErrNotificationUndoTokenNotExist(err error) bool {
+	_, ok := err.(ErrNotificationUndoTokenNotExist)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrNotificationUndoTokenNotExist) Error() string {
+	return fmt.Sprintf("notification undo token does not exist or has expired [token: %s]", err.Token)
+}
+
+// ErrNotificationRestoreExpired represents an error that a deleted notification can not be restored anymore
+type ErrNotificationRestoreExpired struct {
+	ID int64
+}
+
+// IsErrNotificationRestoreExpired checks if an error is an ErrNotificationRestoreExpired.
+func IsErrNotificationRestoreExpired(err error) bool {
+	_, ok := err.(ErrNotificationRestoreExpired)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrNotificationRestoreExpired) Error() string {
+	return fmt.Sprintf("notification has been deleted too long ago to be restored [id: %d]", err.ID)
+}
+
+// ErrNotificationRestoreConflict represents an error that a deleted notification can not be restored
+// because the user has received a new notification of the same thread in the meantime
+type ErrNotificationRestoreConflict struct {
+	ID         int64
+	ExistingID int64
+}
+
+// IsErrNotificationRestoreConflict checks if an error is an ErrNotificationRestoreConflict.
+func IsErrNotificationRestoreConflict(err error) bool {
+	_, ok := err.(ErrNotificationRestoreConflict)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrNotificationRestoreConflict) Error() string {
+	return fmt.Sprintf("notification thread has a newer notification [id: %d, existing_id: %d]", err.ID, err.ExistingID)
+}
+
+// Notification represents a notification.
+// UserID, Status, Source and UpdatedUnix form the inbox index, which matches the filtered and sorted listings of the inbox.
 type Notification struct {
 	ID     int64 `xorm:"pk autoincr"`
-	UserID int64 `xorm:"INDEX NOT NULL"`
+	UserID int64 `xorm:"INDEX INDEX(inbox) NOT NULL"`
 	RepoID int64 `xorm:"INDEX NOT NULL"`
 
-	Status NotificationStatus `xorm:"SMALLINT INDEX NOT NULL"`
-	Source NotificationSource `xorm:"SMALLINT INDEX NOT NULL"`
+	Status NotificationStatus `xorm:"SMALLINT INDEX INDEX(inbox) NOT NULL"`
+	Source NotificationSource `xorm:"SMALLINT INDEX INDEX(inbox) NOT NULL"`
 
 	IssueID   int64  `xorm:"INDEX NOT NULL"`
 	CommitID  string `xorm:"INDEX"`
 	CommentID int64
 
 	UpdatedBy int64 `xorm:"INDEX NOT NULL"`
+	// Reason is why the user received the notification the last time it was created or updated
+	Reason string `xorm:"VARCHAR(32) NOT NULL DEFAULT 'subscribed'"`
+	// Action is the event which created or updated the notification the last time, e.g. "commented" or "closed"
+	Action string `xorm:"VARCHAR(32) NOT NULL DEFAULT 'commented'"`
+
+	// SubjectTitle and SubjectURL describe the subject of notifications which are not related to a repository object
+	SubjectTitle string `xorm:"VARCHAR(255)"`
+	SubjectURL   string `xorm:"TEXT"`
+	// PinNote is a short note of the user about why the notification is pinned, it is cleared on unpinning
+	PinNote string `xorm:"VARCHAR(255)"`
+
+	// FirstReadUnix is the first time the notification has been read, it is kept when the notification becomes unread again
+	FirstReadUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	// ReadUnix is the last time the notification has been read
+	ReadUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	// ReadSubjectState is the state of the issue or pull request when the notification has been read the last time,
+	// see ActionSinceRead
+	ReadSubjectState string `xorm:"VARCHAR(16) NOT NULL DEFAULT ''"`
+	// OpenedUnix is the first time the user opened the subject through the notification,
+	// as opposed to ReadUnix the notification can be read without opening it
+	OpenedUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	// SnoozedUntilUnix hides an unread notification from the unread count until the given time
+	SnoozedUntilUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	// SnoozeCondition hides an unread notification until its subject reaches a state, see SnoozeNotificationUntilCondition
+	SnoozeCondition string `xorm:"VARCHAR(32) INDEX NOT NULL DEFAULT ''"`
+	// MailSentUnix is the time the notification has been emailed to the user, so it is not mailed twice
+	MailSentUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
+	// DeliveryStatus and DeliveryAttempts track the asynchronous delivery of the notification, e.g. by email or webhook
+	DeliveryStatus   NotificationDeliveryStatus `xorm:"SMALLINT INDEX NOT NULL DEFAULT 0"`
+	DeliveryAttempts int                        `xorm:"NOT NULL DEFAULT 0"`
+	// DeletedUnix is the time the notification has been soft deleted, it can be restored until it is purged,
+	// see RestoreNotification and PurgeDeletedNotifications
+	DeletedUnix timeutil.TimeStamp `xorm:"INDEX NOT NULL DEFAULT 0"`
 
-	Issue      *Issue      `xorm:"-"`
-	Repository *Repository `xorm:"-"`
-	Comment    *Comment    `xorm:"-"`
-	User       *User       `xorm:"-"`
+	Issue      *Issue             `xorm:"-"`
+	Repository *Repository        `xorm:"-"`
+	Comment    *Comment           `xorm:"-"`
+	Tags       []*NotificationTag `xorm:"-"`
+	User       *User              `xorm:"-"`
+	// Participants are the first distinct commenters of the issue, see NotificationList.LoadParticipants
+	Participants []*User `xorm:"-"`
 
 	CreatedUnix timeutil.TimeStamp `xorm:"created INDEX NOT NULL"`
-	UpdatedUnix timeutil.TimeStamp `xorm:"updated INDEX NOT NULL"`
+	UpdatedUnix timeutil.TimeStamp `xorm:"updated INDEX INDEX(inbox) NOT NULL"`
+}
+
+// notificationJSON is the JSON representation of a Notification. Related objects are
+// only referenced by ID and URL so loaded attributes are never marshalled recursively.
+type notificationJSON struct {
+	ID          int64              `json:"id"`
+	UserID      int64              `json:"user_id"`
+	Status      string             `json:"status"`
+	Source      string             `json:"source"`
+	RepoID      int64              `json:"repo_id"`
+	RepoURL     string             `json:"repo_url,omitempty"`
+	IssueID     int64              `json:"issue_id"`
+	IssueURL    string             `json:"issue_url,omitempty"`
+	CommitID    string             `json:"commit_id,omitempty"`
+	CommentID   int64              `json:"comment_id,omitempty"`
+	UpdatedBy   int64              `json:"updated_by"`
+	CreatedUnix timeutil.TimeStamp `json:"created_unix"`
+	UpdatedUnix timeutil.TimeStamp `json:"updated_unix"`
+}
+
+// MarshalJSON implements json.Marshaler. It hides the loaded Issue, Repository,
+// Comment and User so that embedding a notification in a payload stays compact.
+func (n *Notification) MarshalJSON() ([]byte, error) {
+	result := notificationJSON{
+		ID:          n.ID,
+		UserID:      n.UserID,
+		Status:      n.Status.String(),
+		Source:      n.Source.String(),
+		RepoID:      n.RepoID,
+		IssueID:     n.IssueID,
+		CommitID:    n.CommitID,
+		CommentID:   n.CommentID,
+		UpdatedBy:   n.UpdatedBy,
+		CreatedUnix: n.CreatedUnix,
+		UpdatedUnix: n.UpdatedUnix,
+	}
+	if n.Repository != nil {
+		result.RepoURL = n.Repository.HTMLURL()
+	}
+	if n.Issue != nil && n.Issue.Repo != nil {
+		result.IssueURL = n.Issue.HTMLURL()
+	}
+	return json.Marshal(result)
 }
 
+// likePatternEscaper escapes the wildcards of LIKE patterns using ! as escape character
+var likePatternEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![")
+
 // FindNotificationOptions represent the filters for notifications. If an ID is 0 it will be ignored.
 type FindNotificationOptions struct {
 	UserID            int64
@@ -73,11 +387,48 @@ type FindNotificationOptions struct {
 	Status            NotificationStatus
 	UpdatedAfterUnix  int64
 	UpdatedBeforeUnix int64
+	CreatedAfterUnix  int64
+	CreatedBeforeUnix int64
+	// NeverRead only matches unread notifications which have not been read before
+	NeverRead bool
+	// OnlyAssigned only matches issue and pull request notifications on which the user is assigned
+	OnlyAssigned bool
+	// ClosedByUser only matches issue and pull request notifications of closed issues which have been closed by the user
+	ClosedByUser bool
+	// OnlyAwaitingMyReview only matches notifications of open pull requests the user is assigned to and has not
+	// published a review of yet
+	OnlyAwaitingMyReview bool
+	// MailNotSent only matches notifications which have not been emailed yet
+	MailNotSent bool
+	// ExcludeDraftPRs drops the notifications of pull requests which are a work in progress
+	ExcludeDraftPRs bool
+	// Statuses matches any of the given statuses, in addition to Status
+	Statuses []NotificationStatus
+	// Source only matches notifications of the given source
+	Source NotificationSource
+	// PosterID only matches issue and pull request notifications of issues opened by the given user
+	PosterID int64
+	// OnlyActionable only keeps the notifications the user can still act on with the current permissions,
+	// see filterActionableNotifications. It requires UserID.
+	OnlyActionable bool
+	// AccessibleBy only matches the notifications the given user can still access, see accessibleNotificationCond
+	AccessibleBy *User
+	// HasAttachment only matches notifications of comments which have attachments, e.g. screenshots
+	HasAttachment bool
+	// Dedup collapses duplicated notifications of a user for the same issue and source, see NotificationList.Dedup
+	Dedup bool
+	// SortType is the order of the notifications, the most recently updated come first by default.
+	// With "mostcommented" the notifications of the issues with the most comments come first.
+	// With "repo_recency" the notifications are grouped by repository ordered by name, each group sorted by recency.
+	SortType string
+
+	// TODO: add a ProjectID filter matching the issue notifications of a project board once issues can be
+	// added to project boards, there is no project-issue relation to join yet.
 }
 
 // ToCond will convert each condition into a xorm-Cond
 func (opts *FindNotificationOptions) ToCond() builder.Cond {
-	cond := builder.NewCond()
+	cond := builder.NewCond().And(builder.Eq{"notification.deleted_unix": 0})
 	if opts.UserID != 0 {
 		cond = cond.And(builder.Eq{"notification.user_id": opts.UserID})
 	}
@@ -90,23 +441,177 @@ func (opts *FindNotificationOptions) ToCond() builder.Cond {
 	if opts.Status != 0 {
 		cond = cond.And(builder.Eq{"notification.status": opts.Status})
 	}
+	if len(opts.Statuses) > 0 {
+		cond = cond.And(builder.In("notification.status", opts.Statuses))
+	}
+	if opts.Source != 0 {
+		cond = cond.And(builder.Eq{"notification.source": opts.Source})
+	}
 	if opts.UpdatedAfterUnix != 0 {
 		cond = cond.And(builder.Gte{"notification.updated_unix": opts.UpdatedAfterUnix})
 	}
 	if opts.UpdatedBeforeUnix != 0 {
 		cond = cond.And(builder.Lte{"notification.updated_unix": opts.UpdatedBeforeUnix})
 	}
+	if opts.CreatedAfterUnix != 0 {
+		cond = cond.And(builder.Gte{"notification.created_unix": opts.CreatedAfterUnix})
+	}
+	if opts.CreatedBeforeUnix != 0 {
+		cond = cond.And(builder.Lte{"notification.created_unix": opts.CreatedBeforeUnix})
+	}
+	if opts.NeverRead {
+		cond = cond.And(builder.Eq{
+			"notification.status":          NotificationStatusUnread,
+			"notification.first_read_unix": 0,
+		})
+	}
+	if opts.OnlyAssigned {
+		cond = cond.And(builder.In("notification.source", NotificationSourceIssue, NotificationSourcePullRequest))
+	}
+	if opts.ClosedByUser {
+		cond = cond.And(
+			builder.In("notification.source", NotificationSourceIssue, NotificationSourcePullRequest),
+			builder.Eq{"issue.is_closed": true},
+			builder.In("notification.issue_id", builder.Select("comment.issue_id").From("comment").
+				Where(builder.Eq{"comment.type": CommentTypeClose}.
+					And(builder.Expr("comment.poster_id = notification.user_id")))),
+		)
+	}
+	if opts.PosterID != 0 {
+		cond = cond.And(
+			builder.In("notification.source", NotificationSourceIssue, NotificationSourcePullRequest),
+			builder.Eq{"issue.poster_id": opts.PosterID},
+		)
+	}
+	if opts.HasAttachment {
+		// notifications without a comment never match
+		cond = cond.And(
+			builder.Neq{"notification.comment_id": 0},
+			builder.In("notification.comment_id", builder.Select("attachment.comment_id").From("attachment").
+				Where(builder.Gt{"attachment.comment_id": 0})),
+		)
+	}
+	if opts.MailNotSent {
+		cond = cond.And(builder.Eq{"notification.mail_sent_unix": 0})
+	}
+	if opts.AccessibleBy != nil {
+		cond = cond.And(accessibleNotificationCond(opts.AccessibleBy))
+	}
+	if opts.ExcludeDraftPRs && len(setting.Repository.PullRequest.WorkInProgressPrefixes) > 0 {
+		// like PullRequest.IsWorkInProgress a pull request is a draft if its title starts with a work in progress prefix,
+		// the prefix is escaped to be matched literally, e.g. the brackets of [WIP] are a character set on MSSQL
+		isDraft := builder.NewCond()
+		for _, prefix := range setting.Repository.PullRequest.WorkInProgressPrefixes {
+			isDraft = isDraft.Or(builder.Expr("UPPER(issue.name) LIKE ? ESCAPE '!'", likePatternEscaper.Replace(prefix)+"%"))
+		}
+		cond = cond.And(builder.Not{builder.Eq{"notification.source": NotificationSourcePullRequest}.And(isDraft)})
+	}
+	if opts.OnlyAwaitingMyReview {
+		// assigning a pull request is how a review is requested, the request is answered by publishing a review
+		cond = cond.And(
+			builder.Eq{"notification.source": NotificationSourcePullRequest},
+			builder.Eq{"issue.is_closed": false},
+			builder.In("notification.issue_id", builder.Select("issue_assignees.issue_id").From("issue_assignees").
+				Where(builder.Expr("issue_assignees.assignee_id = notification.user_id"))),
+			builder.NotIn("notification.issue_id", builder.Select("review.issue_id").From("review").
+				Where(builder.Expr("review.reviewer_id = notification.user_id").
+					And(builder.Neq{"review.type": ReviewTypePending}))),
+		)
+	}
 	return cond
 }
 
 // ToSession will convert the given options to a xorm Session by using the conditions from ToCond and joining with issue table if required
 func (opts *FindNotificationOptions) ToSession(e Engine) *xorm.Session {
-	return e.Where(opts.ToCond())
+	sess := e.Where(opts.ToCond())
+	if opts.OnlyAssigned {
+		sess.Join("INNER", "issue_assignees", "issue_assignees.issue_id = notification.issue_id AND issue_assignees.assignee_id = notification.user_id")
+	}
+	if opts.ClosedByUser || opts.OnlyAwaitingMyReview || opts.PosterID != 0 {
+		sess.Join("INNER", "issue", "issue.id = notification.issue_id")
+	} else if opts.ExcludeDraftPRs || opts.SortType == "mostcommented" {
+		// notifications without an issue are kept
+		sess.Join("LEFT", "issue", "issue.id = notification.issue_id")
+	}
+	if opts.SortType == "repo_recency" {
+		sess.Join("LEFT", "repository", "repository.id = notification.repo_id")
+	}
+	return sess
 }
 
 func getNotifications(e Engine, options FindNotificationOptions) (nl NotificationList, err error) {
-	err = options.ToSession(e).OrderBy("notification.updated_unix DESC").Find(&nl)
-	return
+	sess := options.ToSession(e)
+	switch options.SortType {
+	case "mostcommented":
+		// notifications without an issue come last
+		sess.OrderBy("CASE WHEN issue.id IS NULL THEN 1 ELSE 0 END, COALESCE(issue.num_comments, 0) DESC, notification.updated_unix DESC")
+	case "repo_recency":
+		// notifications without a repository come last, repositories with the same name are kept apart by their id
+		sess.OrderBy("CASE WHEN repository.id IS NULL THEN 1 ELSE 0 END, repository.lower_name, notification.repo_id, notification.updated_unix DESC")
+	default:
+		sess.OrderBy("notification.updated_unix DESC")
+	}
+	if err = sess.Find(&nl); err != nil {
+		return nil, err
+	}
+	if options.Dedup {
+		nl = nl.Dedup()
+	}
+	if options.OnlyActionable {
+		user, err := getUserByID(e, options.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return filterActionableNotifications(e, user, nl)
+	}
+	return nl, nil
+}
+
+// filterActionableNotifications returns the notifications of the list the user can still act on, e.g. after
+// losing write access to a repository the review requests and assignments of the user are moot.
+// Issue and pull request notifications require write access to the issues or pull requests of the repository,
+// commit notifications to its code. Notifications which are not related to a repository are always kept.
+// The permissions are checked once per repository.
+func filterActionableNotifications(e Engine, user *User, nl NotificationList) (NotificationList, error) {
+	if _, err := nl.LoadRepos(); err != nil {
+		return nil, err
+	}
+
+	perms := make(map[int64]Permission)
+	result := make(NotificationList, 0, len(nl))
+	for _, notification := range nl {
+		if notification.RepoID == 0 {
+			result = append(result, notification)
+			continue
+		}
+		if notification.Repository == nil {
+			continue
+		}
+
+		perm, ok := perms[notification.RepoID]
+		if !ok {
+			var err error
+			perm, err = getUserRepoPermission(e, notification.Repository, user)
+			if err != nil {
+				return nil, err
+			}
+			perms[notification.RepoID] = perm
+		}
+
+		var actionable bool
+		switch notification.Source {
+		case NotificationSourceIssue, NotificationSourcePullRequest:
+			actionable = perm.CanWriteIssuesOrPulls(notification.Source == NotificationSourcePullRequest)
+		case NotificationSourceCommit:
+			actionable = perm.CanWrite(UnitTypeCode)
+		default:
+			actionable = perm.HasAccess()
+		}
+		if actionable {
+			result = append(result, notification)
+		}
+	}
+	return result, nil
 }
 
 // GetNotifications returns all notifications that fit to the given options.
@@ -114,23 +619,138 @@ func GetNotifications(opts FindNotificationOptions) (NotificationList, error) {
 	return getNotifications(x, opts)
 }
 
+// CountNotifications returns the number of notifications matching the conditions of the options.
+// Like the SQL pagination it ignores Dedup and OnlyActionable, which are applied to the found notifications.
+func CountNotifications(opts FindNotificationOptions) (int64, error) {
+	return opts.ToSession(x).Count(&Notification{})
+}
+
+// MarkNotificationMailed records that the notifications have been emailed, so a mailer selecting
+// notifications with MailNotSent does not send them again when it re-runs.
+// It also records the time as the last email of their users, see GetNotificationsDueForEmail.
+func MarkNotificationMailed(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	now := timeutil.TimeStampNow()
+	if _, err := sess.
+		In("id", ids).
+		Cols("mail_sent_unix").
+		NoAutoTime().
+		Update(&Notification{MailSentUnix: now}); err != nil {
+		return err
+	}
+	if _, err := sess.
+		In("id", builder.Select("user_id").From("notification").Where(builder.In("id", ids))).
+		Cols("last_emailed_unix").
+		NoAutoTime().
+		Update(&User{LastEmailedUnix: now}); err != nil {
+		return err
+	}
+	return sess.Commit()
+}
+
+// GetNotificationsDueForEmail returns the unread notifications of the user which have not been emailed yet,
+// unless the user has been emailed less than their EmailFrequency before now, then none are due.
+// The mailer is expected to record the sent notifications with MarkNotificationMailed.
+func GetNotificationsDueForEmail(user *User, now timeutil.TimeStamp) (NotificationList, error) {
+	u := new(User)
+	if has, err := x.ID(user.ID).Cols("email_frequency", "last_emailed_unix").Get(u); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrUserNotExist{UID: user.ID}
+	}
+
+	if u.EmailFrequency > 0 && u.LastEmailedUnix > 0 && now < u.LastEmailedUnix.Add(u.EmailFrequency) {
+		return NotificationList{}, nil
+	}
+
+	return getNotifications(x, FindNotificationOptions{
+		UserID:      user.ID,
+		Status:      NotificationStatusUnread,
+		MailNotSent: true,
+	})
+}
+
+// GetRelevantNotifications returns the union of the notifications of the user and the notifications of all users
+// in the repositories the user administers, i.e. owns or has admin access to through a collaboration or team,
+// which lets repository admins oversee the activity. Each notification is returned once, even if it belongs
+// to the user and to an administered repository. The UserID of the options is ignored.
+func GetRelevantNotifications(user *User, opts FindNotificationOptions) (NotificationList, error) {
+	opts.UserID = 0
+
+	administeredRepos := builder.Or(
+		builder.In("notification.repo_id", builder.Select("id").From("repository").
+			Where(builder.Eq{"owner_id": user.ID})),
+		builder.In("notification.repo_id", builder.Select("repo_id").From("access").
+			Where(builder.Eq{"user_id": user.ID}.And(builder.Gte{"mode": AccessModeAdmin}))),
+	)
+
+	nl := make(NotificationList, 0, 10)
+	return nl, opts.ToSession(x).
+		And(builder.Eq{"notification.user_id": user.ID}.Or(administeredRepos)).
+		OrderBy("notification.updated_unix DESC, notification.id DESC").
+		Find(&nl)
+}
+
+// ApplyNotificationFilter returns the notifications of the user matching a saved filter. Whatever the filter
+// specifies, the notifications of repositories the user can not see anymore are dropped, e.g. after a repository
+// of the filter has been made private. Notifications which are not related to a repository are kept.
+// The UserID of the filter is ignored.
+func ApplyNotificationFilter(user *User, filter FindNotificationOptions) (NotificationList, error) {
+	filter.UserID = user.ID
+
+	sess := filter.ToSession(x)
+	if !user.IsAdmin {
+		sess.And(builder.Eq{"notification.repo_id": 0}.Or(
+			builder.In("notification.repo_id", builder.Select("`repository`.id").From("`repository`").
+				Where(accessibleRepositoryCondition(user.ID)))))
+	}
+
+	nl := make(NotificationList, 0, 10)
+	return nl, sess.OrderBy("notification.updated_unix DESC, notification.id DESC").Find(&nl)
+}
+
 // CreateOrUpdateIssueNotifications creates an issue notification
 // for each watcher, or updates it if already exists
 func CreateOrUpdateIssueNotifications(issueID, commentID int64, notificationAuthorID int64) error {
+	return CreateOrUpdateIssueNotificationsForEvent(issueID, commentID, notificationAuthorID, NotificationEventComment)
+}
+
+// CreateOrUpdateIssueNotificationsForEvent creates or updates the issue notifications of the watchers,
+// the poster of the issue is notified as well depending on the event
+func CreateOrUpdateIssueNotificationsForEvent(issueID, commentID, notificationAuthorID int64, event NotificationEvent) error {
+	if setting.Service.NotificationFanOutWorkers > 1 {
+		return createOrUpdateIssueNotificationsConcurrent(issueID, commentID, notificationAuthorID, event, setting.Service.NotificationFanOutWorkers)
+	}
+
 	sess := x.NewSession()
 	defer sess.Close()
 	if err := sess.Begin(); err != nil {
 		return err
 	}
 
-	if err := createOrUpdateIssueNotifications(sess, issueID, commentID, notificationAuthorID); err != nil {
+	if err := createOrUpdateIssueNotifications(sess, issueID, commentID, notificationAuthorID, event); err != nil {
 		return err
 	}
 
 	return sess.Commit()
 }
 
-func createOrUpdateIssueNotifications(e Engine, issueID, commentID int64, notificationAuthorID int64) error {
+// CreateReopenNotifications notifies the watchers of an issue that it has been reopened by the actor.
+// As a reopen is significant, read and done threads become unread again.
+func CreateReopenNotifications(issueID, actorID int64) error {
+	return CreateOrUpdateIssueNotificationsForEvent(issueID, 0, actorID, NotificationEventReopen)
+}
+
+func createOrUpdateIssueNotifications(e Engine, issueID, commentID int64, notificationAuthorID int64, event NotificationEvent) error {
 	issueWatches, err := getIssueWatchers(e, issueID)
 	if err != nil {
 		return err
@@ -152,6 +772,15 @@ func createOrUpdateIssueNotifications(e Engine, issueID, commentID int64, notifi
 	}
 
 	alreadyNotified := make(map[int64]struct{}, len(issueWatches)+len(watches))
+	capped := notificationRepoVolume.exceeded(issue.RepoID, time.Now())
+
+	skippedBotIDs, err := getNotificationSkippedBotIDs(e, issueWatches, watches, issue.PosterID)
+	if err != nil {
+		return err
+	}
+	for _, botID := range skippedBotIDs {
+		alreadyNotified[botID] = struct{}{}
+	}
 
 	notifyUser := func(userID int64) error {
 		// do not send notification for the own issuer/commenter
@@ -164,10 +793,13 @@ func createOrUpdateIssueNotifications(e Engine, issueID, commentID int64, notifi
 		}
 		alreadyNotified[userID] = struct{}{}
 
-		if notificationExists(notifications, issue.ID, userID) {
-			return updateIssueNotification(e, userID, issue.ID, commentID, notificationAuthorID)
+		if notificationExists(notifications, issue.ID, userID, issueNotificationSource(issue)) {
+			return updateIssueNotification(e, userID, issue, commentID, notificationAuthorID, NotificationReasonSubscribed, event.Action())
+		}
+		if capped {
+			return coalesceIssueNotification(e, userID, issue, notificationAuthorID)
 		}
-		return createIssueNotification(e, userID, issue, commentID, notificationAuthorID)
+		return createIssueNotification(e, userID, issue, commentID, notificationAuthorID, 0, NotificationReasonSubscribed, event.Action())
 	}
 
 	for _, issueWatch := range issueWatches {
@@ -187,12 +819,16 @@ func createOrUpdateIssueNotifications(e Engine, issueID, commentID int64, notifi
 		return err
 	}
 
-	for _, watch := range watches {
+	canRead := func(userID int64) bool {
 		issue.Repo.Units = nil
-		if issue.IsPull && !issue.Repo.checkUnitUser(e, watch.UserID, false, UnitTypePullRequests) {
-			continue
+		if issue.IsPull {
+			return issue.Repo.checkUnitUser(e, userID, false, UnitTypePullRequests)
 		}
-		if !issue.IsPull && !issue.Repo.checkUnitUser(e, watch.UserID, false, UnitTypeIssues) {
+		return issue.Repo.checkUnitUser(e, userID, false, UnitTypeIssues)
+	}
+
+	for _, watch := range watches {
+		if !canRead(watch.UserID) {
 			continue
 		}
 
@@ -200,518 +836,4348 @@ func createOrUpdateIssueNotifications(e Engine, issueID, commentID int64, notifi
 			return err
 		}
 	}
+
+	// the poster wants to know when somebody else closes or reopens the issue even without watching it
+	if event.isStateChange() && canRead(issue.PosterID) {
+		if err := notifyUser(issue.PosterID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func getNotificationsByIssueID(e Engine, issueID int64) (notifications []*Notification, err error) {
-	err = e.
-		Where("issue_id = ?", issueID).
-		Find(&notifications)
-	return
+// repoNotificationVolume counts the issue notification fan-outs per repository within a fixed window,
+// to protect the watchers against a misbehaving integration flooding a repository with issues
+type repoNotificationVolume struct {
+	lock    sync.Mutex
+	windows map[int64]*repoNotificationWindow
 }
 
-func notificationExists(notifications []*Notification, issueID, userID int64) bool {
-	for _, notification := range notifications {
-		if notification.IssueID == issueID && notification.UserID == userID {
-			return true
-		}
-	}
-
-	return false
+type repoNotificationWindow struct {
+	start time.Time
+	count int
 }
 
-func createIssueNotification(e Engine, userID int64, issue *Issue, commentID, updatedByID int64) error {
-	notification := &Notification{
-		UserID:    userID,
-		RepoID:    issue.RepoID,
-		Status:    NotificationStatusUnread,
-		IssueID:   issue.ID,
-		CommentID: commentID,
-		UpdatedBy: updatedByID,
+var notificationRepoVolume = &repoNotificationVolume{windows: make(map[int64]*repoNotificationWindow)}
+
+// exceeded records a fan-out for the repository and returns true if the repository exceeded
+// setting.Service.NotificationRepoCap fan-outs in the current window. Fan-outs above the cap are
+// coalesced: they bump the existing notifications of the watchers, the others are collected by
+// coalesceIssueNotification instead of creating a notification per issue.
+func (v *repoNotificationVolume) exceeded(repoID int64, now time.Time) bool {
+	if setting.Service.NotificationRepoCap <= 0 {
+		return false
 	}
 
-	if issue.IsPull {
-		notification.Source = NotificationSourcePullRequest
-	} else {
-		notification.Source = NotificationSourceIssue
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	window, ok := v.windows[repoID]
+	if !ok || now.Sub(window.start) >= setting.Service.NotificationRepoCapWindow {
+		// drop the expired windows of the other repositories once in a while
+		if len(v.windows) >= 1000 {
+			for id, w := range v.windows {
+				if now.Sub(w.start) >= setting.Service.NotificationRepoCapWindow {
+					delete(v.windows, id)
+				}
+			}
+		}
+		window = &repoNotificationWindow{start: now}
+		v.windows[repoID] = window
 	}
+	window.count++
+	return window.count > setting.Service.NotificationRepoCap
+}
 
-	_, err := e.Insert(notification)
-	return err
+// reset forgets all windows
+func (v *repoNotificationVolume) reset() {
+	v.lock.Lock()
+	v.windows = make(map[int64]*repoNotificationWindow)
+	v.lock.Unlock()
 }
 
-func updateIssueNotification(e Engine, userID, issueID, commentID, updatedByID int64) error {
-	notification, err := getIssueNotification(e, userID, issueID)
+// coalesceIssueNotification collects an issue notification of a repository which exceeded its notification cap
+// into a single notification of the user for the repository. It is bumped for each collected notification and
+// counts them until the user reads it.
+func coalesceIssueNotification(e Engine, userID int64, issue *Issue, notificationAuthorID int64) error {
+	notification := new(Notification)
+	has, err := e.
+		Where("user_id = ?", userID).
+		And("repo_id = ?", issue.RepoID).
+		And("source = ?", NotificationSourceRepository).
+		And("action LIKE ?", NotificationActionCoalesced+":%").
+		And("deleted_unix = 0").
+		Get(notification)
 	if err != nil {
 		return err
 	}
 
-	// NOTICE: Only update comment id when the before notification on this issue is read, otherwise you may miss some old comments.
-	// But we need update update_by so that the notification will be reorder
-	var cols []string
-	if notification.Status == NotificationStatusRead {
-		notification.Status = NotificationStatusUnread
-		notification.CommentID = commentID
-		cols = []string{"status", "update_by", "comment_id"}
-	} else {
-		notification.UpdatedBy = updatedByID
-		cols = []string{"update_by"}
+	if !has {
+		return createNotification(e, &Notification{
+			UserID:       userID,
+			RepoID:       issue.RepoID,
+			Status:       NotificationStatusUnread,
+			Source:       NotificationSourceRepository,
+			UpdatedBy:    notificationAuthorID,
+			Reason:       NotificationReasonSubscribed,
+			Action:       coalescedNotificationAction(1),
+			SubjectTitle: coalescedNotificationTitle(1),
+		})
 	}
 
-	_, err = e.ID(notification.ID).Cols(cols...).Update(notification)
+	count := notification.CoalescedNotifications() + 1
+	if notification.Status == NotificationStatusRead || notification.Status == NotificationStatusDone {
+		notification.Status = NotificationStatusUnread
+		count = 1
+	}
+	notification.UpdatedBy = notificationAuthorID
+	notification.Action = coalescedNotificationAction(count)
+	notification.SubjectTitle = coalescedNotificationTitle(count)
+	_, err = e.ID(notification.ID).Cols("status", "updated_by", "action", "subject_title").Update(notification)
 	return err
 }
 
-func getIssueNotification(e Engine, userID, issueID int64) (*Notification, error) {
-	notification := new(Notification)
-	_, err := e.
-		Where("user_id = ?", userID).
-		And("issue_id = ?", issueID).
-		Get(notification)
-	return notification, err
+func coalescedNotificationAction(count int) string {
+	return NotificationActionCoalesced + ":" + strconv.Itoa(count)
 }
 
-// NotificationsForUser returns notifications for a given user and status
-func NotificationsForUser(user *User, statuses []NotificationStatus, page, perPage int) (NotificationList, error) {
-	return notificationsForUser(x, user, statuses, page, perPage)
+func coalescedNotificationTitle(count int) string {
+	if count == 1 {
+		return "1 notification was collected as the repository is very busy"
+	}
+	return strconv.Itoa(count) + " notifications were collected as the repository is very busy"
 }
 
-func notificationsForUser(e Engine, user *User, statuses []NotificationStatus, page, perPage int) (notifications []*Notification, err error) {
-	if len(statuses) == 0 {
-		return
+// CoalescedNotifications returns the number of issue notifications collected by the notification,
+// or 0 if it does not collect notifications, see coalesceIssueNotification
+func (n *Notification) CoalescedNotifications() int {
+	if n.Source != NotificationSourceRepository || !strings.HasPrefix(n.Action, NotificationActionCoalesced+":") {
+		return 0
+	}
+	count, err := strconv.Atoi(strings.TrimPrefix(n.Action, NotificationActionCoalesced+":"))
+	if err != nil {
+		return 0
 	}
+	return count
+}
 
-	sess := e.
-		Where("user_id = ?", user.ID).
-		In("status", statuses).
-		OrderBy("updated_unix DESC")
+// createOrUpdateIssueNotificationsConcurrent notifies the same users as createOrUpdateIssueNotifications,
+// but creates or updates the notifications with the given number of workers. The notifications are not
+// written in one transaction, so a failure does not roll back the notifications of the other users.
+func createOrUpdateIssueNotificationsConcurrent(issueID, commentID, notificationAuthorID int64, event NotificationEvent, workers int) error {
+	issueWatches, err := getIssueWatchers(x, issueID)
+	if err != nil {
+		return err
+	}
 
-	if page > 0 && perPage > 0 {
-		sess.Limit(perPage, (page-1)*perPage)
+	issue, err := getIssueByID(x, issueID)
+	if err != nil {
+		return err
 	}
 
-	err = sess.Find(&notifications)
-	return
-}
+	watches, err := getWatchers(x, issue.RepoID)
+	if err != nil {
+		return err
+	}
 
-// APIFormat converts a Notification to api.NotificationThread
-func (n *Notification) APIFormat() *api.NotificationThread {
-	result := &api.NotificationThread{
-		ID:        n.ID,
-		Unread:    !(n.Status == NotificationStatusRead || n.Status == NotificationStatusPinned),
-		Pinned:    n.Status == NotificationStatusPinned,
-		UpdatedAt: n.UpdatedUnix.AsTime(),
-		URL:       n.APIURL(),
+	if err = issue.loadRepo(x); err != nil {
+		return err
 	}
+	capped := notificationRepoVolume.exceeded(issue.RepoID, time.Now())
 
-	//since user only get notifications when he has access to use minimal access mode
-	if n.Repository != nil {
-		result.Repository = n.Repository.APIFormat(AccessModeRead)
+	var (
+		lock            sync.Mutex
+		alreadyNotified = make(map[int64]struct{}, len(issueWatches)+len(watches))
+		firstErr        error
+	)
+	markNotified := func(userID int64) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		if _, ok := alreadyNotified[userID]; ok {
+			return false
+		}
+		alreadyNotified[userID] = struct{}{}
+		return true
 	}
 
-	//handle Subject
-	switch n.Source {
-	case NotificationSourceIssue:
-		result.Subject = &api.NotificationSubject{Type: "Issue"}
-		if n.Issue != nil {
-			result.Subject.Title = n.Issue.Title
-			result.Subject.URL = n.Issue.APIURL()
-			comment, err := n.Issue.GetLastComment()
-			if err == nil && comment != nil {
-				result.Subject.LatestCommentURL = comment.APIURL()
-			}
+	// do not send notification for the own issuer/commenter
+	markNotified(notificationAuthorID)
+	skippedBotIDs, err := getNotificationSkippedBotIDs(x, issueWatches, watches, issue.PosterID)
+	if err != nil {
+		return err
+	}
+	for _, botID := range skippedBotIDs {
+		markNotified(botID)
+	}
+	// ignore users who unwatched the issue
+	for _, issueWatch := range issueWatches {
+		if !issueWatch.IsWatching {
+			markNotified(issueWatch.UserID)
 		}
-	case NotificationSourcePullRequest:
-		result.Subject = &api.NotificationSubject{Type: "Pull"}
-		if n.Issue != nil {
-			result.Subject.Title = n.Issue.Title
-			result.Subject.URL = n.Issue.APIURL()
-			comment, err := n.Issue.GetLastComment()
-			if err == nil && comment != nil {
-				result.Subject.LatestCommentURL = comment.APIURL()
+	}
+
+	userIDs := make(chan int64, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range userIDs {
+				if !markNotified(userID) {
+					continue
+				}
+				if err := createOrUpdateIssueNotification(x, issue, userID, commentID, notificationAuthorID, event, capped); err != nil {
+					lock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					lock.Unlock()
+				}
 			}
+		}()
+	}
+
+	// permissions are checked here, as checking them modifies the repository of the issue
+	canRead := func(userID int64) bool {
+		issue.Repo.Units = nil
+		if issue.IsPull {
+			return issue.Repo.checkUnitUser(x, userID, false, UnitTypePullRequests)
 		}
-	case NotificationSourceCommit:
-		result.Subject = &api.NotificationSubject{
-			Type:  "Commit",
-			Title: n.CommitID,
+		return issue.Repo.checkUnitUser(x, userID, false, UnitTypeIssues)
+	}
+
+	for _, issueWatch := range issueWatches {
+		if issueWatch.IsWatching {
+			userIDs <- issueWatch.UserID
 		}
-		//unused until now
 	}
+	for _, watch := range watches {
+		if canRead(watch.UserID) {
+			userIDs <- watch.UserID
+		}
+	}
+	if event.isStateChange() && canRead(issue.PosterID) {
+		userIDs <- issue.PosterID
+	}
+	close(userIDs)
+	wg.Wait()
 
-	return result
+	return firstErr
 }
 
-// LoadAttributes load Repo Issue User and Comment if not loaded
-func (n *Notification) LoadAttributes() (err error) {
-	return n.loadAttributes(x)
+// getNotificationSkippedBotIDs returns the bots among the watchers and the poster of an issue which do not receive
+// notifications, because setting.Service.NotificationSkipBots is set and they did not opt in
+func getNotificationSkippedBotIDs(e Engine, issueWatches IssueWatchList, watches []*Watch, posterID int64) ([]int64, error) {
+	if !setting.Service.NotificationSkipBots {
+		return nil, nil
+	}
+
+	userIDs := make([]int64, 0, len(issueWatches)+len(watches)+1)
+	for _, issueWatch := range issueWatches {
+		userIDs = append(userIDs, issueWatch.UserID)
+	}
+	for _, watch := range watches {
+		userIDs = append(userIDs, watch.UserID)
+	}
+	userIDs = append(userIDs, posterID)
+
+	botIDs := make([]int64, 0, 2)
+	for start := 0; start < len(userIDs); start += defaultMaxInSize {
+		end := start + defaultMaxInSize
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		ids := make([]int64, 0, 2)
+		if err := e.Table("user").
+			In("id", userIDs[start:end]).
+			And("`type` = ?", UserTypeBot).
+			And("bot_notifications_opt_in = ?", false).
+			Cols("id").
+			Find(&ids); err != nil {
+			return nil, err
+		}
+		botIDs = append(botIDs, ids...)
+	}
+	return botIDs, nil
 }
 
-func (n *Notification) loadAttributes(e Engine) (err error) {
-	if err = n.loadRepo(e); err != nil {
-		return
+// createOrUpdateIssueNotification creates or updates the notification of a single user,
+// if capped only an existing notification is updated
+func createOrUpdateIssueNotification(e Engine, issue *Issue, userID, commentID, notificationAuthorID int64, event NotificationEvent, capped bool) error {
+	notification, err := getIssueNotification(e, userID, issue.ID, issueNotificationSource(issue))
+	if err != nil {
+		return err
 	}
-	if err = n.loadIssue(e); err != nil {
-		return
+	if notification.ID != 0 {
+		return updateIssueNotification(e, userID, issue, commentID, notificationAuthorID, NotificationReasonSubscribed, event.Action())
 	}
-	if err = n.loadUser(e); err != nil {
-		return
+	if capped {
+		return coalesceIssueNotification(e, userID, issue, notificationAuthorID)
 	}
-	if err = n.loadComment(e); err != nil {
-		return
+	return createIssueNotification(e, userID, issue, commentID, notificationAuthorID, 0, NotificationReasonSubscribed, event.Action())
+}
+
+// SeedIssueNotificationOnSubscribe creates a read notification for a user subscribing to an issue,
+// so the issue is listed in the user's notifications and gets bumped by future activity.
+// It does nothing if the user already has a notification for the issue.
+func SeedIssueNotificationOnSubscribe(userID, issueID int64) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
 	}
-	return
+
+	issue, err := getIssueByID(sess, issueID)
+	if err != nil {
+		return err
+	}
+
+	notification, err := getIssueNotification(sess, userID, issue.ID, issueNotificationSource(issue))
+	if err != nil {
+		return err
+	}
+	if notification.ID != 0 {
+		return nil
+	}
+
+	if err := createIssueNotification(sess, userID, issue, 0, userID, NotificationStatusRead, NotificationReasonSubscribed, NotificationActionSubscribed); err != nil {
+		return err
+	}
+
+	return sess.Commit()
 }
 
-func (n *Notification) loadRepo(e Engine) (err error) {
-	if n.Repository == nil {
-		n.Repository, err = getRepositoryByID(e, n.RepoID)
-		if err != nil {
-			return fmt.Errorf("getRepositoryByID [%d]: %v", n.RepoID, err)
+// SeedNotificationsForPastParticipants creates read notifications for the commenters of an issue who have
+// none yet, e.g. after enabling watch-on-comment for existing issues, so future activity reaches them.
+// Commenters who explicitly unwatched the issue are skipped. It returns the number of created notifications.
+func SeedNotificationsForPastParticipants(issueID int64) (int64, error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	issue, err := getIssueByID(sess, issueID)
+	if err != nil {
+		return 0, err
+	}
+
+	commenterIDs := make([]int64, 0, 10)
+	if err = sess.Table("comment").
+		Where("issue_id = ? AND type = ? AND poster_id > 0", issueID, CommentTypeComment).
+		And(builder.NotIn("poster_id", builder.Select("user_id").From("issue_watch").
+			Where(builder.Eq{"issue_id": issueID, "is_watching": false}))).
+		Distinct("poster_id").
+		Find(&commenterIDs); err != nil {
+		return 0, err
+	}
+
+	notifications, err := getNotificationsByIssueID(sess, issueID)
+	if err != nil {
+		return 0, err
+	}
+
+	var seeded int64
+	for _, commenterID := range commenterIDs {
+		if notificationExists(notifications, issue.ID, commenterID, issueNotificationSource(issue)) {
+			continue
+		}
+		if err = createIssueNotification(sess, commenterID, issue, 0, commenterID, NotificationStatusRead, NotificationReasonSubscribed, NotificationActionCommented); err != nil {
+			return 0, err
 		}
+		seeded++
 	}
-	return nil
+
+	return seeded, sess.Commit()
 }
 
-func (n *Notification) loadIssue(e Engine) (err error) {
-	if n.Issue == nil {
-		n.Issue, err = getIssueByID(e, n.IssueID)
-		if err != nil {
-			return fmt.Errorf("getIssueByID [%d]: %v", n.IssueID, err)
-		}
-		return n.Issue.loadAttributes(e)
+func getNotificationsByIssueID(e Engine, issueID int64) (notifications []*Notification, err error) {
+	err = e.
+		Where("issue_id = ?", issueID).
+		And("deleted_unix = 0").
+		Find(&notifications)
+	return
+}
+
+// GetAllNotificationsForIssue returns every notification of the issue regardless of their user, source and
+// status, oldest first, with their users loaded. Deleted notifications are included too, they have a DeletedUnix.
+// As it is not scoped to a user it must only be used for audits by administrators.
+func GetAllNotificationsForIssue(issueID int64) (NotificationList, error) {
+	notifications := make(NotificationList, 0, 10)
+	if err := x.
+		Where("issue_id = ?", issueID).
+		OrderBy("created_unix ASC, id ASC").
+		Find(&notifications); err != nil {
+		return nil, err
 	}
-	return nil
+	return notifications, notifications.loadUsers(x)
 }
 
-func (n *Notification) loadComment(e Engine) (err error) {
-	if n.Comment == nil && n.CommentID > 0 {
-		n.Comment, err = GetCommentByID(n.CommentID)
-		if err != nil {
-			return fmt.Errorf("GetCommentByID [%d]: %v", n.CommentID, err)
+// GetActiveIssueNotificationRecipients returns the notifications of the issue which belong to users who still watch it,
+// either explicitly or through the repository without having unwatched the issue.
+func GetActiveIssueNotificationRecipients(issueID int64) (NotificationList, error) {
+	return getActiveIssueNotificationRecipients(x, issueID)
+}
+
+func getActiveIssueNotificationRecipients(e Engine, issueID int64) (NotificationList, error) {
+	issue, err := getIssueByID(e, issueID)
+	if err != nil {
+		return nil, err
+	}
+
+	issueWatchers := func(isWatching bool) *builder.Builder {
+		return builder.Select("user_id").From("issue_watch").
+			Where(builder.Eq{"issue_id": issueID, "is_watching": isWatching})
+	}
+	repoWatchers := builder.Select("user_id").From("watch").
+		Where(builder.Eq{"repo_id": issue.RepoID}.And(builder.Neq{"mode": RepoWatchModeDont}))
+
+	notifications := make(NotificationList, 0, 10)
+	return notifications, e.
+		Where("issue_id = ?", issueID).
+		And("deleted_unix = 0").
+		And(builder.In("user_id", issueWatchers(true)).
+			Or(builder.In("user_id", repoWatchers).And(builder.NotIn("user_id", issueWatchers(false))))).
+		Find(&notifications)
+}
+
+// GetIssueNotificationRecipientsByReason returns the users having a notification of the issue grouped by the reason
+// they received it the last time, e.g. to find out why a user has or has not been notified. Users are ordered by ID.
+// As it is not scoped to a user it must only be used by administrators of the repository.
+func GetIssueNotificationRecipientsByReason(issueID int64) (map[string][]*User, error) {
+	notifications := make(NotificationList, 0, 10)
+	if err := x.
+		Where("issue_id = ?", issueID).
+		And("deleted_unix = 0").
+		OrderBy("user_id ASC, id ASC").
+		Find(&notifications); err != nil {
+		return nil, err
+	}
+	if err := notifications.loadUsers(x); err != nil {
+		return nil, err
+	}
+
+	recipients := make(map[string][]*User, 2)
+	for _, notification := range notifications {
+		recipients[notification.Reason] = append(recipients[notification.Reason], notification.User)
+	}
+	return recipients, nil
+}
+
+// notificationExists checks whether the user has a notification of the given source for the issue.
+// Notifications of different sources, e.g. of a commit referencing the issue, are separate threads,
+// so a user has at most one notification per issue and source (user_id, issue_id, source).
+func notificationExists(notifications []*Notification, issueID, userID int64, source NotificationSource) bool {
+	for _, notification := range notifications {
+		if notification.IssueID == issueID && notification.UserID == userID && notification.Source == source {
+			return true
 		}
 	}
-	return nil
+
+	return false
 }
 
-func (n *Notification) loadUser(e Engine) (err error) {
-	if n.User == nil {
-		n.User, err = getUserByID(e, n.UserID)
-		if err != nil {
-			return fmt.Errorf("getUserByID [%d]: %v", n.UserID, err)
+// createIssueNotification creates a notification of the issue with the given status,
+// or with the default status of the source if status is 0
+func createIssueNotification(e Engine, userID int64, issue *Issue, commentID, updatedByID int64, status NotificationStatus, reason, action string) error {
+	notification := &Notification{
+		UserID:    userID,
+		RepoID:    issue.RepoID,
+		Status:    status,
+		IssueID:   issue.ID,
+		CommentID: commentID,
+		UpdatedBy: updatedByID,
+		Reason:    reason,
+		Action:    action,
+		Source:    issueNotificationSource(issue),
+	}
+
+	return createNotification(e, notification)
+}
+
+// ImportNotification inserts a notification imported from another system as it is. Unlike the other create
+// functions it keeps the given CreatedUnix and UpdatedUnix, so the original timing is preserved. Missing
+// timestamps are set to now and a missing status to the default status of the source.
+// As imported notifications would be lost otherwise, it fails while the creation of notifications is paused.
+func ImportNotification(n *Notification) error {
+	if IsNotificationCreationPaused() {
+		return fmt.Errorf("notification creation is paused")
+	}
+	if n.UserID <= 0 {
+		return fmt.Errorf("imported notification has no user")
+	}
+	switch n.Source {
+	case NotificationSourceIssue, NotificationSourcePullRequest:
+		if n.IssueID <= 0 || n.RepoID <= 0 {
+			return fmt.Errorf("imported notification of source %d has no issue or repository", n.Source)
+		}
+	case NotificationSourceCommit:
+		if len(n.CommitID) == 0 || n.RepoID <= 0 {
+			return fmt.Errorf("imported notification of source %d has no commit or repository", n.Source)
 		}
+	case NotificationSourceRepository:
+		if n.RepoID <= 0 {
+			return fmt.Errorf("imported notification of source %d has no repository", n.Source)
+		}
+	case NotificationSourceSystem:
+	default:
+		return fmt.Errorf("imported notification has an unknown source: %d", n.Source)
+	}
+	if n.Status == 0 {
+		n.Status = defaultNotificationStatus(n.Source)
+	}
+
+	now := timeutil.TimeStampNow()
+	if n.CreatedUnix == 0 {
+		n.CreatedUnix = now
+	}
+	if n.UpdatedUnix == 0 {
+		n.UpdatedUnix = n.CreatedUnix
+	}
+
+	if _, err := x.NoAutoTime().Insert(n); err != nil {
+		return err
 	}
+	countNotificationsCreated(1)
 	return nil
 }
 
-// GetRepo returns the repo of the notification
-func (n *Notification) GetRepo() (*Repository, error) {
-	return n.Repository, n.loadRepo(x)
+// issueNotificationSource returns the source of the notifications of an issue or pull request
+func issueNotificationSource(issue *Issue) NotificationSource {
+	if issue.IsPull {
+		return NotificationSourcePullRequest
+	}
+	return NotificationSourceIssue
 }
 
-// GetIssue returns the issue of the notification
-func (n *Notification) GetIssue() (*Issue, error) {
-	return n.Issue, n.loadIssue(x)
-}
+// SyncNotificationSourceForIssue updates the source of the issue and pull request notifications of the issue
+// after it has been converted, e.g. when an issue became a pull request
+func SyncNotificationSourceForIssue(issueID int64) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
 
-// HTMLURL formats a URL-string to the notification
-func (n *Notification) HTMLURL() string {
-	if n.Comment != nil {
-		return n.Comment.HTMLURL()
+	issue, err := getIssueByID(sess, issueID)
+	if err != nil {
+		return err
+	}
+	if err := syncNotificationSourceForIssue(sess, issue); err != nil {
+		return err
 	}
-	return n.Issue.HTMLURL()
+
+	return sess.Commit()
 }
 
-// APIURL formats a URL-string to the notification
-func (n *Notification) APIURL() string {
-	return setting.AppURL + path.Join("api/v1/notifications/threads", fmt.Sprintf("%d", n.ID))
+// syncNotificationSourceForIssue updates the notification sources to the current IsPull of the issue.
+// Conversions must call it in the transaction changing IsPull, so the notifications never have a stale source.
+func syncNotificationSourceForIssue(e Engine, issue *Issue) error {
+	source := issueNotificationSource(issue)
+	_, err := e.
+		Where("issue_id = ?", issue.ID).
+		In("source", NotificationSourceIssue, NotificationSourcePullRequest).
+		And("source <> ?", source).
+		Cols("source").
+		NoAutoTime().
+		Update(&Notification{Source: source})
+	return err
 }
 
-// NotificationList contains a list of notifications
-type NotificationList []*Notification
+// notificationCreationPaused is set while the creation of notifications is paused, see SetNotificationCreationPaused
+var notificationCreationPaused int32
 
-// APIFormat converts a NotificationList to api.NotificationThread list
-func (nl NotificationList) APIFormat() []*api.NotificationThread {
-	var result = make([]*api.NotificationThread, 0, len(nl))
-	for _, n := range nl {
-		result = append(result, n.APIFormat())
+// SetNotificationCreationPaused pauses or resumes the creation of notifications, e.g. during maintenance.
+// While paused new notifications are dropped for good, they are neither queued nor created on resume, and every
+// dropped notification is logged as a warning. Existing notifications can still be read and updated, so events
+// of threads the users already have a notification for still bump them.
+func SetNotificationCreationPaused(paused bool) {
+	var value int32
+	if paused {
+		value = 1
 	}
-	return result
+	atomic.StoreInt32(&notificationCreationPaused, value)
 }
 
-// LoadAttributes load Repo Issue User and Comment if not loaded
-func (nl NotificationList) LoadAttributes() (err error) {
-	for i := 0; i < len(nl); i++ {
-		err = nl[i].LoadAttributes()
-		if err != nil {
-			return
-		}
+// IsNotificationCreationPaused returns whether the creation of notifications is paused
+func IsNotificationCreationPaused() bool {
+	return atomic.LoadInt32(&notificationCreationPaused) == 1
+}
+
+// createNotification inserts the notification, using the default status of its source if none is set
+func createNotification(e Engine, notification *Notification) error {
+	if IsNotificationCreationPaused() {
+		log.Warn("Notification creation is paused, dropping notification of user %d", notification.UserID)
+		return nil
 	}
-	return
+	if notification.Status == 0 {
+		notification.Status = defaultNotificationStatus(notification.Source)
+	}
+	if _, err := e.Insert(notification); err != nil {
+		return err
+	}
+	countNotificationsCreated(1)
+	return nil
 }
 
-func (nl NotificationList) getPendingRepoIDs() []int64 {
-	var ids = make(map[int64]struct{}, len(nl))
-	for _, notification := range nl {
-		if notification.Repository != nil {
-			continue
-		}
-		if _, ok := ids[notification.RepoID]; !ok {
-			ids[notification.RepoID] = struct{}{}
-		}
+func updateIssueNotification(e Engine, userID int64, issue *Issue, commentID, updatedByID int64, reason, action string) error {
+	notification, err := getIssueNotification(e, userID, issue.ID, issueNotificationSource(issue))
+	if err != nil {
+		return err
 	}
-	return keysInt64(ids)
+
+	// NOTICE: Only update comment id when the before notification on this issue is read, otherwise you may miss some old comments.
+	// But we need update updated_by so that the notification will be reorder
+	notification.UpdatedBy = updatedByID
+	notification.Reason = reason
+	notification.Action = action
+	cols := []string{"updated_by", "reason", "action"}
+	if notification.Status == NotificationStatusRead || notification.Status == NotificationStatusDone {
+		notification.Status = NotificationStatusUnread
+		notification.CommentID = commentID
+		cols = append(cols, "status", "comment_id")
+	}
+
+	_, err = e.ID(notification.ID).Cols(cols...).Update(notification)
+	return err
 }
 
-// LoadRepos loads repositories from database
-func (nl NotificationList) LoadRepos() (RepositoryList, error) {
-	if len(nl) == 0 {
-		return RepositoryList{}, nil
+func getIssueNotification(e Engine, userID, issueID int64, source NotificationSource) (*Notification, error) {
+	notification := new(Notification)
+	_, err := e.
+		Where("user_id = ?", userID).
+		And("issue_id = ?", issueID).
+		And("source = ?", source).
+		And("deleted_unix = 0").
+		Get(notification)
+	return notification, err
+}
+
+// NotificationsForUser returns notifications for a given user and status, or the inbox if no status is given
+func NotificationsForUser(user *User, statuses []NotificationStatus, page, perPage int) (NotificationList, error) {
+	return notificationsForUser(x, user, statuses, page, perPage)
+}
+
+func notificationsForUser(e Engine, user *User, statuses []NotificationStatus, page, perPage int) (notifications []*Notification, err error) {
+	if len(statuses) == 0 {
+		statuses = InboxStatuses()
+	}
+
+	sess := e.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", statuses).
+		OrderBy("updated_unix DESC")
+
+	if page > 0 && perPage > 0 {
+		sess.Limit(perPage, (page-1)*perPage)
+	}
+
+	err = sess.Find(&notifications)
+	return
+}
+
+// AccessibleNotificationsForUser returns a page of the notifications of the user with the given statuses, or of the
+// inbox if no status is given, which the user can still access, see accessibleNotificationCond. As opposed to
+// filtering the page with FilterAccessibleNotifications afterwards, the pages are always full. Duplicated
+// notifications of a thread are excluded in the query too, see newestNotificationOfThreadCond.
+func AccessibleNotificationsForUser(user *User, statuses []NotificationStatus, page, perPage int) (NotificationList, error) {
+	if len(statuses) == 0 {
+		statuses = InboxStatuses()
+	}
+
+	sess := x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", statuses).
+		And(accessibleNotificationCond(user)).
+		And(newestNotificationOfThreadCond(user, statuses)).
+		OrderBy("updated_unix DESC, id DESC")
+	if page > 0 && perPage > 0 {
+		sess.Limit(perPage, (page-1)*perPage)
+	}
+
+	notifications := make(NotificationList, 0, perPage)
+	return notifications, sess.Find(&notifications)
+}
+
+// CountAccessibleNotificationsForUser returns the number of notifications listed by AccessibleNotificationsForUser
+// for the given statuses
+func CountAccessibleNotificationsForUser(user *User, statuses []NotificationStatus) (int64, error) {
+	if len(statuses) == 0 {
+		statuses = InboxStatuses()
+	}
+
+	return x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", statuses).
+		And(accessibleNotificationCond(user)).
+		And(newestNotificationOfThreadCond(user, statuses)).
+		Count(&Notification{})
+}
+
+// NotificationsForUserPaged returns a page of notifications for a given user and status,
+// and whether there are more notifications after this page. Instead of counting all
+// notifications it fetches one more row than requested.
+func NotificationsForUserPaged(user *User, statuses []NotificationStatus, page, perPage int) (NotificationList, bool, error) {
+	if len(statuses) == 0 || perPage <= 0 {
+		return NotificationList{}, false, nil
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	notifications := make(NotificationList, 0, perPage+1)
+	if err := x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", statuses).
+		OrderBy("updated_unix DESC, id DESC").
+		Limit(perPage+1, (page-1)*perPage).
+		Find(&notifications); err != nil {
+		return nil, false, err
+	}
+
+	hasNext := len(notifications) > perPage
+	if hasNext {
+		notifications = notifications[:perPage]
+	}
+	return notifications, hasNext, nil
+}
+
+// NotificationsForUserWindow returns up to limit notifications of the user with the given statuses which are older
+// than maxID, newest first, or the newest ones if maxID is 0. Pass the ID of the last returned notification as maxID
+// to fetch the next window. Unlike offset pagination the windows do not shift when notifications are marked as read
+// while scrolling: a notification which has been read in the meantime is still included in its window as long as
+// NotificationStatusRead is one of the statuses, and no other notification is skipped or repeated.
+func NotificationsForUserWindow(user *User, statuses []NotificationStatus, maxID int64, limit int) (NotificationList, error) {
+	if len(statuses) == 0 || limit <= 0 {
+		return NotificationList{}, nil
+	}
+
+	sess := x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", statuses)
+	if maxID > 0 {
+		sess.And("id < ?", maxID)
+	}
+
+	notifications := make(NotificationList, 0, limit)
+	return notifications, sess.
+		OrderBy("id DESC").
+		Limit(limit).
+		Find(&notifications)
+}
+
+// NotificationSyncEntry is the slim projection of a notification needed to synchronize a client
+type NotificationSyncEntry struct {
+	ID          int64
+	Status      NotificationStatus
+	IssueID     int64
+	UpdatedUnix timeutil.TimeStamp
+}
+
+// GetNotificationSyncEntries returns the notifications of the user updated after since, oldest first.
+// Only the columns of NotificationSyncEntry are loaded.
+func GetNotificationSyncEntries(user *User, since timeutil.TimeStamp) ([]NotificationSyncEntry, error) {
+	entries := make([]NotificationSyncEntry, 0, 10)
+	return entries, x.Table("notification").
+		Cols("id", "status", "issue_id", "updated_unix").
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		And("updated_unix > ?", since).
+		OrderBy("updated_unix, id").
+		Find(&entries)
+}
+
+// AllUnreadNotificationsOrdered returns all unread notifications of the user in a stable order,
+// so clients can navigate through them without paging. The list is capped by
+// setting.UI.Notification.MaxUnreadListSize.
+func AllUnreadNotificationsOrdered(user *User) (NotificationList, error) {
+	notifications := make(NotificationList, 0, 10)
+	err := x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		And("status = ?", NotificationStatusUnread).
+		OrderBy("updated_unix DESC, id DESC").
+		Limit(setting.UI.Notification.MaxUnreadListSize).
+		Find(&notifications)
+	return notifications, err
+}
+
+// mostRecentNotificationsMaxLimit is the maximum number of notifications returned by GetMostRecentNotifications
+const mostRecentNotificationsMaxLimit = 10
+
+// GetMostRecentNotifications returns the most recently updated unread notifications of the user which are not snoozed,
+// with their repositories and issues loaded. It is meant for small previews like the header dropdown, so limit is
+// capped by mostRecentNotificationsMaxLimit.
+func GetMostRecentNotifications(user *User, limit int) (NotificationList, error) {
+	if limit <= 0 {
+		return NotificationList{}, nil
+	}
+	if limit > mostRecentNotificationsMaxLimit {
+		limit = mostRecentNotificationsMaxLimit
+	}
+
+	notifications := make(NotificationList, 0, limit)
+	if err := x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		And("status = ?", NotificationStatusUnread).
+		And("snoozed_until_unix <= ?", timeutil.TimeStampNow()).
+		OrderBy("updated_unix DESC, id DESC").
+		Limit(limit).
+		Find(&notifications); err != nil {
+		return nil, err
+	}
+
+	if _, err := notifications.LoadRepos(); err != nil {
+		return nil, err
+	}
+	if err := notifications.LoadIssues(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// Age buckets of notifications, see BucketNotificationsByAge
+const (
+	NotificationAgeToday    = "today"
+	NotificationAgeThisWeek = "this_week"
+	NotificationAgeOlder    = "older"
+)
+
+// BucketNotificationsByAge groups the notifications into the age buckets NotificationAgeToday, NotificationAgeThisWeek
+// and NotificationAgeOlder by their UpdatedUnix. Days start at midnight and weeks on Monday in setting.DefaultUILocation,
+// notifications updated exactly at the start of a day or week belong to it. The order of the list is kept in every bucket.
+func BucketNotificationsByAge(nl NotificationList, now timeutil.TimeStamp) map[string]NotificationList {
+	tm := now.AsTime()
+	startOfDay := time.Date(tm.Year(), tm.Month(), tm.Day(), 0, 0, 0, 0, tm.Location())
+	// time.Weekday starts on Sunday
+	daysSinceMonday := (int(startOfDay.Weekday()) + 6) % 7
+	startOfWeek := startOfDay.AddDate(0, 0, -daysSinceMonday)
+
+	buckets := make(map[string]NotificationList, 3)
+	for _, notification := range nl {
+		updated := notification.UpdatedUnix.AsTime()
+		switch {
+		case !updated.Before(startOfDay):
+			buckets[NotificationAgeToday] = append(buckets[NotificationAgeToday], notification)
+		case !updated.Before(startOfWeek):
+			buckets[NotificationAgeThisWeek] = append(buckets[NotificationAgeThisWeek], notification)
+		default:
+			buckets[NotificationAgeOlder] = append(buckets[NotificationAgeOlder], notification)
+		}
+	}
+	return buckets
+}
+
+// NotificationSubjectBuilder builds the API subject of a notification
+type NotificationSubjectBuilder func(n *Notification) *api.NotificationSubject
+
+var notificationSubjectBuilders = map[NotificationSource]NotificationSubjectBuilder{
+	NotificationSourceIssue:       issueNotificationSubjectBuilder("Issue"),
+	NotificationSourcePullRequest: issueNotificationSubjectBuilder("Pull"),
+	NotificationSourceCommit: func(n *Notification) *api.NotificationSubject {
+		subject := &api.NotificationSubject{
+			Type:     "Commit",
+			Title:    n.CommitID,
+			IconName: n.IconName(),
+		}
+		if count := n.PushedCommits(); count == 1 {
+			subject.Title = "pushed 1 commit"
+		} else if count > 1 {
+			subject.Title = fmt.Sprintf("pushed %d commits", count)
+		}
+		return subject
+	},
+	NotificationSourceSystem: func(n *Notification) *api.NotificationSubject {
+		return &api.NotificationSubject{
+			Type:     "System",
+			Title:    n.SubjectTitle,
+			URL:      n.SubjectURL,
+			IconName: n.IconName(),
+		}
+	},
+	NotificationSourceRepository: func(n *Notification) *api.NotificationSubject {
+		subject := &api.NotificationSubject{
+			Type:     "Repository",
+			Title:    n.SubjectTitle,
+			IconName: n.IconName(),
+		}
+		if n.Action == NotificationActionMirrorFailed {
+			subject.Title = "Mirror sync failed"
+			if len(n.SubjectTitle) > 0 {
+				subject.Title += ": " + n.SubjectTitle
+			}
+			if n.Repository != nil {
+				subject.URL = n.Repository.HTMLURL() + "/settings"
+			}
+		}
+		return subject
+	},
+}
+
+// RegisterNotificationSubjectBuilder registers the builder APIFormat uses for notifications of the given source,
+// replacing the previous one. It is not safe for concurrent use and should be called on initialization.
+func RegisterNotificationSubjectBuilder(source NotificationSource, builder NotificationSubjectBuilder) {
+	notificationSubjectBuilders[source] = builder
+}
+
+func issueNotificationSubjectBuilder(subjectType string) NotificationSubjectBuilder {
+	return func(n *Notification) *api.NotificationSubject {
+		subject := &api.NotificationSubject{
+			Type:     subjectType,
+			IconName: n.IconName(),
+		}
+		if n.Issue != nil {
+			subject.Title = n.Issue.Title
+			subject.URL = n.Issue.APIURL()
+			if url, ok, err := n.externalIssueURL(); err != nil {
+				log.Error("externalIssueURL [%d]: %v", n.ID, err)
+			} else if ok {
+				subject.URL = url
+			}
+			comment, err := n.Issue.GetLastComment()
+			if err == nil && comment != nil {
+				subject.LatestCommentURL = comment.APIURL()
+			}
+			if n.Issue.DeadlineUnix != 0 {
+				dueDate := n.Issue.DeadlineUnix.AsTime()
+				subject.DueDate = &dueDate
+			}
+		}
+		return subject
+	}
+}
+
+// IconName returns the name of the octicon representing the subject of the notification and its state
+func (n *Notification) IconName() string {
+	switch n.Source {
+	case NotificationSourceIssue:
+		if n.Issue != nil && n.Issue.IsClosed {
+			return "issue-closed"
+		}
+		return "issue-opened"
+	case NotificationSourcePullRequest:
+		// the pull request is loaded with the issue, see NotificationList.LoadIssues
+		if n.Issue != nil && n.Issue.IsClosed && n.Issue.PullRequest != nil && n.Issue.PullRequest.HasMerged {
+			return "git-merge"
+		}
+		return "git-pull-request"
+	case NotificationSourceCommit:
+		return "git-commit"
+	case NotificationSourceSystem:
+		return "megaphone"
+	case NotificationSourceRepository:
+		return "alert"
+	}
+	return "bell"
+}
+
+// Age returns how long ago the notification was last updated
+func (n *Notification) Age(now timeutil.TimeStamp) time.Duration {
+	return time.Duration(now-n.UpdatedUnix) * time.Second
+}
+
+// UpdatedAgo returns the user-friendly time since the notification was last updated
+func (n *Notification) UpdatedAgo(now timeutil.TimeStamp, lang string) string {
+	return timeutil.RawTimeSinceUnix(n.UpdatedUnix, now, lang)
+}
+
+// TimeToRead returns how long it took until the notification has been read after its creation,
+// or false if it is unread
+func (n *Notification) TimeToRead() (time.Duration, bool) {
+	if n.Status == NotificationStatusUnread || n.ReadUnix == 0 {
+		return 0, false
+	}
+	return time.Duration(n.ReadUnix-n.CreatedUnix) * time.Second, true
+}
+
+// GetMedianTimeToRead returns the median time to read of the notifications of the user created since the given time,
+// or 0 if none of them has been read
+func GetMedianTimeToRead(user *User, since timeutil.TimeStamp) (time.Duration, error) {
+	notifications := make(NotificationList, 0, 10)
+	if err := x.
+		Where("user_id = ? AND created_unix >= ?", user.ID, since).
+		And("deleted_unix = 0").
+		And("status <> ? AND read_unix > 0", NotificationStatusUnread).
+		Cols("status", "created_unix", "read_unix").
+		Find(&notifications); err != nil {
+		return 0, err
+	}
+
+	durations := make([]time.Duration, 0, len(notifications))
+	for _, n := range notifications {
+		if d, ok := n.TimeToRead(); ok {
+			durations = append(durations, d)
+		}
+	}
+	if len(durations) == 0 {
+		return 0, nil
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	mid := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[mid-1] + durations[mid]) / 2, nil
+	}
+	return durations[mid], nil
+}
+
+// APIFormat converts a Notification to api.NotificationThread, the relative update time is
+// formatted in the given language
+func (n *Notification) APIFormat(lang string) *api.NotificationThread {
+	result := &api.NotificationThread{
+		ID:         n.ID,
+		Unread:     n.Status == NotificationStatusUnread,
+		Pinned:     n.Status == NotificationStatusPinned,
+		PinNote:    n.PinNote,
+		UpdatedAt:  n.UpdatedUnix.AsTime(),
+		UpdatedAgo: n.UpdatedAgo(timeutil.TimeStampNow(), lang),
+		URL:        n.APIURL(),
+
+		ActionSinceRead: n.ActionSinceRead(),
+	}
+
+	//since user only get notifications when he has access to use minimal access mode
+	if n.Repository != nil {
+		result.Repository = n.Repository.APIFormat(AccessModeRead)
+	}
+
+	//handle Subject
+	if buildSubject, ok := notificationSubjectBuilders[n.Source]; ok {
+		result.Subject = buildSubject(n)
+	}
+
+	if result.Subject != nil {
+		result.Subject.Action = n.Action
+		if n.PushedCommits() > 0 {
+			result.Subject.Action = NotificationActionPushed
+		}
+	}
+
+	result.UserTags = make([]*api.NotificationTag, 0, len(n.Tags))
+	for _, tag := range n.Tags {
+		result.UserTags = append(result.UserTags, tag.APIFormat())
+	}
+
+	if result.Subject != nil && n.Participants != nil {
+		result.Subject.Participants = make([]*api.User, 0, len(n.Participants))
+		for _, participant := range n.Participants {
+			result.Subject.Participants = append(result.Subject.Participants, participant.APIFormat())
+		}
+	}
+
+	return result
+}
+
+// LoadAttributes load Repo Issue User and Comment if not loaded
+func (n *Notification) LoadAttributes() (err error) {
+	return n.loadAttributes(x)
+}
+
+func (n *Notification) loadAttributes(e Engine) (err error) {
+	if err = n.loadRepo(e); err != nil {
+		return
+	}
+	if err = n.loadIssue(e); err != nil {
+		return
+	}
+	if err = n.loadUser(e); err != nil {
+		return
+	}
+	if err = n.loadComment(e); err != nil {
+		return
+	}
+	if err = n.loadTags(e); err != nil {
+		return
+	}
+	return
+}
+
+func (n *Notification) loadTags(e Engine) (err error) {
+	if n.Tags == nil {
+		n.Tags, err = getNotificationTags(e, n.ID)
+	}
+	return
+}
+
+func (n *Notification) loadRepo(e Engine) (err error) {
+	if n.Repository == nil && n.RepoID > 0 {
+		n.Repository, err = getRepositoryByID(e, n.RepoID)
+		if err != nil {
+			return fmt.Errorf("getRepositoryByID [%d]: %v", n.RepoID, err)
+		}
+	}
+	return nil
+}
+
+func (n *Notification) loadIssue(e Engine) (err error) {
+	if n.Issue == nil && n.IssueID > 0 {
+		n.Issue, err = getIssueByID(e, n.IssueID)
+		if err != nil {
+			return fmt.Errorf("getIssueByID [%d]: %v", n.IssueID, err)
+		}
+		return n.Issue.loadAttributes(e)
+	}
+	return nil
+}
+
+func (n *Notification) loadComment(e Engine) (err error) {
+	if n.Comment == nil && n.CommentID > 0 {
+		n.Comment, err = GetCommentByID(n.CommentID)
+		if err != nil {
+			return fmt.Errorf("GetCommentByID [%d]: %v", n.CommentID, err)
+		}
+	}
+	return nil
+}
+
+func (n *Notification) loadUser(e Engine) (err error) {
+	if n.User == nil {
+		n.User, err = getUserByID(e, n.UserID)
+		if err != nil {
+			return fmt.Errorf("getUserByID [%d]: %v", n.UserID, err)
+		}
+	}
+	return nil
+}
+
+// GetRepo returns the repo of the notification
+func (n *Notification) GetRepo() (*Repository, error) {
+	return n.Repository, n.loadRepo(x)
+}
+
+// GetIssue returns the issue of the notification
+func (n *Notification) GetIssue() (*Issue, error) {
+	return n.Issue, n.loadIssue(x)
+}
+
+// HTMLURL formats a URL-string to the notification, see RefURL
+func (n *Notification) HTMLURL() string {
+	url, err := n.RefURL()
+	if err != nil {
+		log.Error("RefURL [%d]: %v", n.ID, err)
+	}
+	return url
+}
+
+// RefURL returns the URL of the subject of the notification depending on its source,
+// loading the required attributes if needed
+func (n *Notification) RefURL() (string, error) {
+	switch n.Source {
+	case NotificationSourceIssue, NotificationSourcePullRequest:
+		if err := n.loadIssue(x); err != nil {
+			return "", err
+		}
+		if n.Issue == nil {
+			return "", ErrNotExist{ID: n.IssueID}
+		}
+		if err := n.Issue.loadRepo(x); err != nil {
+			return "", err
+		}
+		if url, ok, err := n.externalIssueURL(); err != nil {
+			return "", err
+		} else if ok {
+			return url, nil
+		}
+		if err := n.loadComment(x); err != nil {
+			return "", err
+		}
+		if n.Comment != nil {
+			if n.Comment.Issue == nil {
+				n.Comment.Issue = n.Issue
+			}
+			return n.Comment.HTMLURL(), nil
+		}
+		return n.Issue.HTMLURL(), nil
+	case NotificationSourceSystem:
+		return n.SubjectURL, nil
+	}
+
+	if err := n.loadRepo(x); err != nil {
+		return "", err
+	}
+	if n.Repository == nil {
+		return "", ErrNotExist{ID: n.RepoID}
+	}
+	if n.Source == NotificationSourceCommit {
+		return n.Repository.HTMLURL() + "/commit/" + n.CommitID, nil
+	}
+	if n.Source == NotificationSourceRepository && n.Action == NotificationActionMirrorFailed {
+		return n.Repository.HTMLURL() + "/settings", nil
+	}
+	if n.CoalescedNotifications() > 0 {
+		return n.Repository.HTMLURL() + "/issues", nil
+	}
+	return n.Repository.HTMLURL(), nil
+}
+
+// externalIssueURL returns the URL of the issue of the notification in the external issue tracker of its repository.
+// Like the issue page it returns false for pull requests and if the tracker does not use numeric issue names.
+// The issue and its repository have to be loaded.
+func (n *Notification) externalIssueURL() (string, bool, error) {
+	if n.Source != NotificationSourceIssue || n.Issue == nil || n.Issue.Repo == nil {
+		return "", false, nil
+	}
+
+	unit, err := n.Issue.Repo.GetUnit(UnitTypeExternalTracker)
+	if err != nil {
+		if IsErrUnitTypeNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	config := unit.ExternalTrackerConfig()
+	if config.ExternalTrackerStyle != markup.IssueNameStyleNumeric && config.ExternalTrackerStyle != "" {
+		return "", false, nil
+	}
+
+	// ComposeMetas caches the metas in the repository, so they are copied before adding the index
+	metas := make(map[string]string)
+	for k, v := range n.Issue.Repo.ComposeMetas() {
+		metas[k] = v
+	}
+	metas["index"] = strconv.FormatInt(n.Issue.Index, 10)
+	return com.Expand(config.ExternalTrackerFormat, metas), true, nil
+}
+
+// APIURL formats a URL-string to the notification
+func (n *Notification) APIURL() string {
+	return setting.AppURL + path.Join("api/v1/notifications/threads", fmt.Sprintf("%d", n.ID))
+}
+
+// NotificationList contains a list of notifications
+type NotificationList []*Notification
+
+// APIFormat converts a NotificationList to api.NotificationThread list
+func (nl NotificationList) APIFormat(lang string) []*api.NotificationThread {
+	var result = make([]*api.NotificationThread, 0, len(nl))
+	for _, n := range nl {
+		result = append(result, n.APIFormat(lang))
+	}
+	return result
+}
+
+// Dedup returns the list without duplicated notifications of a user for the same issue and source,
+// keeping the most recently updated one at its position. Such duplicates should not exist, this is
+// only a safety net so they are not shown twice until the data has been repaired.
+func (nl NotificationList) Dedup() NotificationList {
+	type threadKey struct {
+		userID  int64
+		issueID int64
+		source  NotificationSource
+	}
+	keyOf := func(n *Notification) threadKey {
+		return threadKey{userID: n.UserID, issueID: n.IssueID, source: n.Source}
+	}
+
+	newest := make(map[threadKey]*Notification, len(nl))
+	withoutIssue := 0
+	for _, n := range nl {
+		// notifications without an issue are never duplicates of each other
+		if n.IssueID == 0 {
+			withoutIssue++
+			continue
+		}
+		key := keyOf(n)
+		if cur, ok := newest[key]; !ok || n.UpdatedUnix > cur.UpdatedUnix || (n.UpdatedUnix == cur.UpdatedUnix && n.ID > cur.ID) {
+			newest[key] = n
+		}
+	}
+	if len(newest)+withoutIssue == len(nl) {
+		return nl
+	}
+
+	result := make(NotificationList, 0, len(newest)+withoutIssue)
+	for _, n := range nl {
+		if n.IssueID != 0 && newest[keyOf(n)] != n {
+			continue
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// Version identifies the state of the notification a client has seen. It changes whenever the notification
+// is updated or its status changes, so it can be used as ETag of the notification.
+func (n *Notification) Version() string {
+	return fmt.Sprintf("%d-%d-%d", n.ID, n.UpdatedUnix, n.Status)
+}
+
+// NotificationDelta are the IDs of the notifications which changed between two fetches of a list, in ascending order
+type NotificationDelta struct {
+	Added   []int64
+	Removed []int64
+	// StatusChanged are the notifications whose status changed
+	StatusChanged []int64
+	// Updated are the notifications whose version changed while their status did not, e.g. after a new comment
+	Updated []int64
+}
+
+// IsEmpty returns true if nothing changed
+func (d NotificationDelta) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.StatusChanged) == 0 && len(d.Updated) == 0
+}
+
+// DiffNotifications compares two fetches of a list of notifications by their IDs and versions
+// and returns what changed from previous to current
+func DiffNotifications(previous, current NotificationList) NotificationDelta {
+	var delta NotificationDelta
+	before := make(map[int64]*Notification, len(previous))
+	for _, n := range previous {
+		before[n.ID] = n
+	}
+
+	seen := make(map[int64]bool, len(current))
+	for _, n := range current {
+		seen[n.ID] = true
+		old, ok := before[n.ID]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, n.ID)
+		case old.Status != n.Status:
+			delta.StatusChanged = append(delta.StatusChanged, n.ID)
+		case old.Version() != n.Version():
+			delta.Updated = append(delta.Updated, n.ID)
+		}
+	}
+	for _, n := range previous {
+		if !seen[n.ID] {
+			delta.Removed = append(delta.Removed, n.ID)
+		}
+	}
+
+	for _, ids := range [][]int64{delta.Added, delta.Removed, delta.StatusChanged, delta.Updated} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return delta
+}
+
+// LoadAttributes load Repo Issue User and Comment if not loaded,
+// the repositories, issues and tags of all notifications are loaded at once
+func (nl NotificationList) LoadAttributes() (err error) {
+	if _, err = nl.LoadRepos(); err != nil {
+		return
+	}
+	if err = nl.LoadIssues(); err != nil {
+		return
+	}
+	if err = nl.loadTags(x); err != nil {
+		return
+	}
+	for i := 0; i < len(nl); i++ {
+		err = nl[i].LoadAttributes()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (nl NotificationList) getPendingRepoIDs() []int64 {
+	var ids = make(map[int64]struct{}, len(nl))
+	for _, notification := range nl {
+		if notification.Repository != nil || notification.RepoID == 0 {
+			continue
+		}
+		if _, ok := ids[notification.RepoID]; !ok {
+			ids[notification.RepoID] = struct{}{}
+		}
+	}
+	return keysInt64(ids)
+}
+
+// LoadRepos loads repositories from database
+func (nl NotificationList) LoadRepos() (RepositoryList, error) {
+	if len(nl) == 0 {
+		return RepositoryList{}, nil
+	}
+
+	var repoIDs = nl.getPendingRepoIDs()
+	var repos = make(map[int64]*Repository, len(repoIDs))
+	var left = len(repoIDs)
+	for left > 0 {
+		var limit = defaultMaxInSize
+		if left < limit {
+			limit = left
+		}
+		rows, err := x.
+			In("id", repoIDs[:limit]).
+			Rows(new(Repository))
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var repo Repository
+			err = rows.Scan(&repo)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			repos[repo.ID] = &repo
+		}
+		_ = rows.Close()
+
+		left -= limit
+		repoIDs = repoIDs[limit:]
+	}
+
+	var reposList = make(RepositoryList, 0, len(repoIDs))
+	for _, notification := range nl {
+		if notification.Repository == nil {
+			notification.Repository = repos[notification.RepoID]
+		}
+		if notification.Repository == nil {
+			continue
+		}
+		if notification.Issue != nil && notification.Issue.Repo == nil {
+			notification.Issue.Repo = notification.Repository
+		}
+		var found bool
+		for _, r := range reposList {
+			if r.ID == notification.Repository.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			reposList = append(reposList, notification.Repository)
+		}
+	}
+
+	// the units are needed for the URLs of issues of repositories using an external tracker
+	if err := loadRepositoryUnits(x, reposList); err != nil {
+		return nil, err
+	}
+	return reposList, nil
+}
+
+// loadRepositoryUnits loads the units of the repositories which have not been loaded yet in batches
+func loadRepositoryUnits(e Engine, repos RepositoryList) error {
+	repoIDs := make([]int64, 0, len(repos))
+	for _, repo := range repos {
+		if repo.Units == nil {
+			repoIDs = append(repoIDs, repo.ID)
+		}
+	}
+
+	units := make(map[int64][]*RepoUnit, len(repoIDs))
+	for len(repoIDs) > 0 {
+		limit := defaultMaxInSize
+		if len(repoIDs) < limit {
+			limit = len(repoIDs)
+		}
+		batch := make([]*RepoUnit, 0, limit)
+		if err := e.In("repo_id", repoIDs[:limit]).Find(&batch); err != nil {
+			return err
+		}
+		for _, unit := range batch {
+			units[unit.RepoID] = append(units[unit.RepoID], unit)
+		}
+		repoIDs = repoIDs[limit:]
+	}
+
+	for _, repo := range repos {
+		if repo.Units == nil {
+			repo.Units = units[repo.ID]
+			if repo.Units == nil {
+				repo.Units = []*RepoUnit{}
+			}
+		}
+	}
+	return nil
+}
+
+func (nl NotificationList) getPendingIssueIDs() []int64 {
+	var ids = make(map[int64]struct{}, len(nl))
+	for _, notification := range nl {
+		if notification.Issue != nil || notification.IssueID == 0 {
+			continue
+		}
+		if _, ok := ids[notification.IssueID]; !ok {
+			ids[notification.IssueID] = struct{}{}
+		}
+	}
+	return keysInt64(ids)
+}
+
+// LoadIssues loads issues from database, together with the pull requests of the pull request issues
+func (nl NotificationList) LoadIssues() error {
+	if len(nl) == 0 {
+		return nil
+	}
+
+	var issueIDs = nl.getPendingIssueIDs()
+	var issues = make(map[int64]*Issue, len(issueIDs))
+	var left = len(issueIDs)
+	for left > 0 {
+		var limit = defaultMaxInSize
+		if left < limit {
+			limit = left
+		}
+		rows, err := x.
+			In("id", issueIDs[:limit]).
+			Rows(new(Issue))
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var issue Issue
+			err = rows.Scan(&issue)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			issues[issue.ID] = &issue
+		}
+		_ = rows.Close()
+
+		left -= limit
+		issueIDs = issueIDs[limit:]
+	}
+
+	for _, notification := range nl {
+		if notification.Issue == nil && notification.IssueID > 0 {
+			notification.Issue = issues[notification.IssueID]
+			if notification.Issue != nil {
+				notification.Issue.Repo = notification.Repository
+			}
+		}
+	}
+
+	// the pull requests are needed for the state of the notifications, see Notification.IconName
+	var pulls = make(map[int64]*Issue, len(issues))
+	for _, notification := range nl {
+		if notification.Issue != nil && notification.Issue.IsPull && notification.Issue.PullRequest == nil {
+			pulls[notification.Issue.ID] = notification.Issue
+		}
+	}
+	var pullList = make(IssueList, 0, len(pulls))
+	for _, issue := range pulls {
+		pullList = append(pullList, issue)
+	}
+	return pullList.loadPullRequests(x)
+}
+
+func (nl NotificationList) getPendingCommentIDs() []int64 {
+	var ids = make(map[int64]struct{}, len(nl))
+	for _, notification := range nl {
+		if notification.CommentID == 0 || notification.Comment != nil {
+			continue
+		}
+		if _, ok := ids[notification.CommentID]; !ok {
+			ids[notification.CommentID] = struct{}{}
+		}
+	}
+	return keysInt64(ids)
+}
+
+// LoadComments loads comments from database
+func (nl NotificationList) LoadComments() error {
+	if len(nl) == 0 {
+		return nil
+	}
+
+	var commentIDs = nl.getPendingCommentIDs()
+	var comments = make(map[int64]*Comment, len(commentIDs))
+	var left = len(commentIDs)
+	for left > 0 {
+		var limit = defaultMaxInSize
+		if left < limit {
+			limit = left
+		}
+		rows, err := x.
+			In("id", commentIDs[:limit]).
+			Rows(new(Comment))
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var comment Comment
+			err = rows.Scan(&comment)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			comments[comment.ID] = &comment
+		}
+		_ = rows.Close()
+
+		left -= limit
+		commentIDs = commentIDs[limit:]
+	}
+
+	for _, notification := range nl {
+		if notification.CommentID > 0 && notification.Comment == nil && comments[notification.CommentID] != nil {
+			notification.Comment = comments[notification.CommentID]
+			notification.Comment.Issue = notification.Issue
+		}
+	}
+	return nl.loadCommentReviews()
+}
+
+// loadCommentReviews loads the reviews of the code comments, which are needed for their URLs
+func (nl NotificationList) loadCommentReviews() error {
+	var ids = make(map[int64]struct{}, len(nl))
+	for _, notification := range nl {
+		if c := notification.Comment; c != nil && c.Type == CommentTypeCode && c.ReviewID > 0 && c.Review == nil {
+			ids[c.ReviewID] = struct{}{}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var reviewIDs = keysInt64(ids)
+	var reviews = make(map[int64]*Review, len(reviewIDs))
+	for len(reviewIDs) > 0 {
+		var limit = defaultMaxInSize
+		if len(reviewIDs) < limit {
+			limit = len(reviewIDs)
+		}
+		batch := make([]*Review, 0, limit)
+		if err := x.In("id", reviewIDs[:limit]).Find(&batch); err != nil {
+			return err
+		}
+		for _, review := range batch {
+			reviews[review.ID] = review
+		}
+		reviewIDs = reviewIDs[limit:]
+	}
+
+	for _, notification := range nl {
+		if c := notification.Comment; c != nil && c.Type == CommentTypeCode && c.ReviewID > 0 && c.Review == nil {
+			c.Review = reviews[c.ReviewID]
+		}
+	}
+	return nil
+}
+
+func (nl NotificationList) getPendingUserIDs() []int64 {
+	var ids = make(map[int64]struct{}, len(nl))
+	for _, notification := range nl {
+		if notification.User != nil {
+			continue
+		}
+		if _, ok := ids[notification.UserID]; !ok {
+			ids[notification.UserID] = struct{}{}
+		}
+	}
+	return keysInt64(ids)
+}
+
+// LoadUsers loads the users the notifications belong to from database, users which do not exist
+// anymore are replaced by the ghost user
+func (nl NotificationList) LoadUsers() error {
+	return nl.loadUsers(x)
+}
+
+func (nl NotificationList) loadUsers(e Engine) error {
+	if len(nl) == 0 {
+		return nil
+	}
+
+	var userIDs = nl.getPendingUserIDs()
+	var users = make(map[int64]*User, len(userIDs))
+	var left = len(userIDs)
+	for left > 0 {
+		var limit = defaultMaxInSize
+		if left < limit {
+			limit = left
+		}
+		if err := e.
+			In("id", userIDs[:limit]).
+			Find(&users); err != nil {
+			return err
+		}
+		left -= limit
+		userIDs = userIDs[limit:]
+	}
+
+	for _, notification := range nl {
+		if notification.User != nil {
+			continue
+		}
+		var ok bool
+		if notification.User, ok = users[notification.UserID]; !ok {
+			notification.User = NewGhostUser()
+		}
+	}
+	return nil
+}
+
+// FilterAccessibleNotifications returns the notifications of the list which the user can still access, e.g. after the
+// repository has been made private or its issues have been disabled. Issue and pull request notifications require read
+// access to the issues or pull requests of the repository, commit notifications to its code. Notifications which are
+// not related to a repository are always accessible, notifications of deleted repositories or issues never.
+func FilterAccessibleNotifications(user *User, nl NotificationList) (NotificationList, error) {
+	if _, err := nl.LoadRepos(); err != nil {
+		return nil, err
+	}
+	if err := nl.LoadIssues(); err != nil {
+		return nil, err
+	}
+
+	perms := make(map[int64]Permission)
+	result := make(NotificationList, 0, len(nl))
+	for _, notification := range nl {
+		if notification.RepoID == 0 {
+			result = append(result, notification)
+			continue
+		}
+		if notification.Repository == nil {
+			continue
+		}
+
+		perm, ok := perms[notification.RepoID]
+		if !ok {
+			var err error
+			perm, err = getUserRepoPermission(x, notification.Repository, user)
+			if err != nil {
+				return nil, err
+			}
+			perms[notification.RepoID] = perm
+		}
+
+		var accessible bool
+		switch notification.Source {
+		case NotificationSourceIssue, NotificationSourcePullRequest:
+			accessible = notification.Issue != nil && perm.CanReadIssuesOrPulls(notification.Issue.IsPull)
+		case NotificationSourceCommit:
+			accessible = perm.CanRead(UnitTypeCode)
+		default:
+			accessible = perm.HasAccess()
+		}
+		if accessible {
+			result = append(result, notification)
+		}
+	}
+	return result, nil
+}
+
+// accessibleNotificationCond returns the condition of the notifications the user can still access, the same as
+// FilterAccessibleNotifications but evaluated by the database so it can be combined with pagination and counts.
+// The repository has to be visible to the user, see accessibleRepositoryCondition, and the unit of the notification
+// has to be enabled: issues or pull requests depending on the issue, code for commit notifications. Restrictions
+// of the units of teams are not taken into account.
+func accessibleNotificationCond(user *User) builder.Cond {
+	repos := builder.Select("`repository`.id").From("`repository`")
+	if !user.IsAdmin {
+		repos = repos.Where(accessibleRepositoryCondition(user.ID))
+	}
+	unitRepos := func(unitType UnitType) *builder.Builder {
+		return builder.Select("repo_id").From("repo_unit").Where(builder.Eq{"`type`": unitType})
+	}
+	readableIssues := builder.Select("issue.id").From("issue").Where(builder.Or(
+		builder.Eq{"issue.is_pull": false}.And(builder.In("issue.repo_id", unitRepos(UnitTypeIssues))),
+		builder.Eq{"issue.is_pull": true}.And(builder.In("issue.repo_id", unitRepos(UnitTypePullRequests))),
+	))
+
+	return builder.Eq{"notification.repo_id": 0}.Or(builder.And(
+		builder.In("notification.repo_id", repos),
+		builder.Or(
+			builder.In("notification.source", NotificationSourceIssue, NotificationSourcePullRequest).
+				And(builder.In("notification.issue_id", readableIssues)),
+			builder.Eq{"notification.source": NotificationSourceCommit}.
+				And(builder.In("notification.repo_id", unitRepos(UnitTypeCode))),
+			builder.NotIn("notification.source", NotificationSourceIssue, NotificationSourcePullRequest, NotificationSourceCommit),
+		),
+	))
+}
+
+// newestNotificationOfThreadCond returns the condition excluding the notifications of the user with the given
+// statuses for which there is a more recently updated notification of the same issue and source, like
+// NotificationList.Dedup but evaluated by the database so it can be combined with pagination and counts.
+func newestNotificationOfThreadCond(user *User, statuses []NotificationStatus) builder.Cond {
+	return builder.Eq{"notification.issue_id": 0}.Or(builder.NotIn("notification.id",
+		builder.Select("older.id").From("notification", "older").
+			Join("INNER", "notification newer", "newer.user_id = older.user_id AND newer.issue_id = older.issue_id AND newer.source = older.source").
+			Where(builder.Eq{"older.user_id": user.ID, "newer.deleted_unix": 0}.
+				And(builder.Neq{"older.issue_id": 0}).
+				And(builder.In("newer.status", statuses)).
+				And(builder.Expr("(newer.updated_unix > older.updated_unix OR (newer.updated_unix = older.updated_unix AND newer.id > older.id))")))))
+}
+
+// LoadAttributesForUserGroups loads Repo, Issue, User and Comment of notifications grouped by user ID.
+// The groups are loaded as a whole, so repositories, issues and comments shared by several users
+// are only fetched once and shared by their notifications.
+func LoadAttributesForUserGroups(groups map[int64]NotificationList) error {
+	var all NotificationList
+	var userIDs = make([]int64, 0, len(groups))
+	for userID, nl := range groups {
+		all = append(all, nl...)
+		userIDs = append(userIDs, userID)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	if _, err := all.LoadRepos(); err != nil {
+		return err
+	}
+	if err := all.LoadIssues(); err != nil {
+		return err
+	}
+	if err := all.LoadComments(); err != nil {
+		return err
+	}
+
+	users, err := GetUsersByIDs(userIDs)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		for _, notification := range groups[user.ID] {
+			if notification.User == nil {
+				notification.User = user
+			}
+		}
+	}
+	return nil
+}
+
+// notificationParticipantsLimit is the maximum number of participants loaded per notification
+const notificationParticipantsLimit = 5
+
+// LoadParticipants loads the first distinct commenters of the issues of the notifications,
+// at most notificationParticipantsLimit per notification. Commenters whose account has been
+// deleted are replaced by the ghost user. Notifications of other sources get no participants.
+func (nl NotificationList) LoadParticipants() error {
+	var issueIDs = make(map[int64]struct{}, len(nl))
+	for _, notification := range nl {
+		if notification.Participants != nil {
+			continue
+		}
+		if notification.Source != NotificationSourceIssue && notification.Source != NotificationSourcePullRequest {
+			notification.Participants = []*User{}
+			continue
+		}
+		issueIDs[notification.IssueID] = struct{}{}
+	}
+	if len(issueIDs) == 0 {
+		return nil
+	}
+
+	type issueCommenter struct {
+		IssueID  int64
+		PosterID int64
+		FirstID  int64
+	}
+
+	var ids = keysInt64(issueIDs)
+	var posterIDsByIssue = make(map[int64][]int64, len(ids))
+	var posterIDs = make(map[int64]struct{})
+	for len(ids) > 0 {
+		var limit = defaultMaxInSize
+		if len(ids) < limit {
+			limit = len(ids)
+		}
+
+		commenters := make([]*issueCommenter, 0, limit)
+		if err := x.Table("comment").
+			Select("issue_id, poster_id, MIN(id) AS first_id").
+			In("issue_id", ids[:limit]).
+			And("type = ?", CommentTypeComment).
+			GroupBy("issue_id, poster_id").
+			OrderBy("first_id").
+			Find(&commenters); err != nil {
+			return err
+		}
+
+		for _, commenter := range commenters {
+			if len(posterIDsByIssue[commenter.IssueID]) >= notificationParticipantsLimit {
+				continue
+			}
+			posterIDsByIssue[commenter.IssueID] = append(posterIDsByIssue[commenter.IssueID], commenter.PosterID)
+			posterIDs[commenter.PosterID] = struct{}{}
+		}
+
+		ids = ids[limit:]
+	}
+
+	var users = make(map[int64]*User, len(posterIDs))
+	var userIDs = keysInt64(posterIDs)
+	for len(userIDs) > 0 {
+		var limit = defaultMaxInSize
+		if len(userIDs) < limit {
+			limit = len(userIDs)
+		}
+
+		list := make([]*User, 0, limit)
+		if err := x.In("id", userIDs[:limit]).Find(&list); err != nil {
+			return err
+		}
+		for _, user := range list {
+			users[user.ID] = user
+		}
+
+		userIDs = userIDs[limit:]
+	}
+
+	for _, notification := range nl {
+		if notification.Participants != nil {
+			continue
+		}
+		notification.Participants = make([]*User, 0, len(posterIDsByIssue[notification.IssueID]))
+		for _, posterID := range posterIDsByIssue[notification.IssueID] {
+			user, ok := users[posterID]
+			if !ok {
+				user = NewGhostUser()
+			}
+			notification.Participants = append(notification.Participants, user)
+		}
+	}
+	return nil
+}
+
+// GetNotificationCount returns the notification count for user
+func GetNotificationCount(user *User, status NotificationStatus) (int64, error) {
+	return getNotificationCount(x, user, status)
+}
+
+func getNotificationCount(e Engine, user *User, status NotificationStatus) (count int64, err error) {
+	count, err = e.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		And("status = ?", status).
+		Count(&Notification{})
+	return
+}
+
+// notificationUnreadCountCache caches the effective unread counts of the users, see GetCachedUnreadCount.
+// It is invalidated by the AfterInsert, AfterUpdate and AfterDelete processors of Notification, so writes through
+// a Notification bean drop the count of its user, or all counts if the bean names no user, e.g. for updates by
+// condition. Raw SQL statements bypass the processors and have to invalidate the cache themselves.
+// As snoozed notifications wake up without being written, a count expires when the next snooze of its user ends.
+type notificationUnreadCountCache struct {
+	lock   sync.Mutex
+	counts map[int64]cachedUnreadCount
+	// generation is increased on every invalidation, so a count read from the database
+	// is not cached if the notifications changed in the meantime
+	generation uint64
+}
+
+type cachedUnreadCount struct {
+	count int64
+	// expires is the time the count becomes stale, 0 if it does not expire
+	expires timeutil.TimeStamp
+}
+
+var notificationUnreadCounts = &notificationUnreadCountCache{counts: make(map[int64]cachedUnreadCount)}
+
+func (c *notificationUnreadCountCache) get(userID int64, now timeutil.TimeStamp) (count int64, generation uint64, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.counts[userID]
+	if ok && cached.expires > 0 && cached.expires <= now {
+		ok = false
+	}
+	return cached.count, c.generation, ok
+}
+
+func (c *notificationUnreadCountCache) set(userID, count int64, expires timeutil.TimeStamp, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation == generation {
+		c.counts[userID] = cachedUnreadCount{count: count, expires: expires}
+	}
+}
+
+// invalidate drops the count of the user, or all counts if userID is 0
+func (c *notificationUnreadCountCache) invalidate(userID int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	if userID == 0 {
+		c.counts = make(map[int64]cachedUnreadCount)
+		return
+	}
+	delete(c.counts, userID)
+}
+
+// AfterInsert is invoked from XORM after inserting an object of this type.
+func (n *Notification) AfterInsert() {
+	notificationUnreadCounts.invalidate(n.UserID)
+}
+
+// AfterUpdate is invoked from XORM after updating this object.
+func (n *Notification) AfterUpdate() {
+	notificationUnreadCounts.invalidate(n.UserID)
+}
+
+// AfterDelete is invoked from XORM after the object is deleted.
+func (n *Notification) AfterDelete() {
+	notificationUnreadCounts.invalidate(n.UserID)
+}
+
+// GetCachedUnreadCount returns the effective unread count of the user like GetEffectiveUnreadCount,
+// but serves it from an in-process cache which is invalidated whenever notifications are written
+func GetCachedUnreadCount(user *User) (int64, error) {
+	now := timeutil.TimeStampNow()
+	count, generation, ok := notificationUnreadCounts.get(user.ID, now)
+	if ok {
+		return count, nil
+	}
+
+	count, err := getEffectiveUnreadCount(x, user)
+	if err != nil {
+		return 0, err
+	}
+
+	// the count changes when the next snoozed notification in the inbox wakes up
+	snoozed := new(Notification)
+	has, err := x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", InboxStatuses()).
+		And("snoozed_until_unix > ?", now).
+		OrderBy("snoozed_until_unix").
+		Cols("snoozed_until_unix").
+		Get(snoozed)
+	if err != nil {
+		return 0, err
+	}
+	var expires timeutil.TimeStamp
+	if has {
+		expires = snoozed.SnoozedUntilUnix
+	}
+	notificationUnreadCounts.set(user.ID, count, expires, generation)
+	return count, nil
+}
+
+// InboxStatuses returns the statuses of the notifications which are in the inbox of the users, as configured
+// by NOTIFICATION_INBOX_STATUSES. Notifications of the other statuses are archived. Unknown statuses are
+// ignored and unread is used if none is left.
+func InboxStatuses() []NotificationStatus {
+	statuses := make([]NotificationStatus, 0, len(setting.Service.NotificationInboxStatuses))
+	for _, name := range setting.Service.NotificationInboxStatuses {
+		for _, status := range []NotificationStatus{NotificationStatusUnread, NotificationStatusRead, NotificationStatusPinned, NotificationStatusDone} {
+			if strings.EqualFold(name, status.String()) && !notificationStatusesContain(statuses, status) {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+	if len(statuses) == 0 {
+		return []NotificationStatus{NotificationStatusUnread}
+	}
+	return statuses
+}
+
+func notificationStatusesContain(statuses []NotificationStatus, status NotificationStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInboxNotificationCount returns the number of notifications in the inbox of the user, see InboxStatuses
+func GetInboxNotificationCount(user *User) (int64, error) {
+	return x.
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		In("status", InboxStatuses()).
+		Count(&Notification{})
+}
+
+// GetEffectiveUnreadCount returns the number of notifications in the inbox of the user which are not snoozed.
+// This is the canonical unread count which should be used for the notification badge.
+func GetEffectiveUnreadCount(user *User) (int64, error) {
+	return getEffectiveUnreadCount(x, user)
+}
+
+func getEffectiveUnreadCount(e Engine, user *User) (int64, error) {
+	return e.Where(effectiveUnreadCond(user)).Count(&Notification{})
+}
+
+// effectiveUnreadCond returns the condition of the notifications counted by GetEffectiveUnreadCount
+func effectiveUnreadCond(user *User) builder.Cond {
+	return builder.Eq{"user_id": user.ID, "deleted_unix": 0}.
+		And(builder.In("status", InboxStatuses())).
+		And(builder.Lte{"snoozed_until_unix": timeutil.TimeStampNow()})
+}
+
+// participatingNotificationReasons are the reasons of notifications about threads the user takes part in,
+// as opposed to threads the user only watches
+var participatingNotificationReasons = []string{
+	NotificationReasonPush,
+	NotificationReasonReaction,
+	NotificationReasonReminder,
+	NotificationReasonMention,
+}
+
+// GetNotificationCountsSplit returns the number of effectively unread notifications of the user
+// and how many of them are about threads the user participates in, using a single query.
+func GetNotificationCountsSplit(user *User) (all, participating int64, err error) {
+	return getNotificationCountsSplit(x, user)
+}
+
+func getNotificationCountsSplit(e Engine, user *User) (all, participating int64, err error) {
+	counts := struct {
+		AllCount           int64
+		ParticipatingCount int64
+	}{}
+	participatingCond, err := builder.ToBoundSQL(builder.In("reason", participatingNotificationReasons))
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err = e.Table("notification").
+		Select("COUNT(*) AS all_count, COALESCE(SUM(CASE WHEN " + participatingCond + " THEN 1 ELSE 0 END), 0) AS participating_count").
+		Where(effectiveUnreadCond(user)).
+		Get(&counts); err != nil {
+		return 0, 0, err
+	}
+	return counts.AllCount, counts.ParticipatingCount, nil
+}
+
+// GetNotificationSummary returns the number of notifications of the user with the given status and across how many
+// distinct repositories and issues they are, using a single query. Notifications which are not related to a
+// repository or an issue are counted in total only.
+func GetNotificationSummary(user *User, status NotificationStatus) (total, distinctRepos, distinctIssues int64, err error) {
+	summary := struct {
+		Total          int64
+		DistinctRepos  int64
+		DistinctIssues int64
+	}{}
+	if _, err = x.Table("notification").
+		Select("COUNT(*) AS total, "+
+			"COUNT(DISTINCT CASE WHEN repo_id <> 0 THEN repo_id END) AS distinct_repos, "+
+			"COUNT(DISTINCT CASE WHEN issue_id <> 0 THEN issue_id END) AS distinct_issues").
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		And("status = ?", status).
+		Get(&summary); err != nil {
+		return 0, 0, 0, err
+	}
+	return summary.Total, summary.DistinctRepos, summary.DistinctIssues, nil
+}
+
+// GetInboxZeroTime returns when the user emptied the inbox the last time, derived from the last read
+// of a notification before the oldest currently unread notification became unread.
+// It returns false if the user has never been at zero unread notifications.
+func GetInboxZeroTime(user *User) (timeutil.TimeStamp, bool, error) {
+	cond := builder.Eq{"user_id": user.ID, "deleted_unix": 0}.
+		And(builder.Neq{"status": NotificationStatusUnread}).
+		And(builder.Gt{"read_unix": 0})
+
+	// bumps change updated_unix, so the unread notifications are dated by stable timestamps:
+	// never read ones became unread when they were created, the others after they have been read,
+	// as read_unix is only stamped on the transition from unread to read
+	unreadCond := builder.Eq{"user_id": user.ID, "deleted_unix": 0, "status": NotificationStatusUnread}
+	var unreadSince timeutil.TimeStamp
+	oldestNew := new(Notification)
+	has, err := x.Where(unreadCond.And(builder.Eq{"read_unix": 0})).OrderBy("created_unix").Get(oldestNew)
+	if err != nil {
+		return 0, false, err
+	}
+	if has {
+		unreadSince = oldestNew.CreatedUnix
+	}
+	oldestReread := new(Notification)
+	has, err = x.Where(unreadCond.And(builder.Gt{"read_unix": 0})).OrderBy("read_unix").Get(oldestReread)
+	if err != nil {
+		return 0, false, err
+	}
+	if has && (unreadSince == 0 || oldestReread.ReadUnix < unreadSince) {
+		unreadSince = oldestReread.ReadUnix
+	}
+	if unreadSince > 0 {
+		// reads after the oldest unread notification became unread did not empty the inbox
+		cond = cond.And(builder.Lt{"read_unix": unreadSince})
+	}
+
+	lastRead := new(Notification)
+	has, err = x.Where(cond).OrderBy("read_unix DESC").Get(lastRead)
+	if err != nil || !has {
+		return 0, false, err
+	}
+	return lastRead.ReadUnix, true, nil
+}
+
+// GetUnreadCountsForUserRepos returns the number of unread notifications of the user per repository the user
+// is a member of, i.e. owns or has access to as collaborator or through a team. Repositories without unread
+// notifications are included with a count of 0, other repositories are excluded.
+func GetUnreadCountsForUserRepos(user *User) (map[int64]int64, error) {
+	memberRepos := builder.Or(
+		builder.Eq{"repository.owner_id": user.ID},
+		builder.In("repository.id", builder.Select("repo_id").From("access").
+			Where(builder.Eq{"user_id": user.ID}.And(builder.Gt{"mode": AccessModeNone}))),
+		builder.In("repository.id", builder.Select("team_repo.repo_id").From("team_repo").
+			Join("INNER", "team_user", "team_user.team_id = team_repo.team_id").
+			Where(builder.Eq{"team_user.uid": user.ID})),
+	)
+
+	rows := make([]struct {
+		RepoID int64
+		Unread int64
+	}, 0, 10)
+	if err := x.Table("repository").
+		Select("repository.id AS repo_id, COUNT(notification.id) AS unread").
+		Join("LEFT", "notification", "notification.repo_id = repository.id AND notification.user_id = ? AND notification.status = ? AND notification.deleted_unix = 0",
+			user.ID, NotificationStatusUnread).
+		Where(memberRepos).
+		GroupBy("repository.id").
+		Find(&rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RepoID] = row.Unread
+	}
+	return counts, nil
+}
+
+// SnoozeNotification hides the notification from the unread count until the given time
+func SnoozeNotification(notificationID int64, user *User, until timeutil.TimeStamp) error {
+	notification, err := getOwnedNotification(x, user, notificationID)
+	if err != nil {
+		return err
+	}
+
+	notification.SnoozedUntilUnix = until
+	notification.SnoozeCondition = ""
+	_, err = x.ID(notificationID).Cols("snoozed_until_unix", "snooze_condition").NoAutoTime().Update(notification)
+	return err
+}
+
+// Conditions of the subject of a notification it can be snoozed until, see SnoozeNotificationUntilCondition
+const (
+	NotificationSnoozeUntilPRMergeable = "pr_mergeable"
+	NotificationSnoozeUntilIssueClosed = "issue_closed"
+)
+
+// notificationSnoozedUntilCondition is the snooze time of notifications snoozed until a condition is met
+const notificationSnoozedUntilCondition = timeutil.TimeStamp(math.MaxInt64)
+
+// SnoozeNotificationUntilCondition hides the notification from the unread count until its subject reaches a state,
+// e.g. until a pull request is mergeable. The condition is checked periodically by WakeConditionalSnoozes.
+func SnoozeNotificationUntilCondition(notificationID int64, user *User, condition string) error {
+	notification, err := getOwnedNotification(x, user, notificationID)
+	if err != nil {
+		return err
+	}
+
+	switch condition {
+	case NotificationSnoozeUntilIssueClosed:
+		if notification.Source != NotificationSourceIssue && notification.Source != NotificationSourcePullRequest {
+			return fmt.Errorf("notification %d has no issue to snooze until it is closed", notificationID)
+		}
+	case NotificationSnoozeUntilPRMergeable:
+		if notification.Source != NotificationSourcePullRequest {
+			return fmt.Errorf("notification %d has no pull request to snooze until it is mergeable", notificationID)
+		}
+	default:
+		return fmt.Errorf("unknown snooze condition: %s", condition)
+	}
+
+	notification.SnoozedUntilUnix = notificationSnoozedUntilCondition
+	notification.SnoozeCondition = condition
+	_, err = x.ID(notificationID).Cols("snoozed_until_unix", "snooze_condition").NoAutoTime().Update(notification)
+	return err
+}
+
+// WakeConditionalSnoozes wakes the notifications snoozed until a condition which is met now. Notifications of
+// pull requests snoozed until they are mergeable are woken when they are closed too, as well as notifications
+// whose subject has been deleted. It returns the number of woken notifications.
+func WakeConditionalSnoozes() (int64, error) {
+	var woken, lastID int64
+	for {
+		notifications := make(NotificationList, 0, defaultMaxInSize)
+		if err := x.Where("snooze_condition <> '' AND deleted_unix = 0 AND id > ?", lastID).
+			OrderBy("id").
+			Limit(defaultMaxInSize).
+			Find(&notifications); err != nil {
+			return woken, err
+		}
+		if len(notifications) == 0 {
+			return woken, nil
+		}
+		lastID = notifications[len(notifications)-1].ID
+
+		if err := notifications.LoadIssues(); err != nil {
+			return woken, err
+		}
+		issues := make(IssueList, 0, len(notifications))
+		for _, notification := range notifications {
+			if notification.Issue != nil {
+				issues = append(issues, notification.Issue)
+			}
+		}
+		if err := issues.loadPullRequests(x); err != nil {
+			return woken, err
+		}
+
+		ids := make([]int64, 0, len(notifications))
+		for _, notification := range notifications {
+			if notification.snoozeConditionMet() {
+				ids = append(ids, notification.ID)
+			}
+		}
+		if len(ids) > 0 {
+			n, err := x.In("id", ids).
+				Cols("snoozed_until_unix", "snooze_condition").
+				NoAutoTime().
+				Update(&Notification{})
+			if err != nil {
+				return woken, err
+			}
+			woken += n
+		}
+
+		if len(notifications) < defaultMaxInSize {
+			return woken, nil
+		}
+	}
+}
+
+// snoozeConditionMet returns whether the subject of the notification has reached the state it is snoozed until,
+// its issue and pull request must have been loaded
+func (n *Notification) snoozeConditionMet() bool {
+	if n.Issue == nil {
+		return true
+	}
+	switch n.SnoozeCondition {
+	case NotificationSnoozeUntilIssueClosed:
+		return n.Issue.IsClosed
+	case NotificationSnoozeUntilPRMergeable:
+		return n.Issue.IsClosed || (n.Issue.PullRequest != nil && n.Issue.PullRequest.CanAutoMerge())
+	default:
+		return true
+	}
+}
+
+// WakeNotificationSnoozes periodically wakes the notifications whose snooze condition is met
+func WakeNotificationSnoozes(ctx context.Context) {
+	log.Trace("Doing: WakeNotificationSnoozes")
+
+	if _, err := WakeConditionalSnoozes(); err != nil {
+		log.Error("WakeConditionalSnoozes: %v", err)
+	}
+}
+
+// RedeliverNotification resurfaces the notification immediately: it becomes unread, is moved to the top
+// by bumping its update time and is no longer snoozed
+func RedeliverNotification(notificationID int64, user *User) error {
+	notification, err := getOwnedNotification(x, user, notificationID)
+	if err != nil {
+		return err
+	}
+
+	notification.Status = NotificationStatusUnread
+	notification.UpdatedBy = user.ID
+	notification.SnoozedUntilUnix = 0
+	notification.SnoozeCondition = ""
+	_, err = x.ID(notificationID).Cols("status", "updated_by", "snoozed_until_unix", "snooze_condition", "updated_unix").Update(notification)
+	return err
+}
+
+// MarkIssueNotificationReadForUser marks the notification of the user on the given issue as read.
+// It does nothing if the user has no unread notification for the issue.
+func MarkIssueNotificationReadForUser(userID, issueID int64) error {
+	issue, err := getIssueByID(x, issueID)
+	if err != nil {
+		return err
+	}
+	return setNotificationStatusReadIfUnread(x, userID, issue)
+}
+
+func setNotificationStatusReadIfUnread(e Engine, userID int64, issue *Issue) error {
+	notification, err := getIssueNotification(e, userID, issue.ID, issueNotificationSource(issue))
+	if err != nil {
+		return err
+	}
+
+	// ignore if not exists
+	if notification.ID == 0 || notification.Status != NotificationStatusUnread {
+		return nil
+	}
+
+	notification.Status = NotificationStatusRead
+	notification.Issue = issue
+	if err = notification.markRead(e); err != nil {
+		return err
+	}
+
+	if _, err = e.ID(notification.ID).Update(notification); err != nil {
+		return err
+	}
+	countNotificationsRead(1)
+	return nil
+}
+
+// markRead sets ReadUnix and ReadSubjectState if the notification is not unread,
+// and FirstReadUnix if it is read for the first time
+func (n *Notification) markRead(e Engine) error {
+	if n.Status == NotificationStatusUnread {
+		return nil
+	}
+	n.ReadUnix = timeutil.TimeStampNow()
+	if n.FirstReadUnix == 0 {
+		n.FirstReadUnix = n.ReadUnix
+	}
+
+	if n.IssueID == 0 {
+		return nil
+	}
+	issue := n.Issue
+	if issue == nil {
+		var err error
+		if issue, err = getIssueByID(e, n.IssueID); err != nil {
+			if IsErrIssueNotExist(err) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := issue.loadPullRequest(e); err != nil && !IsErrPullRequestNotExist(err) {
+		return err
+	}
+	n.ReadSubjectState = notificationSubjectState(issue)
+	return nil
+}
+
+// States of the subjects of issue and pull request notifications, see ReadSubjectState
+const (
+	notificationSubjectOpen   = "open"
+	notificationSubjectClosed = "closed"
+	notificationSubjectMerged = "merged"
+)
+
+// notificationSubjectState returns the state of the issue, or an empty string if the pull request
+// of a pull request issue has not been loaded
+func notificationSubjectState(issue *Issue) string {
+	switch {
+	case issue.IsPull && issue.PullRequest == nil:
+		return ""
+	case issue.IsPull && issue.PullRequest.HasMerged:
+		return notificationSubjectMerged
+	case issue.IsClosed:
+		return notificationSubjectClosed
+	default:
+		return notificationSubjectOpen
+	}
+}
+
+// ActionSinceRead returns how the state of the issue or pull request changed since the user read the notification
+// the last time, i.e. "closed", "merged" or "reopened", or an empty string if it did not change. The issue and its
+// pull request must have been loaded.
+func (n *Notification) ActionSinceRead() string {
+	if n.Status == NotificationStatusUnread || n.Issue == nil || len(n.ReadSubjectState) == 0 {
+		return ""
+	}
+	state := notificationSubjectState(n.Issue)
+	if len(state) == 0 || state == n.ReadSubjectState {
+		return ""
+	}
+	if state == notificationSubjectOpen {
+		return NotificationActionReopened
+	}
+	return state
+}
+
+// SetNotificationStatus change the notification status.
+// Setting the status the notification already has is a no-op, so retried requests do not bump it again.
+func SetNotificationStatus(notificationID int64, user *User, status NotificationStatus) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+	if err := setNotificationStatus(sess, notificationID, user, status); err != nil {
+		return err
+	}
+	return sess.Commit()
+}
+
+// setNotificationStatus changes the status of the notification. Reading an unread issue or pull request
+// notification also marks the issue as read by the user in issue_user, which is what the issue lists use to
+// highlight new issues, so the issue is not shown as new after the notification has been read. Both are
+// written with e, which should be a session to keep them consistent.
+func setNotificationStatus(e Engine, notificationID int64, user *User, status NotificationStatus) error {
+	notification, err := getOwnedNotification(e, user, notificationID)
+	if err != nil {
+		return err
+	}
+	if notification.Status == status {
+		return nil
+	}
+
+	wasUnread := notification.Status == NotificationStatusUnread
+	notification.Status = status
+	if err = notification.markRead(e); err != nil {
+		return err
+	}
+
+	sess := e.ID(notificationID)
+	if status != NotificationStatusPinned && len(notification.PinNote) > 0 {
+		// unpinning clears the note
+		notification.PinNote = ""
+		sess.MustCols("pin_note")
+	}
+	if _, err = sess.Update(notification); err != nil {
+		return err
+	}
+	if wasUnread && status != NotificationStatusUnread {
+		if notification.IssueID != 0 {
+			if err = markIssueUserRead(e, user.ID, notification.IssueID); err != nil {
+				return err
+			}
+		}
+		countNotificationsRead(1)
+	}
+	return nil
+}
+
+// ApplyNotificationStatusChanges sets the status of each notification of changes to its desired status in one
+// transaction. All notifications are checked to belong to the user first, if any does not exist or belongs to
+// another user nothing is changed and ErrNotificationNotExist or ErrNotificationForbidden is returned.
+// It returns the number of notifications whose status changed.
+func ApplyNotificationStatusChanges(user *User, changes map[int64]NotificationStatus) (int64, error) {
+	ids := make([]int64, 0, len(changes))
+	for id, status := range changes {
+		if status < NotificationStatusUnread || status > NotificationStatusDone {
+			return 0, fmt.Errorf("invalid status %d of notification %d", status, id)
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	current := make(map[int64]*Notification, len(ids))
+	for start := 0; start < len(ids); start += defaultMaxInSize {
+		end := start + defaultMaxInSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		notifications := make([]*Notification, 0, end-start)
+		if err := sess.In("id", ids[start:end]).And("deleted_unix = 0").Cols("id", "user_id", "status").Find(&notifications); err != nil {
+			return 0, err
+		}
+		for _, notification := range notifications {
+			current[notification.ID] = notification
+		}
+	}
+
+	var affected int64
+	for _, id := range ids {
+		notification, ok := current[id]
+		if !ok {
+			return 0, ErrNotificationNotExist{ID: id}
+		}
+		if notification.UserID != user.ID {
+			return 0, ErrNotificationForbidden{ID: id, UserID: user.ID}
+		}
+		if notification.Status != changes[id] {
+			affected++
+		}
+	}
+
+	for _, id := range ids {
+		if err := setNotificationStatus(sess, id, user, changes[id]); err != nil {
+			return 0, err
+		}
+	}
+
+	return affected, sess.Commit()
+}
+
+// maxNotificationPinNoteLength is the maximum number of characters of the note of a pinned notification
+const maxNotificationPinNoteLength = 255
+
+// sanitizeNotificationText turns the text into a single line without control characters
+// and truncates it to maxLength characters
+func sanitizeNotificationText(text string, maxLength int) string {
+	text = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text))
+	if runes := []rune(text); len(runes) > maxLength {
+		text = strings.TrimSpace(string(runes[:maxLength]))
+	}
+	return text
+}
+
+// PinNotification pins the notification of the user with an optional note, e.g. why it needs a follow-up.
+// The note is sanitized and truncated to maxNotificationPinNoteLength characters.
+func PinNotification(notificationID int64, user *User, note string) error {
+	notification, err := getOwnedNotification(x, user, notificationID)
+	if err != nil {
+		return err
+	}
+
+	wasUnread := notification.Status == NotificationStatusUnread
+	notification.Status = NotificationStatusPinned
+	notification.PinNote = sanitizeNotificationText(note, maxNotificationPinNoteLength)
+	if err = notification.markRead(x); err != nil {
+		return err
+	}
+
+	if _, err = x.ID(notificationID).MustCols("pin_note").Update(notification); err != nil {
+		return err
+	}
+	if wasUnread {
+		countNotificationsRead(1)
+	}
+	return nil
+}
+
+// OpenNotification returns the notification of the user with its attributes loaded, marking it as read
+// in the same transaction if it is unread. Pinned notifications stay pinned.
+// The first opening is recorded in OpenedUnix.
+func OpenNotification(user *User, notificationID int64) (*Notification, error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return nil, err
+	}
+
+	notification, err := getOwnedNotification(sess, user, notificationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if notification.Status == NotificationStatusUnread {
+		notification.Status = NotificationStatusRead
+		if err = notification.markRead(sess); err != nil {
+			return nil, err
+		}
+		if _, err = sess.ID(notification.ID).Cols("status", "read_unix", "first_read_unix", "read_subject_state").Update(notification); err != nil {
+			return nil, err
+		}
+		countNotificationsRead(1)
+	}
+
+	if notification.OpenedUnix == 0 {
+		notification.OpenedUnix = timeutil.TimeStampNow()
+		if _, err = sess.ID(notification.ID).Cols("opened_unix").NoAutoTime().Update(notification); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = notification.loadAttributes(sess); err != nil {
+		return nil, err
+	}
+
+	return notification, sess.Commit()
+}
+
+// GetNotificationFunnelStats returns how many notifications have been created since the given time,
+// and how many of them have been read and opened at least once
+func GetNotificationFunnelStats(since timeutil.TimeStamp) (created, read, opened int64, err error) {
+	stats := struct {
+		CreatedCount int64
+		ReadCount    int64
+		OpenedCount  int64
+	}{}
+	if _, err = x.Table("notification").
+		Select("COUNT(*) AS created_count, "+
+			"COALESCE(SUM(CASE WHEN first_read_unix > 0 THEN 1 ELSE 0 END), 0) AS read_count, "+
+			"COALESCE(SUM(CASE WHEN opened_unix > 0 THEN 1 ELSE 0 END), 0) AS opened_count").
+		Where("created_unix >= ?", since).
+		And("deleted_unix = 0").
+		Get(&stats); err != nil {
+		return 0, 0, 0, err
+	}
+	return stats.CreatedCount, stats.ReadCount, stats.OpenedCount, nil
+}
+
+// GetNotificationDailyCounts returns the number of notifications the user received per day (UTC, formatted as
+// 2006-01-02) between sinceUnix (inclusive) and untilUnix (exclusive). Days without notifications are absent.
+func GetNotificationDailyCounts(user *User, sinceUnix, untilUnix int64) (map[string]int64, error) {
+	var groupBy string
+	var groupByName = "day" // mssql doesn't allow grouping by alias
+	switch {
+	case setting.Database.UseSQLite3:
+		groupBy = "strftime('%s', strftime('%Y-%m-%d', created_unix, 'unixepoch'))"
+	case setting.Database.UseMySQL:
+		groupBy = "UNIX_TIMESTAMP(DATE(FROM_UNIXTIME(created_unix)))"
+	case setting.Database.UsePostgreSQL:
+		groupBy = "extract(epoch from date_trunc('day', to_timestamp(created_unix)))"
+	case setting.Database.UseMSSQL:
+		groupBy = "datediff(SECOND, '19700101', dateadd(DAY, 0, datediff(day, 0, dateadd(s, created_unix, '19700101'))))"
+		groupByName = groupBy
+	}
+
+	rows := make([]struct {
+		Day   int64
+		Count int64
+	}, 0, 31)
+	if err := x.Select(groupBy+" AS day, COUNT(*) AS count").
+		Table("notification").
+		Where("user_id = ?", user.ID).
+		And("deleted_unix = 0").
+		And("created_unix >= ?", sinceUnix).
+		And("created_unix < ?", untilUnix).
+		GroupBy(groupByName).
+		Find(&rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[time.Unix(row.Day, 0).UTC().Format("2006-01-02")] += row.Count
+	}
+	return counts, nil
+}
+
+// SetNotificationStatusAndCount changes the notification status and returns the remaining effective unread count
+// of the user, see GetEffectiveUnreadCount
+func SetNotificationStatusAndCount(notificationID int64, user *User, status NotificationStatus) (int64, error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	if err := setNotificationStatus(sess, notificationID, user, status); err != nil {
+		return 0, err
+	}
+
+	count, err := getEffectiveUnreadCount(sess, user)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, sess.Commit()
+}
+
+// GetNotificationByID return notification by ID
+func GetNotificationByID(notificationID int64) (*Notification, error) {
+	return getNotificationByID(x, notificationID)
+}
+
+func getNotificationByID(e Engine, notificationID int64) (*Notification, error) {
+	notification := new(Notification)
+	ok, err := e.
+		Where("id = ?", notificationID).
+		And("deleted_unix = 0").
+		Get(notification)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrNotificationNotExist{ID: notificationID}
+	}
+
+	return notification, nil
+}
+
+// GetOwnedNotification returns the notification with the given ID if it belongs to the user.
+// It returns ErrNotificationNotExist if there is no such notification and ErrNotificationForbidden
+// if it belongs to another user.
+func GetOwnedNotification(user *User, notificationID int64) (*Notification, error) {
+	return getOwnedNotification(x, user, notificationID)
+}
+
+func getOwnedNotification(e Engine, user *User, notificationID int64) (*Notification, error) {
+	notification, err := getNotificationByID(e, notificationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if notification.UserID != user.ID {
+		return nil, ErrNotificationForbidden{ID: notificationID, UserID: user.ID}
+	}
+	return notification, nil
+}
+
+// notificationThreadContextComments is the number of latest comments included in a NotificationThreadContext
+const notificationThreadContextComments = 5
+
+// NotificationThreadContext bundles a notification with the subject it refers to, so the thread can be
+// previewed without navigating to it. Which fields are set depends on the source of the notification:
+// issue and pull request notifications have an Issue, commit notifications a CommitID, and system
+// notifications only the Notification itself.
+type NotificationThreadContext struct {
+	Notification *Notification
+	// Reason is why the user received the notification
+	Reason     string
+	Repository *Repository
+	Issue      *Issue
+	CommitID   string
+	// Comments are the latest comments of the issue, or the comment of the commit notification, oldest first
+	Comments CommentList
+}
+
+// GetNotificationThreadContext returns the notification of the user with the given id together with its subject
+func GetNotificationThreadContext(user *User, notificationID int64) (*NotificationThreadContext, error) {
+	return getNotificationThreadContext(x, user, notificationID)
+}
+
+func getNotificationThreadContext(e Engine, user *User, notificationID int64) (*NotificationThreadContext, error) {
+	notification, err := getOwnedNotification(e, user, notificationID)
+	if err != nil {
+		return nil, err
+	}
+	notification.User = user
+
+	ctx := &NotificationThreadContext{
+		Notification: notification,
+		Reason:       notification.Reason,
+	}
+	if notification.Source == NotificationSourceSystem {
+		return ctx, nil
+	}
+
+	if err = notification.loadRepo(e); err != nil {
+		return nil, err
+	}
+	ctx.Repository = notification.Repository
+
+	switch notification.Source {
+	case NotificationSourceIssue, NotificationSourcePullRequest:
+		// only the issue itself is loaded, its other attributes are not needed for a preview
+		if notification.Issue, err = getIssueByID(e, notification.IssueID); err != nil {
+			return nil, err
+		}
+		notification.Issue.Repo = notification.Repository
+		ctx.Issue = notification.Issue
+
+		comments := make(CommentList, 0, notificationThreadContextComments)
+		if err = e.Where("issue_id = ? AND type = ?", notification.IssueID, CommentTypeComment).
+			Desc("created_unix", "id").
+			Limit(notificationThreadContextComments).
+			Find(&comments); err != nil {
+			return nil, err
+		}
+		for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+			comments[i], comments[j] = comments[j], comments[i]
+		}
+		ctx.Comments = comments
+	case NotificationSourceCommit:
+		ctx.CommitID = notification.CommitID
+		if notification.CommentID > 0 {
+			comment := new(Comment)
+			has, err := e.ID(notification.CommentID).Get(comment)
+			if err != nil {
+				return nil, err
+			} else if has {
+				ctx.Comments = CommentList{comment}
+			}
+		}
+	}
+
+	if err = ctx.Comments.loadPosters(e); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// UpdateNotificationStatuses updates the statuses of all of a user's notifications that are of the currentStatus type to the desiredStatus
+func UpdateNotificationStatuses(user *User, currentStatus NotificationStatus, desiredStatus NotificationStatus) error {
+	if desiredStatus != NotificationStatusUnread {
+		if err := markNotificationsRead(x, builder.Eq{"user_id": user.ID, "status": currentStatus, "deleted_unix": 0}); err != nil {
+			return err
+		}
+	}
+
+	cols := []string{"status", "updated_by", "updated_unix"}
+	if currentStatus == NotificationStatusPinned && desiredStatus != NotificationStatusPinned {
+		// unpinning clears the notes
+		cols = append(cols, "pin_note")
+	}
+
+	n := &Notification{Status: desiredStatus, UpdatedBy: user.ID}
+	_, err := x.
+		Where("user_id = ? AND status = ? AND deleted_unix = 0", user.ID, currentStatus).
+		Cols(cols...).
+		Update(n)
+	return err
+}
+
+// ReassignNotifications moves all notifications of a user to another one, e.g. when merging two accounts.
+// If both users had a notification for the same issue and source only the most recent one is kept,
+// soft deleted notifications are left as they are. It returns the number of reassigned notifications.
+func ReassignNotifications(fromUserID, toUserID int64) (int64, error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	affected, err := sess.
+		Where("user_id = ?", fromUserID).
+		Cols("user_id").
+		NoAutoTime().
+		Update(&Notification{UserID: toUserID})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = sess.
+		Where("updated_by = ?", fromUserID).
+		Cols("updated_by").
+		NoAutoTime().
+		Update(&Notification{UpdatedBy: toUserID}); err != nil {
+		return 0, err
+	}
+
+	notifications := make([]*Notification, 0, affected)
+	if err = sess.
+		Where("user_id = ? AND issue_id > 0", toUserID).
+		And("deleted_unix = 0").
+		OrderBy("updated_unix DESC, id DESC").
+		Find(&notifications); err != nil {
+		return 0, err
+	}
+
+	type thread struct {
+		issueID int64
+		source  NotificationSource
+	}
+	seen := make(map[thread]struct{}, len(notifications))
+	duplicateIDs := make([]int64, 0, 10)
+	for _, notification := range notifications {
+		key := thread{notification.IssueID, notification.Source}
+		if _, ok := seen[key]; ok {
+			duplicateIDs = append(duplicateIDs, notification.ID)
+			continue
+		}
+		seen[key] = struct{}{}
+	}
+
+	if len(duplicateIDs) > 0 {
+		if err = deleteNotificationTags(sess, builder.In("id", duplicateIDs)); err != nil {
+			return 0, err
+		}
+		if err = deleteTeamNotifications(sess, builder.In("id", duplicateIDs)); err != nil {
+			return 0, err
+		}
+		deleted, err := sess.In("id", duplicateIDs).Delete(new(Notification))
+		if err != nil {
+			return 0, err
+		}
+		countNotificationsDeleted(deleted)
+	}
+
+	return affected, sess.Commit()
+}
+
+// MarkAllReadKeepPinned marks all notifications of the user as read except the pinned ones,
+// which stay pinned until the user explicitly changes them.
+// It returns the number of notifications marked as read.
+func MarkAllReadKeepPinned(user *User) (int64, error) {
+	cond := builder.Eq{"user_id": user.ID, "deleted_unix": 0}.
+		And(builder.NotIn("status", NotificationStatusRead, NotificationStatusPinned, NotificationStatusDone))
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	if err := markNotificationsRead(sess, cond); err != nil {
+		return 0, err
+	}
+
+	affected, err := sess.
+		Where(cond).
+		Cols("status", "updated_by", "updated_unix").
+		Update(&Notification{Status: NotificationStatusRead, UpdatedBy: user.ID})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, sess.Commit()
+}
+
+// markAllReadUndoWindow is how long the notifications marked as read by MarkAllReadWithUndo can be restored
+var markAllReadUndoWindow = 5 * time.Minute
+
+// markAllReadUndoStore keeps the notifications flipped by MarkAllReadWithUndo in memory until their token expires.
+// It is not persisted, so the undo tokens are lost when the server restarts.
+type markAllReadUndoStore struct {
+	lock    sync.Mutex
+	entries map[string]*markAllReadUndoEntry
+}
+
+type markAllReadUndoEntry struct {
+	userID  int64
+	expires time.Time
+	// ids are the notifications which were unread, neverReadIDs the ones of them which had never been read before
+	ids          []int64
+	neverReadIDs []int64
+}
+
+var notificationUndoStore = &markAllReadUndoStore{entries: make(map[string]*markAllReadUndoEntry)}
+
+// add stores the entry under a new random token and drops the expired entries
+func (s *markAllReadUndoStore) add(entry *markAllReadUndoEntry, now time.Time) (string, error) {
+	token, err := generate.GetRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for t, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, t)
+		}
+	}
+	s.entries[token] = entry
+	return token, nil
+}
+
+// take removes the entry of the token and returns it, or nil if it is unknown or expired
+func (s *markAllReadUndoStore) take(token string, now time.Time) *markAllReadUndoEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, ok := s.entries[token]
+	if !ok {
+		return nil
+	}
+	delete(s.entries, token)
+	if !now.Before(entry.expires) {
+		return nil
+	}
+	return entry
+}
+
+// MarkAllReadWithUndo marks all unread notifications of the user as read like MarkAllReadKeepPinned. It returns
+// a token which restores exactly these notifications to unread with UndoMarkAllRead for markAllReadUndoWindow,
+// and the number of notifications marked as read. No token is returned if there was no unread notification.
+func MarkAllReadWithUndo(user *User) (undoToken string, affected int64, err error) {
+	cond := builder.Eq{"user_id": user.ID, "status": NotificationStatusUnread, "deleted_unix": 0}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return "", 0, err
+	}
+
+	unread := make([]*Notification, 0, 10)
+	if err = sess.Where(cond).Cols("id", "first_read_unix").Find(&unread); err != nil {
+		return "", 0, err
+	}
+	if len(unread) == 0 {
+		return "", 0, sess.Commit()
+	}
+
+	entry := &markAllReadUndoEntry{
+		userID: user.ID,
+		ids:    make([]int64, 0, len(unread)),
+	}
+	for _, notification := range unread {
+		entry.ids = append(entry.ids, notification.ID)
+		if notification.FirstReadUnix == 0 {
+			entry.neverReadIDs = append(entry.neverReadIDs, notification.ID)
+		}
+	}
+
+	// only the notifications which have been selected are flipped, so the token restores exactly them
+	for start := 0; start < len(entry.ids); start += defaultMaxInSize {
+		end := start + defaultMaxInSize
+		if end > len(entry.ids) {
+			end = len(entry.ids)
+		}
+		chunkCond := cond.And(builder.In("id", entry.ids[start:end]))
+		if err = markNotificationsRead(sess, chunkCond); err != nil {
+			return "", 0, err
+		}
+		var n int64
+		if n, err = sess.
+			Where(chunkCond).
+			Cols("status", "updated_by", "updated_unix").
+			Update(&Notification{Status: NotificationStatusRead, UpdatedBy: user.ID}); err != nil {
+			return "", 0, err
+		}
+		affected += n
+	}
+
+	if err = sess.Commit(); err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	entry.expires = now.Add(markAllReadUndoWindow)
+	if undoToken, err = notificationUndoStore.add(entry, now); err != nil {
+		return "", 0, err
+	}
+	return undoToken, affected, nil
+}
+
+// UndoMarkAllRead restores the notifications marked as read by MarkAllReadWithUndo to unread. Notifications whose
+// status has been changed again since then are kept. A token can only be used once, it returns
+// ErrNotificationUndoTokenNotExist if the token is unknown, has been used or has expired.
+func UndoMarkAllRead(undoToken string) error {
+	entry := notificationUndoStore.take(undoToken, time.Now())
+	if entry == nil {
+		return ErrNotificationUndoTokenNotExist{Token: undoToken}
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(entry.ids); start += defaultMaxInSize {
+		end := start + defaultMaxInSize
+		if end > len(entry.ids) {
+			end = len(entry.ids)
+		}
+		if _, err := sess.
+			Where(builder.Eq{"user_id": entry.userID, "status": NotificationStatusRead}).
+			In("id", entry.ids[start:end]).
+			Cols("status", "updated_by", "updated_unix").
+			Update(&Notification{Status: NotificationStatusUnread, UpdatedBy: entry.userID}); err != nil {
+			return err
+		}
+	}
+	for start := 0; start < len(entry.neverReadIDs); start += defaultMaxInSize {
+		end := start + defaultMaxInSize
+		if end > len(entry.neverReadIDs) {
+			end = len(entry.neverReadIDs)
+		}
+		if _, err := sess.
+			Where(builder.Eq{"user_id": entry.userID, "status": NotificationStatusUnread}).
+			In("id", entry.neverReadIDs[start:end]).
+			Cols("first_read_unix", "read_unix", "read_subject_state").
+			NoAutoTime().
+			Update(&Notification{}); err != nil {
+			return err
+		}
+	}
+
+	return sess.Commit()
+}
+
+// SetNotificationsDoneBySource marks all unread and read notifications of the user from the given source as done.
+// Pinned notifications are kept. It returns the number of notifications marked as done.
+func SetNotificationsDoneBySource(user *User, source NotificationSource) (int64, error) {
+	cond := builder.Eq{
+		"user_id":      user.ID,
+		"source":       source,
+		"deleted_unix": 0,
+	}.And(builder.In("status", NotificationStatusUnread, NotificationStatusRead))
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	if err := markNotificationsRead(sess, cond); err != nil {
+		return 0, err
+	}
+
+	affected, err := sess.
+		Where(cond).
+		Cols("status", "updated_by", "updated_unix").
+		Update(&Notification{Status: NotificationStatusDone, UpdatedBy: user.ID})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, sess.Commit()
+}
+
+// markNotificationsRead sets ReadSubjectState of the notifications matching cond, ReadUnix of the unread ones
+// and FirstReadUnix of the unread ones which have never been read. It must be called before their status changes.
+func markNotificationsRead(e Engine, cond builder.Cond) error {
+	if err := markNotificationsReadSubjectState(e, cond); err != nil {
+		return err
+	}
+
+	// only the transition from unread to read is stamped and counted
+	cond = cond.And(builder.Eq{"status": NotificationStatusUnread})
+	now := timeutil.TimeStampNow()
+	read, err := e.
+		Where(cond).
+		Cols("read_unix").
+		NoAutoTime().
+		Update(&Notification{ReadUnix: now})
+	if err != nil {
+		return err
+	}
+	countNotificationsRead(read)
+	_, err = e.
+		Where(cond.And(builder.Eq{"first_read_unix": 0})).
+		Cols("first_read_unix").
+		NoAutoTime().
+		Update(&Notification{FirstReadUnix: now})
+	return err
+}
+
+// markNotificationsReadSubjectState sets ReadSubjectState of the notifications matching cond
+// to the current state of their issues
+func markNotificationsReadSubjectState(e Engine, cond builder.Cond) error {
+	issueIDs := make([]int64, 0, 10)
+	if err := e.Table("notification").
+		Where(cond).
+		And("issue_id > 0").
+		Distinct("issue_id").
+		Find(&issueIDs); err != nil {
+		return err
+	}
+
+	for len(issueIDs) > 0 {
+		limit := defaultMaxInSize
+		if len(issueIDs) < limit {
+			limit = len(issueIDs)
+		}
+		chunk := issueIDs[:limit]
+		issueIDs = issueIDs[limit:]
+
+		closedIDs := make([]int64, 0, limit)
+		if err := e.Table("issue").
+			In("id", chunk).
+			And("is_closed = ?", true).
+			Cols("id").
+			Find(&closedIDs); err != nil {
+			return err
+		}
+		mergedIDs := make([]int64, 0, limit)
+		if err := e.Table("pull_request").
+			In("issue_id", chunk).
+			And("has_merged = ?", true).
+			Cols("issue_id").
+			Find(&mergedIDs); err != nil {
+			return err
+		}
+
+		// merged pull requests are closed too, so their state is set last
+		states := []struct {
+			state    string
+			issueIDs []int64
+		}{
+			{notificationSubjectOpen, chunk},
+			{notificationSubjectClosed, closedIDs},
+			{notificationSubjectMerged, mergedIDs},
+		}
+		for _, s := range states {
+			if len(s.issueIDs) == 0 {
+				continue
+			}
+			if _, err := e.
+				Where(cond).
+				In("issue_id", s.issueIDs).
+				Cols("read_subject_state").
+				NoAutoTime().
+				Update(&Notification{ReadSubjectState: s.state}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetNotificationsReadByLabel marks all unread notifications of the user on issues with the given label as read.
+// It returns the number of notifications marked as read.
+func SetNotificationsReadByLabel(user *User, labelID int64) (int64, error) {
+	cond := builder.Eq{
+		"user_id":      user.ID,
+		"status":       NotificationStatusUnread,
+		"deleted_unix": 0,
+	}.And(
+		builder.In("source", NotificationSourceIssue, NotificationSourcePullRequest),
+		builder.In("issue_id", builder.Select("issue_id").From("issue_label").Where(builder.Eq{"label_id": labelID})),
+	)
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	if err := markNotificationsRead(sess, cond); err != nil {
+		return 0, err
+	}
+
+	affected, err := sess.
+		Where(cond).
+		Cols("status", "updated_by", "updated_unix").
+		Update(&Notification{Status: NotificationStatusRead, UpdatedBy: user.ID})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, sess.Commit()
+}
+
+// BroadcastSystemNotification creates a system notification with the given title and url for every active user.
+// The notifications are inserted in batches, it returns the number of created notifications.
+// Nothing is created while the creation of notifications is paused. The title is truncated to 255 characters.
+func BroadcastSystemNotification(title, url string, authorID int64) (int64, error) {
+	if IsNotificationCreationPaused() {
+		log.Warn("Notification creation is paused, dropping system notification %q", title)
+		return 0, nil
+	}
+
+	// the title is kept as the title of the subject, which is limited to 255 characters
+	title = sanitizeNotificationText(title, 255)
+
+	var total int64
+	var lastID int64
+	for {
+		userIDs := make([]int64, 0, setting.Database.IterateBufferSize)
+		if err := x.Table("user").
+			Where("id > ? AND `type` = ? AND is_active = ?", lastID, UserTypeIndividual, true).
+			OrderBy("id").
+			Limit(setting.Database.IterateBufferSize).
+			Cols("id").
+			Find(&userIDs); err != nil {
+			return total, err
+		}
+		if len(userIDs) == 0 {
+			return total, nil
+		}
+
+		notifications := make([]*Notification, 0, len(userIDs))
+		for _, userID := range userIDs {
+			notifications = append(notifications, &Notification{
+				UserID:       userID,
+				Status:       NotificationStatusUnread,
+				Source:       NotificationSourceSystem,
+				SubjectTitle: title,
+				SubjectURL:   url,
+				UpdatedBy:    authorID,
+			})
+		}
+		if _, err := x.Insert(&notifications); err != nil {
+			return total, err
+		}
+		countNotificationsCreated(int64(len(notifications)))
+
+		total += int64(len(notifications))
+		lastID = userIDs[len(userIDs)-1]
+	}
+}
+
+// CreateMirrorFailureNotification notifies the admins of the mirror repository about a failed sync. The users
+// of adminIDs who are no admins of the repository are skipped. Repeated failures do not create new notifications
+// but bump the existing notification of each admin back to unread with the reason of the latest failure.
+// The reason is kept as SubjectTitle since it may not fit into the action.
+func CreateMirrorFailureNotification(repoID int64, adminIDs []int64, reason string) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	repo, err := getRepositoryByID(sess, repoID)
+	if err != nil {
+		return err
+	}
+
+	// the reason is kept as the title of the subject, which is limited to 255 characters
+	reason = sanitizeNotificationText(reason, 255)
+	for _, adminID := range adminIDs {
+		admin, err := getUserByID(sess, adminID)
+		if err != nil {
+			if IsErrUserNotExist(err) {
+				continue
+			}
+			return err
+		}
+		perm, err := getUserRepoPermission(sess, repo, admin)
+		if err != nil {
+			return err
+		}
+		if !perm.IsAdmin() {
+			continue
+		}
+
+		notification := new(Notification)
+		has, err := sess.
+			Where("user_id = ?", adminID).
+			And("repo_id = ?", repoID).
+			And("source = ?", NotificationSourceRepository).
+			And("action = ?", NotificationActionMirrorFailed).
+			And("deleted_unix = 0").
+			Get(notification)
+		if err != nil {
+			return err
+		}
+
+		if has {
+			notification.SubjectTitle = reason
+			cols := []string{"subject_title", "updated_unix"}
+			if notification.Status != NotificationStatusPinned {
+				notification.Status = NotificationStatusUnread
+				cols = append(cols, "status")
+			}
+			if _, err = sess.ID(notification.ID).Cols(cols...).Update(notification); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = createNotification(sess, &Notification{
+			UserID:       adminID,
+			RepoID:       repoID,
+			Status:       NotificationStatusUnread,
+			Source:       NotificationSourceRepository,
+			Action:       NotificationActionMirrorFailed,
+			SubjectTitle: reason,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return sess.Commit()
+}
+
+// CreateOrUpdateCommitNotifications creates a commit notification for each watcher of the repository
+// and each user who subscribed to the commit, or updates it if it already exists
+func CreateOrUpdateCommitNotifications(repoID int64, commitID string, commentID, notificationAuthorID int64) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	if err := createOrUpdateCommitNotifications(sess, repoID, commitID, commentID, notificationAuthorID); err != nil {
+		return err
+	}
+
+	return sess.Commit()
+}
+
+func createOrUpdateCommitNotifications(e Engine, repoID int64, commitID string, commentID, notificationAuthorID int64) error {
+	repo, err := getRepositoryByID(e, repoID)
+	if err != nil {
+		return err
+	}
+
+	commitWatches, err := getCommitWatchers(e, repoID, commitID)
+	if err != nil {
+		return err
+	}
+
+	watches, err := getWatchers(e, repoID)
+	if err != nil {
+		return err
+	}
+
+	notifications := make([]*Notification, 0, len(commitWatches)+len(watches))
+	if err = e.Where("repo_id = ?", repoID).
+		And("commit_id = ?", commitID).
+		And("source = ?", NotificationSourceCommit).
+		And("deleted_unix = 0").
+		Find(&notifications); err != nil {
+		return err
+	}
+	existing := make(map[int64]*Notification, len(notifications))
+	for _, notification := range notifications {
+		existing[notification.UserID] = notification
+	}
+
+	alreadyNotified := make(map[int64]struct{}, len(commitWatches)+len(watches))
+
+	notifyUser := func(userID int64) error {
+		// do not send notification for the own commenter
+		if userID == notificationAuthorID {
+			return nil
+		}
+
+		if _, ok := alreadyNotified[userID]; ok {
+			return nil
+		}
+		alreadyNotified[userID] = struct{}{}
+
+		repo.Units = nil
+		if !repo.checkUnitUser(e, userID, false, UnitTypeCode) {
+			return nil
+		}
+
+		if notification, ok := existing[userID]; ok {
+			notification.UpdatedBy = notificationAuthorID
+			notification.Reason = NotificationReasonSubscribed
+			notification.Action = NotificationActionCommented
+			cols := []string{"updated_by", "reason", "action"}
+			if notification.Status == NotificationStatusRead || notification.Status == NotificationStatusDone {
+				notification.Status = NotificationStatusUnread
+				notification.CommentID = commentID
+				cols = append(cols, "status", "comment_id")
+			}
+			_, err := e.ID(notification.ID).Cols(cols...).Update(notification)
+			return err
+		}
+
+		return createNotification(e, &Notification{
+			UserID:    userID,
+			RepoID:    repoID,
+			Status:    NotificationStatusUnread,
+			Source:    NotificationSourceCommit,
+			CommitID:  commitID,
+			CommentID: commentID,
+			UpdatedBy: notificationAuthorID,
+			Reason:    NotificationReasonSubscribed,
+			Action:    NotificationActionCommented,
+		})
+	}
+
+	for _, commitWatch := range commitWatches {
+		if err := notifyUser(commitWatch.UserID); err != nil {
+			return err
+		}
+	}
+
+	for _, watch := range watches {
+		if err := notifyUser(watch.UserID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushNotificationAction returns the action of a push notification, which includes the number of pushed commits
+func pushNotificationAction(count int) string {
+	return NotificationActionPushed + ":" + strconv.Itoa(count)
+}
+
+// PushedCommits returns the number of commits of a push notification created by CreatePushNotifications,
+// or 0 if the notification is not about a push
+func (n *Notification) PushedCommits() int {
+	if n.Source != NotificationSourceCommit || !strings.HasPrefix(n.Action, NotificationActionPushed+":") {
+		return 0
+	}
+	count, err := strconv.Atoi(strings.TrimPrefix(n.Action, NotificationActionPushed+":"))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// CreatePushNotifications creates a single commit notification per watcher of the repository and subscriber
+// of one of the commits for a push, instead of one notification per commit. The commit IDs are expected newest
+// first, the notification refers to the newest commit and records the number of commits in its action.
+// If a user already has a notification of one of the pushed commits, that thread is bumped instead.
+func CreatePushNotifications(repoID int64, commitIDs []string, pusherID int64) error {
+	if len(commitIDs) == 0 {
+		return nil
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	repo, err := getRepositoryByID(sess, repoID)
+	if err != nil {
+		return err
+	}
+
+	commitWatches := make([]*CommitWatch, 0, 10)
+	if err = sess.
+		Where("repo_id = ?", repoID).
+		In("commit_id", commitIDs).
+		Find(&commitWatches); err != nil {
+		return err
+	}
+
+	watches, err := getWatchers(sess, repoID)
+	if err != nil {
+		return err
+	}
+
+	notifications := make([]*Notification, 0, len(commitWatches)+len(watches))
+	if err = sess.
+		Where("repo_id = ?", repoID).
+		And("source = ?", NotificationSourceCommit).
+		And("deleted_unix = 0").
+		In("commit_id", commitIDs).
+		OrderBy("updated_unix DESC, id DESC").
+		Find(&notifications); err != nil {
+		return err
+	}
+	existing := make(map[int64]*Notification, len(notifications))
+	for _, notification := range notifications {
+		if _, ok := existing[notification.UserID]; !ok {
+			existing[notification.UserID] = notification
+		}
+	}
+
+	userIDs := make([]int64, 0, len(commitWatches)+len(watches))
+	for _, commitWatch := range commitWatches {
+		userIDs = append(userIDs, commitWatch.UserID)
+	}
+	for _, watch := range watches {
+		userIDs = append(userIDs, watch.UserID)
+	}
+
+	alreadyNotified := make(map[int64]struct{}, len(userIDs))
+	for _, userID := range userIDs {
+		// do not send notification for the own pusher
+		if userID == pusherID {
+			continue
+		}
+		if _, ok := alreadyNotified[userID]; ok {
+			continue
+		}
+		alreadyNotified[userID] = struct{}{}
+
+		repo.Units = nil
+		if !repo.checkUnitUser(sess, userID, false, UnitTypeCode) {
+			continue
+		}
+
+		if notification, ok := existing[userID]; ok {
+			notification.CommitID = commitIDs[0]
+			notification.UpdatedBy = pusherID
+			notification.Reason = NotificationReasonSubscribed
+			notification.Action = pushNotificationAction(len(commitIDs))
+			cols := []string{"commit_id", "updated_by", "reason", "action"}
+			if notification.Status != NotificationStatusPinned {
+				notification.Status = NotificationStatusUnread
+				cols = append(cols, "status")
+			}
+			if _, err = sess.ID(notification.ID).Cols(cols...).Update(notification); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = createNotification(sess, &Notification{
+			UserID:    userID,
+			RepoID:    repoID,
+			Status:    NotificationStatusUnread,
+			Source:    NotificationSourceCommit,
+			CommitID:  commitIDs[0],
+			UpdatedBy: pusherID,
+			Reason:    NotificationReasonSubscribed,
+			Action:    pushNotificationAction(len(commitIDs)),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return sess.Commit()
+}
+
+// CreatePRPushNotification notifies the reviewers of a pull request about new commits pushed by its author.
+// Existing notifications of the reviewers are bumped instead of creating new ones.
+func CreatePRPushNotification(prIssueID, authorID int64, reviewerIDs []int64) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	issue, err := getIssueByID(sess, prIssueID)
+	if err != nil {
+		return err
+	}
+	if !issue.IsPull {
+		return fmt.Errorf("issue %d is not a pull request", prIssueID)
+	}
+
+	notifications, err := getNotificationsByIssueID(sess, prIssueID)
+	if err != nil {
+		return err
+	}
+
+	alreadyNotified := make(map[int64]struct{}, len(reviewerIDs))
+	for _, reviewerID := range reviewerIDs {
+		if reviewerID == authorID {
+			continue
+		}
+		if _, ok := alreadyNotified[reviewerID]; ok {
+			continue
+		}
+		alreadyNotified[reviewerID] = struct{}{}
+
+		if notificationExists(notifications, issue.ID, reviewerID, NotificationSourcePullRequest) {
+			err = updateIssueNotification(sess, reviewerID, issue, 0, authorID, NotificationReasonPush, NotificationActionPushed)
+		} else {
+			err = createIssueNotification(sess, reviewerID, issue, 0, authorID, NotificationStatusUnread, NotificationReasonPush, NotificationActionPushed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return sess.Commit()
+}
+
+// CreateReactionNotification notifies the author of a comment that somebody reacted to it.
+// Reactions are coalesced: if the comment author already has a notification for the issue it is
+// bumped instead of creating a new one. Reactions to the own comments are ignored.
+func CreateReactionNotification(issueID, commentID, authorID, commentAuthorID int64) error {
+	if authorID == commentAuthorID {
+		return nil
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	issue, err := getIssueByID(sess, issueID)
+	if err != nil {
+		return err
+	}
+
+	notifications, err := getNotificationsByIssueID(sess, issueID)
+	if err != nil {
+		return err
+	}
+
+	if notificationExists(notifications, issue.ID, commentAuthorID, issueNotificationSource(issue)) {
+		err = updateIssueNotification(sess, commentAuthorID, issue, commentID, authorID, NotificationReasonReaction, NotificationActionReacted)
+	} else {
+		err = createIssueNotification(sess, commentAuthorID, issue, commentID, authorID, NotificationStatusUnread, NotificationReasonReaction, NotificationActionReacted)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sess.Commit()
+}
+
+// CreateMentionNotifications notifies the users mentioned in an issue or comment, whether they watch the issue or not.
+// Existing notifications of the issue are bumped with the mention reason. The author and the mentioned users who
+// can not read the issue are skipped.
+func CreateMentionNotifications(issueID, commentID, authorID int64, mentionedIDs []int64) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	issue, err := getIssueByID(sess, issueID)
+	if err != nil {
+		return err
+	}
+	if err = issue.loadRepo(sess); err != nil {
+		return err
+	}
+
+	notifications, err := getNotificationsByIssueID(sess, issueID)
+	if err != nil {
+		return err
+	}
+
+	unitType := UnitTypeIssues
+	if issue.IsPull {
+		unitType = UnitTypePullRequests
+	}
+	notified := make(map[int64]bool, len(mentionedIDs))
+	for _, userID := range mentionedIDs {
+		if userID == authorID || notified[userID] {
+			continue
+		}
+		notified[userID] = true
+
+		issue.Repo.Units = nil
+		if !issue.Repo.checkUnitUser(sess, userID, false, unitType) {
+			continue
+		}
+
+		if notificationExists(notifications, issue.ID, userID, issueNotificationSource(issue)) {
+			err = updateIssueNotification(sess, userID, issue, commentID, authorID, NotificationReasonMention, NotificationActionCommented)
+		} else {
+			err = createIssueNotification(sess, userID, issue, commentID, authorID, NotificationStatusUnread, NotificationReasonMention, NotificationActionCommented)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return sess.Commit()
+}
+
+// GetMentionOnlyNotifications returns the notifications of the user created because of a mention in an issue
+// the user does not watch, neither directly nor through its repository. The UserID of the options is ignored.
+func GetMentionOnlyNotifications(user *User, opts FindNotificationOptions) (NotificationList, error) {
+	opts.UserID = user.ID
+
+	nl := make(NotificationList, 0, 10)
+	return nl, opts.ToSession(x).
+		And(builder.Eq{"notification.reason": NotificationReasonMention}).
+		And(builder.NotIn("notification.issue_id", builder.Select("issue_id").From("issue_watch").
+			Where(builder.Eq{"user_id": user.ID, "is_watching": true}))).
+		And(builder.NotIn("notification.repo_id", builder.Select("repo_id").From("watch").
+			Where(builder.Eq{"user_id": user.ID}.And(builder.In("mode", RepoWatchModeNormal, RepoWatchModeAuto))))).
+		OrderBy("notification.updated_unix DESC, notification.id DESC").
+		Find(&nl)
+}
+
+// CreateReviewVerdictNotification notifies the author of a pull request about the verdict of a review,
+// which is stored as the action of the notification. Multiple verdicts are coalesced into one thread
+// by bumping the existing notification. Reviews of the own pull request are ignored.
+func CreateReviewVerdictNotification(prIssueID, authorID, reviewerID int64, verdict string) error {
+	switch verdict {
+	case NotificationActionReviewApprove, NotificationActionReviewReject, NotificationActionReviewComment:
+	default:
+		return fmt.Errorf("unknown review verdict: %s", verdict)
+	}
+	if authorID == reviewerID {
+		return nil
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	issue, err := getIssueByID(sess, prIssueID)
+	if err != nil {
+		return err
+	}
+	if !issue.IsPull {
+		return fmt.Errorf("issue %d is not a pull request", prIssueID)
+	}
+
+	notifications, err := getNotificationsByIssueID(sess, prIssueID)
+	if err != nil {
+		return err
+	}
+
+	if notificationExists(notifications, issue.ID, authorID, NotificationSourcePullRequest) {
+		err = updateIssueNotification(sess, authorID, issue, 0, reviewerID, NotificationReasonReview, verdict)
+	} else {
+		err = createIssueNotification(sess, authorID, issue, 0, reviewerID, NotificationStatusUnread, NotificationReasonReview, verdict)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sess.Commit()
+}
+
+// CreateReviewRequestNotification notifies a reviewer that their review of a pull request was requested.
+// If the reviewer has already been requested before, this is a re-request: the thread is surfaced again as
+// unread even if it was read or done, and its action is set to NotificationActionReReviewRequested.
+// Requests to review the own pull request are ignored.
+func CreateReviewRequestNotification(prIssueID, reviewerID, requesterID int64) error {
+	if reviewerID == requesterID {
+		return nil
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	issue, err := getIssueByID(sess, prIssueID)
+	if err != nil {
+		return err
+	}
+	if !issue.IsPull {
+		return fmt.Errorf("issue %d is not a pull request", prIssueID)
+	}
+
+	notification, err := getIssueNotification(sess, reviewerID, issue.ID, NotificationSourcePullRequest)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case notification.ID == 0:
+		err = createIssueNotification(sess, reviewerID, issue, 0, requesterID, NotificationStatusUnread, NotificationReasonReviewRequested, NotificationActionReviewRequested)
+	case notification.Reason == NotificationReasonReviewRequested:
+		err = reRequestReviewNotification(sess, notification, requesterID)
+	default:
+		err = updateIssueNotification(sess, reviewerID, issue, 0, requesterID, NotificationReasonReviewRequested, NotificationActionReviewRequested)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sess.Commit()
+}
+
+// reRequestReviewNotification surfaces the notification of a reviewer whose review was requested again.
+// Unlike updateIssueNotification it does not depend on the previous status, only pinned notifications
+// keep their status as they are surfaced anyway.
+func reRequestReviewNotification(e Engine, notification *Notification, requesterID int64) error {
+	notification.UpdatedBy = requesterID
+	notification.Action = NotificationActionReReviewRequested
+	notification.CommentID = 0
+	cols := []string{"updated_by", "action", "comment_id"}
+	if notification.Status != NotificationStatusPinned {
+		notification.Status = NotificationStatusUnread
+		cols = append(cols, "status")
+	}
+
+	_, err := e.ID(notification.ID).Cols(cols...).Update(notification)
+	return err
+}
+
+// ResetUserNotifications deletes all notifications of the user, as opposed to marking them as read.
+// It returns the number of deleted notifications.
+func ResetUserNotifications(user *User) (int64, error) {
+	if user == nil || user.ID <= 0 {
+		return 0, fmt.Errorf("invalid user to reset notifications of")
+	}
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
 	}
 
-	var repoIDs = nl.getPendingRepoIDs()
-	var repos = make(map[int64]*Repository, len(repoIDs))
-	var left = len(repoIDs)
-	for left > 0 {
-		var limit = defaultMaxInSize
-		if left < limit {
-			limit = left
+	var total int64
+	for {
+		ids := make([]int64, 0, defaultMaxInSize)
+		if err := sess.Table("notification").
+			Where("user_id = ?", user.ID).
+			Cols("id").
+			Limit(defaultMaxInSize).
+			Find(&ids); err != nil {
+			return 0, err
 		}
-		rows, err := x.
-			In("id", repoIDs[:limit]).
-			Rows(new(Repository))
+		if len(ids) == 0 {
+			break
+		}
+
+		if err := deleteNotificationTags(sess, builder.In("id", ids)); err != nil {
+			return 0, err
+		}
+		if err := deleteTeamNotifications(sess, builder.In("id", ids)); err != nil {
+			return 0, err
+		}
+		deleted, err := sess.In("id", ids).Delete(new(Notification))
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
+		countNotificationsDeleted(deleted)
+		total += deleted
+	}
 
-		for rows.Next() {
-			var repo Repository
-			err = rows.Scan(&repo)
-			if err != nil {
-				rows.Close()
-				return nil, err
-			}
+	return total, sess.Commit()
+}
 
-			repos[repo.ID] = &repo
-		}
-		_ = rows.Close()
+// DeleteOrphanedNotifications deletes the notifications whose user does not exist anymore.
+// It returns the number of deleted notifications.
+func DeleteOrphanedNotifications() (int64, error) {
+	// refuse to run if no user can be read, as every notification would be considered orphaned otherwise
+	users, err := x.Count(new(User))
+	if err != nil {
+		return 0, err
+	} else if users == 0 {
+		return 0, fmt.Errorf("no users found, refusing to delete orphaned notifications")
+	}
 
-		left -= limit
-		repoIDs = repoIDs[limit:]
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
 	}
 
-	var reposList = make(RepositoryList, 0, len(repoIDs))
-	for _, notification := range nl {
-		if notification.Repository == nil {
-			notification.Repository = repos[notification.RepoID]
+	var total int64
+	for {
+		ids := make([]int64, 0, defaultMaxInSize)
+		if err := sess.Table("notification").
+			Join("LEFT", "`user`", "`user`.id = notification.user_id").
+			Where("`user`.id IS NULL").
+			Cols("notification.id").
+			Limit(defaultMaxInSize).
+			Find(&ids); err != nil {
+			return 0, err
 		}
-		var found bool
-		for _, r := range reposList {
-			if r.ID == notification.Repository.ID {
-				found = true
-				break
-			}
+		if len(ids) == 0 {
+			break
 		}
-		if !found {
-			reposList = append(reposList, notification.Repository)
+
+		if err := deleteNotificationTags(sess, builder.In("id", ids)); err != nil {
+			return 0, err
+		}
+		if err := deleteTeamNotifications(sess, builder.In("id", ids)); err != nil {
+			return 0, err
 		}
+		deleted, err := sess.In("id", ids).Delete(new(Notification))
+		if err != nil {
+			return 0, err
+		}
+		countNotificationsDeleted(deleted)
+		total += deleted
 	}
-	return reposList, nil
+
+	return total, sess.Commit()
 }
 
-func (nl NotificationList) getPendingIssueIDs() []int64 {
-	var ids = make(map[int64]struct{}, len(nl))
-	for _, notification := range nl {
-		if notification.Issue != nil {
-			continue
-		}
-		if _, ok := ids[notification.IssueID]; !ok {
-			ids[notification.IssueID] = struct{}{}
-		}
+// DeleteNotification soft deletes the notification of the user: it is hidden from all listings and counts,
+// but can be restored by RestoreNotification until it is purged by PurgeDeletedNotifications.
+func DeleteNotification(notificationID int64, user *User) error {
+	notification, err := getOwnedNotification(x, user, notificationID)
+	if err != nil {
+		return err
 	}
-	return keysInt64(ids)
+
+	notification.DeletedUnix = timeutil.TimeStampNow()
+	_, err = x.ID(notification.ID).Cols("deleted_unix").NoAutoTime().Update(notification)
+	return err
 }
 
-// LoadIssues loads issues from database
-func (nl NotificationList) LoadIssues() error {
-	if len(nl) == 0 {
+// RestoreNotification restores a notification of the user deleted by DeleteNotification. Deleted notifications
+// can be restored within setting.Cron.PurgeDeletedNotifications.OlderThan, after that ErrNotificationRestoreExpired
+// is returned. If the user has received a new notification of the same thread in the meantime,
+// ErrNotificationRestoreConflict is returned instead of having two notifications of the thread.
+// Restoring a notification which is not deleted does nothing.
+func RestoreNotification(notificationID int64, user *User) error {
+	notification := new(Notification)
+	has, err := x.ID(notificationID).Get(notification)
+	if err != nil {
+		return err
+	} else if !has {
+		return ErrNotificationNotExist{ID: notificationID}
+	} else if notification.UserID != user.ID {
+		return ErrNotificationForbidden{ID: notificationID, UserID: user.ID}
+	}
+
+	if notification.DeletedUnix == 0 {
 		return nil
 	}
+	if notification.DeletedUnix.AddDuration(setting.Cron.PurgeDeletedNotifications.OlderThan) <= timeutil.TimeStampNow() {
+		return ErrNotificationRestoreExpired{ID: notificationID}
+	}
 
-	var issueIDs = nl.getPendingIssueIDs()
-	var issues = make(map[int64]*Issue, len(issueIDs))
-	var left = len(issueIDs)
-	for left > 0 {
-		var limit = defaultMaxInSize
-		if left < limit {
-			limit = left
+	if notification.Source != NotificationSourceSystem {
+		commitCond := builder.Cond(builder.Eq{"commit_id": notification.CommitID})
+		if len(notification.CommitID) == 0 {
+			commitCond = commitCond.Or(builder.IsNull{"commit_id"})
 		}
-		rows, err := x.
-			In("id", issueIDs[:limit]).
-			Rows(new(Issue))
+		live := new(Notification)
+		has, err = x.
+			Where(builder.Eq{
+				"user_id":      notification.UserID,
+				"repo_id":      notification.RepoID,
+				"issue_id":     notification.IssueID,
+				"source":       notification.Source,
+				"deleted_unix": 0,
+			}.And(commitCond)).
+			Cols("id").
+			Get(live)
 		if err != nil {
 			return err
+		} else if has {
+			return ErrNotificationRestoreConflict{ID: notificationID, ExistingID: live.ID}
 		}
+	}
 
-		for rows.Next() {
-			var issue Issue
-			err = rows.Scan(&issue)
-			if err != nil {
-				rows.Close()
-				return err
-			}
+	notification.DeletedUnix = 0
+	_, err = x.ID(notification.ID).Cols("deleted_unix").NoAutoTime().Update(notification)
+	return err
+}
 
-			issues[issue.ID] = &issue
+// PurgeDeletedNotifications permanently deletes the notifications which have been soft deleted before the given time.
+// It returns the number of purged notifications.
+func PurgeDeletedNotifications(before timeutil.TimeStamp) (int64, error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for {
+		ids := make([]int64, 0, defaultMaxInSize)
+		if err := sess.Table("notification").
+			Where("deleted_unix > 0 AND deleted_unix < ?", before).
+			Cols("id").
+			Limit(defaultMaxInSize).
+			Find(&ids); err != nil {
+			return 0, err
+		}
+		if len(ids) == 0 {
+			break
 		}
-		_ = rows.Close()
 
-		left -= limit
-		issueIDs = issueIDs[limit:]
+		if err := deleteNotificationTags(sess, builder.In("id", ids)); err != nil {
+			return 0, err
+		}
+		if err := deleteTeamNotifications(sess, builder.In("id", ids)); err != nil {
+			return 0, err
+		}
+		deleted, err := sess.In("id", ids).Delete(new(Notification))
+		if err != nil {
+			return 0, err
+		}
+		countNotificationsDeleted(deleted)
+		total += deleted
 	}
 
-	for _, notification := range nl {
-		if notification.Issue == nil {
-			notification.Issue = issues[notification.IssueID]
-			notification.Issue.Repo = notification.Repository
-		}
+	return total, sess.Commit()
+}
+
+// PurgeOldDeletedNotifications periodically purges the notifications which have been deleted
+// longer than setting.Cron.PurgeDeletedNotifications.OlderThan ago
+func PurgeOldDeletedNotifications(ctx context.Context) {
+	log.Trace("Doing: PurgeOldDeletedNotifications")
+
+	before := timeutil.TimeStamp(time.Now().Add(-setting.Cron.PurgeDeletedNotifications.OlderThan).Unix())
+	if _, err := PurgeDeletedNotifications(before); err != nil {
+		log.Error("PurgeDeletedNotifications: %v", err)
 	}
-	return nil
 }
 
-func (nl NotificationList) getPendingCommentIDs() []int64 {
-	var ids = make(map[int64]struct{}, len(nl))
-	for _, notification := range nl {
-		if notification.CommentID == 0 || notification.Comment != nil {
-			continue
-		}
-		if _, ok := ids[notification.CommentID]; !ok {
-			ids[notification.CommentID] = struct{}{}
-		}
+// GetNotificationByRepoIssueIndex returns the notification of the user for the issue with the given index in the repository.
+// It returns ErrIssueNotExist if there is no such issue and false if the user has no notification for it.
+func GetNotificationByRepoIssueIndex(userID, repoID, index int64) (*Notification, bool, error) {
+	issue, err := GetIssueByIndex(repoID, index)
+	if err != nil {
+		return nil, false, err
 	}
-	return keysInt64(ids)
+
+	notification, err := getIssueNotification(x, userID, issue.ID, issueNotificationSource(issue))
+	if err != nil {
+		return nil, false, err
+	}
+	if notification.ID == 0 {
+		return nil, false, nil
+	}
+
+	notification.Issue = issue
+	return notification, true, nil
 }
 
-// LoadComments loads comments from database
-func (nl NotificationList) LoadComments() error {
-	if len(nl) == 0 {
-		return nil
+// IterateNotifications calls fn for every notification matching opts. The notifications are loaded
+// ordered by ID in batches of batchSize, so they never have to be held in memory all at once.
+// It stops at the first error returned by fn.
+func IterateNotifications(opts FindNotificationOptions, batchSize int, fn func(*Notification) error) error {
+	if batchSize <= 0 {
+		batchSize = setting.Database.IterateBufferSize
 	}
 
-	var commentIDs = nl.getPendingCommentIDs()
-	var comments = make(map[int64]*Comment, len(commentIDs))
-	var left = len(commentIDs)
-	for left > 0 {
-		var limit = defaultMaxInSize
-		if left < limit {
-			limit = left
-		}
-		rows, err := x.
-			In("id", commentIDs[:limit]).
-			Rows(new(Comment))
-		if err != nil {
+	var lastID int64
+	for {
+		notifications := make([]*Notification, 0, batchSize)
+		if err := opts.ToSession(x).
+			And("notification.id > ?", lastID).
+			OrderBy("notification.id").
+			Limit(batchSize).
+			Find(&notifications); err != nil {
 			return err
 		}
 
-		for rows.Next() {
-			var comment Comment
-			err = rows.Scan(&comment)
-			if err != nil {
-				rows.Close()
+		for _, notification := range notifications {
+			if err := fn(notification); err != nil {
 				return err
 			}
-
-			comments[comment.ID] = &comment
 		}
-		_ = rows.Close()
 
-		left -= limit
-		commentIDs = commentIDs[limit:]
+		if len(notifications) < batchSize {
+			return nil
+		}
+		lastID = notifications[len(notifications)-1].ID
 	}
+}
 
-	for _, notification := range nl {
-		if notification.CommentID > 0 && notification.Comment == nil && comments[notification.CommentID] != nil {
-			notification.Comment = comments[notification.CommentID]
-			notification.Comment.Issue = notification.Issue
+// BackfillNotificationUpdatedBy sets the missing updated_by of notifications created before it was recorded
+// to the poster of the referenced comment, or to the poster of the issue if there is no comment.
+// Notifications are processed in batches, it returns the number of fixed notifications.
+func BackfillNotificationUpdatedBy() (int64, error) {
+	batchSize := setting.Database.IterateBufferSize
+	var fixed, lastID int64
+	for {
+		notifications := make([]*Notification, 0, batchSize)
+		if err := x.Where("updated_by = 0 AND id > ?", lastID).
+			OrderBy("id").
+			Limit(batchSize).
+			Find(&notifications); err != nil {
+			return fixed, err
+		}
+
+		for _, notification := range notifications {
+			actorID, err := notificationLastActorID(x, notification)
+			if err != nil {
+				return fixed, err
+			}
+			if actorID == 0 {
+				continue
+			}
+			if _, err = x.ID(notification.ID).Cols("updated_by").NoAutoTime().Update(&Notification{UpdatedBy: actorID}); err != nil {
+				return fixed, err
+			}
+			fixed++
+		}
+
+		if len(notifications) < batchSize {
+			return fixed, nil
 		}
+		lastID = notifications[len(notifications)-1].ID
 	}
-	return nil
 }
 
-// GetNotificationCount returns the notification count for user
-func GetNotificationCount(user *User, status NotificationStatus) (int64, error) {
-	return getNotificationCount(x, user, status)
+// notificationLastActorID returns the poster of the comment or issue the notification refers to,
+// or 0 if it can not be determined
+func notificationLastActorID(e Engine, notification *Notification) (int64, error) {
+	if notification.CommentID != 0 {
+		comment := new(Comment)
+		has, err := e.ID(notification.CommentID).Cols("poster_id").Get(comment)
+		if err != nil {
+			return 0, err
+		} else if has && comment.PosterID != 0 {
+			return comment.PosterID, nil
+		}
+	}
+	if notification.IssueID != 0 {
+		issue := new(Issue)
+		has, err := e.ID(notification.IssueID).Cols("poster_id").Get(issue)
+		if err != nil {
+			return 0, err
+		} else if has {
+			return issue.PosterID, nil
+		}
+	}
+	return 0, nil
 }
 
-func getNotificationCount(e Engine, user *User, status NotificationStatus) (count int64, err error) {
-	count, err = e.
-		Where("user_id = ?", user.ID).
-		And("status = ?", status).
-		Count(&Notification{})
-	return
-}
+// remapNotificationCommentsChunkSize is the maximum number of ids queried or updated by a single statement
+const remapNotificationCommentsChunkSize = 500
 
-func setNotificationStatusReadIfUnread(e Engine, userID, issueID int64) error {
-	notification, err := getIssueNotification(e, userID, issueID)
-	// ignore if not exists
-	if err != nil {
-		return nil
+// RemapNotificationComments replaces the comment ids of notifications according to the given old to new mapping,
+// e.g. after comments have been consolidated. Comment ids mapped to 0 are cleared. The mapping is applied to the
+// comment ids as they were before the call, so chained or swapped mappings like {1: 2, 2: 1} are applied once.
+// It returns the number of updated notifications.
+func RemapNotificationComments(mapping map[int64]int64) (int64, error) {
+	oldIDs := make([]int64, 0, len(mapping))
+	for oldID, newID := range mapping {
+		if oldID != newID {
+			oldIDs = append(oldIDs, oldID)
+		}
 	}
+	sort.Slice(oldIDs, func(i, j int) bool { return oldIDs[i] < oldIDs[j] })
 
-	if notification.Status != NotificationStatusUnread {
-		return nil
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
 	}
 
-	notification.Status = NotificationStatusRead
+	// resolve the affected notifications before any update, so no notification is remapped twice
+	rowIDsByNewID := make(map[int64][]int64, len(oldIDs))
+	newIDs := make([]int64, 0, len(oldIDs))
+	for start := 0; start < len(oldIDs); start += remapNotificationCommentsChunkSize {
+		end := start + remapNotificationCommentsChunkSize
+		if end > len(oldIDs) {
+			end = len(oldIDs)
+		}
+		notifications := make([]*Notification, 0, end-start)
+		if err := sess.In("comment_id", oldIDs[start:end]).
+			Cols("id", "comment_id").
+			Find(&notifications); err != nil {
+			return 0, err
+		}
+		for _, notification := range notifications {
+			newID := mapping[notification.CommentID]
+			if _, ok := rowIDsByNewID[newID]; !ok {
+				newIDs = append(newIDs, newID)
+			}
+			rowIDsByNewID[newID] = append(rowIDsByNewID[newID], notification.ID)
+		}
+	}
+	sort.Slice(newIDs, func(i, j int) bool { return newIDs[i] < newIDs[j] })
 
-	_, err = e.ID(notification.ID).Update(notification)
-	return err
+	var affected int64
+	for _, newID := range newIDs {
+		rowIDs := rowIDsByNewID[newID]
+		for start := 0; start < len(rowIDs); start += remapNotificationCommentsChunkSize {
+			end := start + remapNotificationCommentsChunkSize
+			if end > len(rowIDs) {
+				end = len(rowIDs)
+			}
+			n, err := sess.In("id", rowIDs[start:end]).
+				Cols("comment_id").
+				NoAutoTime().
+				Update(&Notification{CommentID: newID})
+			if err != nil {
+				return 0, err
+			}
+			affected += n
+		}
+	}
+
+	return affected, sess.Commit()
 }
 
-// SetNotificationStatus change the notification status
-func SetNotificationStatus(notificationID int64, user *User, status NotificationStatus) error {
-	notification, err := getNotificationByID(x, notificationID)
-	if err != nil {
-		return err
-	}
+// NotificationDeliveryStatus is the state of the asynchronous delivery of a notification
+type NotificationDeliveryStatus uint8
 
-	if notification.UserID != user.ID {
-		return fmt.Errorf("Can't change notification of another user: %d, %d", notification.UserID, user.ID)
-	}
+// NotificationDeliveryStatus values
+const (
+	// NotificationDeliveryPending is a notification which has not been delivered yet
+	NotificationDeliveryPending NotificationDeliveryStatus = iota
+	// NotificationDeliveryDelivered is a notification which has been delivered
+	NotificationDeliveryDelivered
+	// NotificationDeliveryFailed is a notification whose delivery failed and which is retried
+	NotificationDeliveryFailed
+	// NotificationDeliveryDead is a notification whose delivery failed too often and which is not retried anymore
+	NotificationDeliveryDead
+)
 
-	notification.Status = status
+// maxNotificationDeliveryAttempts is the number of failed deliveries after which a notification is dead
+const maxNotificationDeliveryAttempts = 5
 
-	_, err = x.ID(notificationID).Update(notification)
-	return err
+// GetNotificationsPendingDelivery returns up to limit notifications which have not been delivered yet
+// or whose delivery failed and is retried, oldest first
+func GetNotificationsPendingDelivery(limit int) (NotificationList, error) {
+	notifications := make(NotificationList, 0, limit)
+	return notifications, x.
+		In("delivery_status", NotificationDeliveryPending, NotificationDeliveryFailed).
+		And("deleted_unix = 0").
+		OrderBy("id").
+		Limit(limit).
+		Find(&notifications)
 }
 
-// GetNotificationByID return notification by ID
-func GetNotificationByID(notificationID int64) (*Notification, error) {
-	return getNotificationByID(x, notificationID)
+// MarkNotificationDelivered records the successful delivery of the notification
+func MarkNotificationDelivered(id int64) error {
+	_, err := x.ID(id).
+		Cols("delivery_status").
+		NoAutoTime().
+		Update(&Notification{DeliveryStatus: NotificationDeliveryDelivered})
+	return err
 }
 
-func getNotificationByID(e Engine, notificationID int64) (*Notification, error) {
-	notification := new(Notification)
-	ok, err := e.
-		Where("id = ?", notificationID).
-		Get(notification)
+// MarkNotificationFailed records a failed delivery of the notification. It is retried until
+// maxNotificationDeliveryAttempts deliveries failed, then it is marked as dead.
+func MarkNotificationFailed(id int64, deliveryErr error) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
 
+	notification, err := getNotificationByID(sess, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if !ok {
-		return nil, ErrNotExist{ID: notificationID}
+	notification.DeliveryAttempts++
+	notification.DeliveryStatus = NotificationDeliveryFailed
+	if notification.DeliveryAttempts >= maxNotificationDeliveryAttempts {
+		notification.DeliveryStatus = NotificationDeliveryDead
+		log.Warn("Giving up delivering notification %d after %d attempts: %v", id, notification.DeliveryAttempts, deliveryErr)
+	} else {
+		log.Debug("Delivering notification %d failed, attempt %d: %v", id, notification.DeliveryAttempts, deliveryErr)
 	}
 
-	return notification, nil
-}
-
-// UpdateNotificationStatuses updates the statuses of all of a user's notifications that are of the currentStatus type to the desiredStatus
-func UpdateNotificationStatuses(user *User, currentStatus NotificationStatus, desiredStatus NotificationStatus) error {
-	n := &Notification{Status: desiredStatus, UpdatedBy: user.ID}
-	_, err := x.
-		Where("user_id = ? AND status = ?", user.ID, currentStatus).
-		Cols("status", "updated_by", "updated_unix").
-		Update(n)
-	return err
+	if _, err = sess.ID(id).
+		Cols("delivery_status", "delivery_attempts").
+		NoAutoTime().
+		Update(notification); err != nil {
+		return err
+	}
+	return sess.Commit()
 }
@@ -0,0 +1,55 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"sync/atomic"
+
+	"code.gitea.io/gitea/modules/log"
+)
+
+// NotificationMetrics contains the notification metrics exported for monitoring
+type NotificationMetrics struct {
+	// CreatedTotal, ReadTotal and DeletedTotal count the notifications since the start of the process
+	CreatedTotal int64
+	ReadTotal    int64
+	DeletedTotal int64
+	// Unread is the current number of unread notifications
+	Unread int64
+}
+
+var notificationCounters struct {
+	created int64
+	read    int64
+	deleted int64
+}
+
+func countNotificationsCreated(n int64) {
+	atomic.AddInt64(&notificationCounters.created, n)
+}
+
+func countNotificationsRead(n int64) {
+	atomic.AddInt64(&notificationCounters.read, n)
+}
+
+func countNotificationsDeleted(n int64) {
+	atomic.AddInt64(&notificationCounters.deleted, n)
+}
+
+// CollectNotificationMetrics returns the current notification metrics. The unread gauge is counted
+// in the database on every call, so it is meant to be collected periodically, e.g. by a metrics scrape.
+func CollectNotificationMetrics() NotificationMetrics {
+	unread, err := x.Where("status = ? AND deleted_unix = 0", NotificationStatusUnread).Count(new(Notification))
+	if err != nil {
+		log.Error("Unable to count unread notifications: %v", err)
+	}
+
+	return NotificationMetrics{
+		CreatedTotal: atomic.LoadInt64(&notificationCounters.created),
+		ReadTotal:    atomic.LoadInt64(&notificationCounters.read),
+		DeletedTotal: atomic.LoadInt64(&notificationCounters.deleted),
+		Unread:       unread,
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectNotificationMetrics(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	before := CollectNotificationMetrics()
+	assert.EqualValues(t, 3, before.Unread)
+
+	// users 4 and 11 watch repo 1 and get new notifications
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	metrics := CollectNotificationMetrics()
+	assert.EqualValues(t, 2, metrics.CreatedTotal-before.CreatedTotal)
+	assert.EqualValues(t, before.Unread+2, metrics.Unread)
+
+	before = metrics
+	assert.NoError(t, SetNotificationStatus(4, &User{ID: 2}, NotificationStatusRead))
+	metrics = CollectNotificationMetrics()
+	assert.EqualValues(t, 1, metrics.ReadTotal-before.ReadTotal)
+	assert.EqualValues(t, before.Unread-1, metrics.Unread)
+
+	// marking a read notification as read again is not counted
+	assert.NoError(t, SetNotificationStatus(4, &User{ID: 2}, NotificationStatusRead))
+	assert.Equal(t, metrics.ReadTotal, CollectNotificationMetrics().ReadTotal)
+
+	before = CollectNotificationMetrics()
+	deleted, err := ResetUserNotifications(&User{ID: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, deleted, CollectNotificationMetrics().DeletedTotal-before.DeletedTotal)
+}
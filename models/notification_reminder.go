@@ -0,0 +1,118 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"context"
+
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/timeutil"
+)
+
+const (
+	// NotificationReasonReminder is used when a reminder of the user about the issue is due
+	NotificationReasonReminder = "reminder"
+	// NotificationActionReminded is the action of notifications created or updated by a reminder
+	NotificationActionReminded = "reminded"
+)
+
+// NotificationReminder is a request of a user to be notified about an issue at a given time
+type NotificationReminder struct {
+	ID          int64              `xorm:"pk autoincr"`
+	UserID      int64              `xorm:"UNIQUE(s) NOT NULL"`
+	IssueID     int64              `xorm:"UNIQUE(s) NOT NULL"`
+	RemindUnix  timeutil.TimeStamp `xorm:"INDEX NOT NULL"`
+	CreatedUnix timeutil.TimeStamp `xorm:"created NOT NULL"`
+}
+
+// CreateNotificationReminder reminds the user about the issue at the given time.
+// A user has at most one reminder per issue, an existing reminder is rescheduled.
+func CreateNotificationReminder(userID, issueID int64, remindUnix timeutil.TimeStamp) error {
+	reminder := new(NotificationReminder)
+	has, err := x.
+		Where("user_id = ?", userID).
+		And("issue_id = ?", issueID).
+		Get(reminder)
+	if err != nil {
+		return err
+	}
+
+	if has {
+		reminder.RemindUnix = remindUnix
+		_, err = x.ID(reminder.ID).Cols("remind_unix").Update(reminder)
+		return err
+	}
+
+	_, err = x.Insert(&NotificationReminder{
+		UserID:     userID,
+		IssueID:    issueID,
+		RemindUnix: remindUnix,
+	})
+	return err
+}
+
+// FireDueReminders creates or bumps an issue notification for every reminder which is due at the given time
+// and deletes the reminders. Reminders of issues which have been closed in the meantime are dropped.
+// It returns the number of fired reminders.
+func FireDueReminders(now timeutil.TimeStamp) (int64, error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+
+	reminders := make([]*NotificationReminder, 0, 10)
+	if err := sess.
+		Where("remind_unix <= ?", now).
+		OrderBy("remind_unix ASC, id ASC").
+		Find(&reminders); err != nil {
+		return 0, err
+	}
+
+	var fired int64
+	for _, reminder := range reminders {
+		issue, err := getIssueByID(sess, reminder.IssueID)
+		if err != nil && !IsErrIssueNotExist(err) {
+			return 0, err
+		}
+
+		if err == nil && !issue.IsClosed {
+			notification, err := getIssueNotification(sess, reminder.UserID, issue.ID, issueNotificationSource(issue))
+			if err != nil {
+				return 0, err
+			}
+			if notification.ID != 0 {
+				err = updateIssueNotification(sess, reminder.UserID, issue, 0, reminder.UserID, NotificationReasonReminder, NotificationActionReminded)
+			} else {
+				err = createIssueNotification(sess, reminder.UserID, issue, 0, reminder.UserID, NotificationStatusUnread, NotificationReasonReminder, NotificationActionReminded)
+			}
+			if err != nil {
+				return 0, err
+			}
+			fired++
+		}
+
+		if _, err := sess.ID(reminder.ID).Delete(new(NotificationReminder)); err != nil {
+			return 0, err
+		}
+	}
+
+	return fired, sess.Commit()
+}
+
+// FireNotificationReminders periodically fires the notification reminders which are due
+func FireNotificationReminders(ctx context.Context) {
+	log.Trace("Doing: FireNotificationReminders")
+
+	if _, err := FireDueReminders(timeutil.TimeStampNow()); err != nil {
+		log.Error("FireDueReminders: %v", err)
+	}
+}
+
+// deleteIssueNotificationReminders cancels all reminders about the issue
+func deleteIssueNotificationReminders(e Engine, issueID int64) error {
+	_, err := e.Where("issue_id = ?", issueID).Delete(new(NotificationReminder))
+	return err
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFireDueReminders(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	now := timeutil.TimeStamp(1500000000)
+
+	// user 4 has no notification for issue 1 yet, user 2 has a read one for issue 2
+	assert.NoError(t, CreateNotificationReminder(4, 1, now+100))
+	assert.NoError(t, CreateNotificationReminder(4, 1, now-100))
+	assert.NoError(t, CreateNotificationReminder(2, 2, now))
+	assert.NoError(t, CreateNotificationReminder(2, 1, now+100))
+	assert.EqualValues(t, 1, GetCount(t, &NotificationReminder{UserID: 4, IssueID: 1}))
+
+	fired, err := FireDueReminders(now)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, fired)
+
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonReminder, notf.Reason)
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonReminder, notf.Reason)
+
+	AssertNotExistsBean(t, &NotificationReminder{UserID: 4, IssueID: 1})
+	AssertNotExistsBean(t, &NotificationReminder{UserID: 2, IssueID: 2})
+	AssertExistsAndLoadBean(t, &NotificationReminder{UserID: 2, IssueID: 1})
+
+	fired, err = FireDueReminders(now)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, fired)
+}
+
+func TestNotificationReminder_CancelledOnClose(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	issue := AssertExistsAndLoadBean(t, &Issue{ID: 1}).(*Issue)
+	doer := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	assert.NoError(t, CreateNotificationReminder(4, issue.ID, 1))
+	_, err := issue.ChangeStatus(doer, true)
+	assert.NoError(t, err)
+	AssertNotExistsBean(t, &NotificationReminder{IssueID: issue.ID})
+
+	fired, err := FireDueReminders(timeutil.TimeStampNow())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, fired)
+}
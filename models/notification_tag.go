@@ -0,0 +1,171 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	api "code.gitea.io/gitea/modules/structs"
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/builder"
+)
+
+// notificationTagColorPattern matches the colors of notification tags, e.g. #e11d21
+var notificationTagColorPattern = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+
+// NotificationTag is a personal colored tag a user put on one of the own notifications,
+// e.g. "follow-up". It is unrelated to the labels of the issue.
+type NotificationTag struct {
+	ID             int64              `xorm:"pk autoincr"`
+	UserID         int64              `xorm:"INDEX NOT NULL"`
+	NotificationID int64              `xorm:"UNIQUE(s) NOT NULL"`
+	Name           string             `xorm:"VARCHAR(50) UNIQUE(s) NOT NULL"`
+	Color          string             `xorm:"VARCHAR(7) NOT NULL"`
+	CreatedUnix    timeutil.TimeStamp `xorm:"created NOT NULL"`
+}
+
+// APIFormat converts a NotificationTag to api.NotificationTag
+func (tag *NotificationTag) APIFormat() *api.NotificationTag {
+	return &api.NotificationTag{
+		Name:  tag.Name,
+		Color: tag.Color,
+	}
+}
+
+// ErrInvalidNotificationTag represents an error that the name or color of a notification tag is invalid
+type ErrInvalidNotificationTag struct {
+	Name  string
+	Color string
+}
+
+// IsErrInvalidNotificationTag checks if an error is an ErrInvalidNotificationTag.
+func IsErrInvalidNotificationTag(err error) bool {
+	_, ok := err.(ErrInvalidNotificationTag)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrInvalidNotificationTag) Error() string {
+	return fmt.Sprintf("invalid notification tag [name: %s, color: %s]", err.Name, err.Color)
+}
+
+// AddNotificationTag puts the tag on the notification of the user, or changes its color if the
+// notification already has a tag with this name.
+func AddNotificationTag(user *User, notificationID int64, name, color string) (*NotificationTag, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || len(name) > 50 || !notificationTagColorPattern.MatchString(color) {
+		return nil, ErrInvalidNotificationTag{Name: name, Color: color}
+	}
+
+	if _, err := getOwnedNotification(x, user, notificationID); err != nil {
+		return nil, err
+	}
+
+	tag := new(NotificationTag)
+	has, err := x.
+		Where("notification_id = ?", notificationID).
+		And("name = ?", name).
+		Get(tag)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		tag.Color = color
+		if _, err = x.ID(tag.ID).Cols("color").Update(tag); err != nil {
+			return nil, err
+		}
+		return tag, nil
+	}
+
+	tag = &NotificationTag{
+		UserID:         user.ID,
+		NotificationID: notificationID,
+		Name:           name,
+		Color:          color,
+	}
+	if _, err = x.Insert(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// RemoveNotificationTag removes the tag with the given name from the notification of the user
+func RemoveNotificationTag(user *User, notificationID int64, name string) error {
+	if _, err := getOwnedNotification(x, user, notificationID); err != nil {
+		return err
+	}
+
+	_, err := x.
+		Where("notification_id = ?", notificationID).
+		And("name = ?", strings.TrimSpace(name)).
+		Delete(new(NotificationTag))
+	return err
+}
+
+// ListNotificationTags returns the tags of the notification of the user ordered by name
+func ListNotificationTags(user *User, notificationID int64) ([]*NotificationTag, error) {
+	if _, err := getOwnedNotification(x, user, notificationID); err != nil {
+		return nil, err
+	}
+	return getNotificationTags(x, notificationID)
+}
+
+func getNotificationTags(e Engine, notificationID int64) ([]*NotificationTag, error) {
+	tags := make([]*NotificationTag, 0, 5)
+	return tags, e.
+		Where("notification_id = ?", notificationID).
+		OrderBy("name").
+		Find(&tags)
+}
+
+// loadTags loads the tags of all notifications of the list which have not been loaded yet at once
+func (nl NotificationList) loadTags(e Engine) error {
+	var ids = make([]int64, 0, len(nl))
+	for _, notification := range nl {
+		if notification.Tags == nil {
+			ids = append(ids, notification.ID)
+		}
+	}
+
+	var tags = make(map[int64][]*NotificationTag, len(ids))
+	for len(ids) > 0 {
+		var limit = defaultMaxInSize
+		if len(ids) < limit {
+			limit = len(ids)
+		}
+		chunk := make([]*NotificationTag, 0, limit)
+		if err := e.
+			In("notification_id", ids[:limit]).
+			OrderBy("name").
+			Find(&chunk); err != nil {
+			return err
+		}
+		for _, tag := range chunk {
+			tags[tag.NotificationID] = append(tags[tag.NotificationID], tag)
+		}
+		ids = ids[limit:]
+	}
+
+	for _, notification := range nl {
+		if notification.Tags == nil {
+			notification.Tags = tags[notification.ID]
+			if notification.Tags == nil {
+				notification.Tags = []*NotificationTag{}
+			}
+		}
+	}
+	return nil
+}
+
+// deleteNotificationTags deletes the tags of the notifications matching the condition on the notification table
+func deleteNotificationTags(e Engine, notificationCond builder.Cond) error {
+	_, err := e.
+		In("notification_id", builder.Select("id").From("notification").Where(notificationCond)).
+		Delete(new(NotificationTag))
+	return err
+}
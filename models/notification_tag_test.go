@@ -0,0 +1,100 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationTags(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	_, err := AddNotificationTag(user, 4, "follow-up", "#e11d21")
+	assert.NoError(t, err)
+	_, err = AddNotificationTag(user, 4, "blocked-on-me", "#000000")
+	assert.NoError(t, err)
+	// adding an existing tag changes its color
+	tag, err := AddNotificationTag(user, 4, "follow-up", "#fbca04")
+	assert.NoError(t, err)
+	assert.Equal(t, "#fbca04", tag.Color)
+
+	tags, err := ListNotificationTags(user, 4)
+	assert.NoError(t, err)
+	if assert.Len(t, tags, 2) {
+		assert.Equal(t, "blocked-on-me", tags[0].Name)
+		assert.Equal(t, "follow-up", tags[1].Name)
+		assert.Equal(t, "#fbca04", tags[1].Color)
+	}
+
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Len(t, notf.APIFormat("en-US").UserTags, 2)
+
+	assert.NoError(t, RemoveNotificationTag(user, 4, "blocked-on-me"))
+	tags, err = ListNotificationTags(user, 4)
+	assert.NoError(t, err)
+	assert.Len(t, tags, 1)
+
+	_, err = AddNotificationTag(user, 4, "", "#000000")
+	assert.True(t, IsErrInvalidNotificationTag(err))
+	_, err = AddNotificationTag(user, 4, "follow-up", "red")
+	assert.True(t, IsErrInvalidNotificationTag(err))
+
+	// notification 1 belongs to user 1
+	_, err = AddNotificationTag(user, 1, "follow-up", "#000000")
+	assert.True(t, IsErrNotificationForbidden(err))
+}
+
+func TestNotificationList_LoadTags(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	_, err := AddNotificationTag(user, 4, "follow-up", "#e11d21")
+	assert.NoError(t, err)
+	_, err = AddNotificationTag(user, 4, "blocked-on-me", "#000000")
+	assert.NoError(t, err)
+	_, err = AddNotificationTag(user, 5, "follow-up", "#fbca04")
+	assert.NoError(t, err)
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: user.ID})
+	assert.NoError(t, err)
+	assert.NoError(t, nl.LoadAttributes())
+	for _, notf := range nl {
+		switch notf.ID {
+		case 4:
+			if assert.Len(t, notf.Tags, 2) {
+				assert.Equal(t, "blocked-on-me", notf.Tags[0].Name)
+				assert.Equal(t, "follow-up", notf.Tags[1].Name)
+			}
+		case 5:
+			if assert.Len(t, notf.Tags, 1) {
+				assert.Equal(t, "#fbca04", notf.Tags[0].Color)
+			}
+		default:
+			assert.NotNil(t, notf.Tags)
+			assert.Empty(t, notf.Tags)
+		}
+	}
+}
+
+func TestNotificationTags_DeleteCascade(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	_, err := AddNotificationTag(user, 4, "follow-up", "#e11d21")
+	assert.NoError(t, err)
+	_, err = AddNotificationTag(user, 5, "follow-up", "#e11d21")
+	assert.NoError(t, err)
+	other, err := AddNotificationTag(&User{ID: 1}, 1, "follow-up", "#e11d21")
+	assert.NoError(t, err)
+
+	_, err = ResetUserNotifications(user)
+	assert.NoError(t, err)
+	AssertNotExistsBean(t, &NotificationTag{UserID: 2})
+	AssertExistsAndLoadBean(t, &NotificationTag{ID: other.ID})
+}
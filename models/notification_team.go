@@ -0,0 +1,183 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"xorm.io/builder"
+)
+
+// TeamNotification assigns a notification to the shared inbox of a team,
+// where any member of the team can claim it to let the others know it is taken care of.
+type TeamNotification struct {
+	ID             int64              `xorm:"pk autoincr"`
+	TeamID         int64              `xorm:"UNIQUE(s) NOT NULL"`
+	NotificationID int64              `xorm:"UNIQUE(s) NOT NULL"`
+	ClaimedBy      int64              `xorm:"INDEX NOT NULL DEFAULT 0"`
+	ClaimedUnix    timeutil.TimeStamp `xorm:"NOT NULL DEFAULT 0"`
+	CreatedUnix    timeutil.TimeStamp `xorm:"created NOT NULL"`
+
+	Notification *Notification `xorm:"-"`
+}
+
+// IsClaimed returns true if a member of the team claimed the notification
+func (tn *TeamNotification) IsClaimed() bool {
+	return tn.ClaimedBy != 0
+}
+
+// ErrTeamNotificationClaimed represents an error that a team notification has been claimed by another member
+type ErrTeamNotificationClaimed struct {
+	ID        int64
+	ClaimedBy int64
+}
+
+// IsErrTeamNotificationClaimed checks if an error is an ErrTeamNotificationClaimed.
+func IsErrTeamNotificationClaimed(err error) bool {
+	_, ok := err.(ErrTeamNotificationClaimed)
+	return ok
+}
+
+// Error implements error interface
+func (err ErrTeamNotificationClaimed) Error() string {
+	return fmt.Sprintf("team notification has already been claimed [id: %d, claimed_by: %d]", err.ID, err.ClaimedBy)
+}
+
+// AddTeamNotification adds the notification to the inbox of the team.
+// It does nothing if the notification is already in the inbox.
+func AddTeamNotification(teamID, notificationID int64) (*TeamNotification, error) {
+	tn := new(TeamNotification)
+	has, err := x.
+		Where("team_id = ?", teamID).
+		And("notification_id = ?", notificationID).
+		Get(tn)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return tn, nil
+	}
+
+	tn = &TeamNotification{
+		TeamID:         teamID,
+		NotificationID: notificationID,
+	}
+	if _, err = x.Insert(tn); err != nil {
+		return nil, err
+	}
+	return tn, nil
+}
+
+// GetTeamNotifications returns the notifications in the inbox of the team which match the options,
+// most recently updated first. The UserID of the options is ignored, as the inbox is shared.
+func GetTeamNotifications(teamID int64, opts FindNotificationOptions) ([]*TeamNotification, error) {
+	opts.UserID = 0
+
+	var notifications NotificationList
+	if err := opts.ToSession(x).
+		Join("INNER", "team_notification", "team_notification.notification_id = notification.id").
+		And("team_notification.team_id = ?", teamID).
+		OrderBy("notification.updated_unix DESC, notification.id DESC").
+		Find(&notifications); err != nil {
+		return nil, err
+	}
+	if len(notifications) == 0 {
+		return []*TeamNotification{}, nil
+	}
+
+	notificationIDs := make([]int64, 0, len(notifications))
+	for _, notification := range notifications {
+		notificationIDs = append(notificationIDs, notification.ID)
+	}
+
+	tns := make([]*TeamNotification, 0, len(notifications))
+	if err := x.
+		Where("team_id = ?", teamID).
+		In("notification_id", notificationIDs).
+		Find(&tns); err != nil {
+		return nil, err
+	}
+	byNotificationID := make(map[int64]*TeamNotification, len(tns))
+	for _, tn := range tns {
+		byNotificationID[tn.NotificationID] = tn
+	}
+
+	result := make([]*TeamNotification, 0, len(notifications))
+	for _, notification := range notifications {
+		if tn, ok := byNotificationID[notification.ID]; ok {
+			tn.Notification = notification
+			result = append(result, tn)
+		}
+	}
+	return result, nil
+}
+
+// ClaimTeamNotification marks the notification in the inbox of the team as claimed by the user,
+// who has to be a member of the team. It returns ErrTeamNotificationClaimed if another member
+// claimed it already.
+func ClaimTeamNotification(teamNotificationID int64, user *User) error {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+
+	tn := new(TeamNotification)
+	has, err := sess.ID(teamNotificationID).Get(tn)
+	if err != nil {
+		return err
+	} else if !has {
+		return ErrNotExist{ID: teamNotificationID}
+	}
+
+	team, err := getTeamByID(sess, tn.TeamID)
+	if err != nil {
+		return err
+	}
+	isMember, err := isTeamMember(sess, team.OrgID, team.ID, user.ID)
+	if err != nil {
+		return err
+	} else if !isMember {
+		return fmt.Errorf("user %d is not a member of team %d", user.ID, team.ID)
+	}
+
+	if tn.ClaimedBy == user.ID {
+		return nil
+	}
+
+	// only claim it if nobody else did in the meantime
+	affected, err := sess.
+		Where("id = ?", tn.ID).
+		And("claimed_by = ?", 0).
+		Cols("claimed_by", "claimed_unix").
+		Update(&TeamNotification{ClaimedBy: user.ID, ClaimedUnix: timeutil.TimeStampNow()})
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		// another member claimed it after it has been read above, so report the actual claimer
+		claimed := new(TeamNotification)
+		has, err := sess.ID(tn.ID).Get(claimed)
+		if err != nil {
+			return err
+		} else if !has {
+			return ErrNotExist{ID: tn.ID}
+		} else if claimed.ClaimedBy == user.ID {
+			return nil
+		}
+		return ErrTeamNotificationClaimed{ID: tn.ID, ClaimedBy: claimed.ClaimedBy}
+	}
+
+	return sess.Commit()
+}
+
+// deleteTeamNotifications removes the notifications matching the condition from the inboxes of all teams
+func deleteTeamNotifications(e Engine, notificationCond builder.Cond) error {
+	_, err := e.
+		In("notification_id", builder.Select("id").From("notification").Where(notificationCond)).
+		Delete(new(TeamNotification))
+	return err
+}
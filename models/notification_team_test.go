@@ -0,0 +1,95 @@
+// Copyright 2020 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/modules/timeutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTeamNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// team 2 of organization 3 shares notifications 4 and 5 of user 2
+	_, err := AddTeamNotification(2, 4)
+	assert.NoError(t, err)
+	_, err = AddTeamNotification(2, 5)
+	assert.NoError(t, err)
+	_, err = AddTeamNotification(2, 5)
+	assert.NoError(t, err)
+	_, err = AddTeamNotification(1, 2)
+	assert.NoError(t, err)
+
+	tns, err := GetTeamNotifications(2, FindNotificationOptions{UserID: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, tns, 2) {
+		assert.EqualValues(t, 5, tns[0].NotificationID)
+		assert.EqualValues(t, 5, tns[0].Notification.ID)
+		assert.EqualValues(t, 4, tns[1].Notification.ID)
+		assert.False(t, tns[0].IsClaimed())
+	}
+
+	tns, err = GetTeamNotifications(2, FindNotificationOptions{RepoID: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, tns, 1) {
+		assert.EqualValues(t, 5, tns[0].NotificationID)
+	}
+
+	tns, err = GetTeamNotifications(3, FindNotificationOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, tns, 0)
+}
+
+func TestClaimTeamNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user2 := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+	user4 := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+	user5 := AssertExistsAndLoadBean(t, &User{ID: 5}).(*User)
+
+	tn, err := AddTeamNotification(2, 4)
+	assert.NoError(t, err)
+
+	// user 5 is not a member of team 2
+	assert.Error(t, ClaimTeamNotification(tn.ID, user5))
+
+	assert.NoError(t, ClaimTeamNotification(tn.ID, user4))
+	assert.NoError(t, ClaimTeamNotification(tn.ID, user4))
+	err = ClaimTeamNotification(tn.ID, user2)
+	if assert.True(t, IsErrTeamNotificationClaimed(err)) {
+		assert.EqualValues(t, user4.ID, err.(ErrTeamNotificationClaimed).ClaimedBy)
+	}
+
+	tns, err := GetTeamNotifications(2, FindNotificationOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, tns, 1) {
+		assert.True(t, tns[0].IsClaimed())
+		assert.EqualValues(t, user4.ID, tns[0].ClaimedBy)
+		assert.NotZero(t, tns[0].ClaimedUnix)
+	}
+
+	assert.True(t, IsErrNotExist(ClaimTeamNotification(NonexistentID, user4)))
+}
+
+func TestPurgeDeletedNotifications_TeamNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user2 := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	tn, err := AddTeamNotification(2, 4)
+	assert.NoError(t, err)
+
+	// a deleted notification leaves the inbox of the team, but can still be restored
+	assert.NoError(t, DeleteNotification(4, user2))
+	tns, err := GetTeamNotifications(2, FindNotificationOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, tns, 0)
+	AssertExistsAndLoadBean(t, &TeamNotification{ID: tn.ID})
+
+	_, err = PurgeDeletedNotifications(timeutil.TimeStampNow() + 1)
+	assert.NoError(t, err)
+	AssertNotExistsBean(t, &TeamNotification{ID: tn.ID})
+}
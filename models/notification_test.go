@@ -5,9 +5,18 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"code.gitea.io/gitea/modules/setting"
+	api "code.gitea.io/gitea/modules/structs"
+	"code.gitea.io/gitea/modules/timeutil"
 
 	"github.com/stretchr/testify/assert"
+	"xorm.io/builder"
 )
 
 func TestCreateOrUpdateIssueNotifications(t *testing.T) {
@@ -25,6 +34,37 @@ func TestCreateOrUpdateIssueNotifications(t *testing.T) {
 	assert.Equal(t, NotificationStatusUnread, notf.Status)
 }
 
+func TestSetNotificationCreationPaused(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	SetNotificationCreationPaused(true)
+	defer SetNotificationCreationPaused(false)
+	assert.True(t, IsNotificationCreationPaused())
+
+	before, err := x.Count(new(Notification))
+	assert.NoError(t, err)
+
+	// existing notifications can still be read and updated
+	assert.NoError(t, SetNotificationStatus(1, AssertExistsAndLoadBean(t, &User{ID: 1}).(*User), NotificationStatusRead))
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 2, 2))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.EqualValues(t, 2, notf.CommentID)
+
+	assert.NoError(t, CreateMentionNotifications(1, 2, 2, []int64{5}))
+	broadcast, err := BroadcastSystemNotification("Maintenance", "https://try.gitea.io", 1)
+	assert.NoError(t, err)
+	assert.Zero(t, broadcast)
+	assert.Error(t, ImportNotification(&Notification{UserID: 2, Source: NotificationSourceSystem}))
+
+	after, err := x.Count(new(Notification))
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	SetNotificationCreationPaused(false)
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 2, 2))
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1})
+}
+
 func TestNotificationsForUser(t *testing.T) {
 	assert.NoError(t, PrepareTestDatabase())
 	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
@@ -41,6 +81,40 @@ func TestNotificationsForUser(t *testing.T) {
 	}
 }
 
+func TestNotificationsForUser_InboxStatuses(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	defer func(statuses []string) {
+		setting.Service.NotificationInboxStatuses = statuses
+	}(setting.Service.NotificationInboxStatuses)
+
+	setting.Service.NotificationInboxStatuses = []string{"unread", "unknown"}
+	assert.Equal(t, []NotificationStatus{NotificationStatusUnread}, InboxStatuses())
+	notfs, err := NotificationsForUser(user, nil, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, notfs, 2)
+	cnt, err := GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	// pinned notifications are in the inbox of this deployment
+	setting.Service.NotificationInboxStatuses = []string{"unread", "pinned"}
+	assert.Equal(t, []NotificationStatus{NotificationStatusUnread, NotificationStatusPinned}, InboxStatuses())
+	notfs, err = NotificationsForUser(user, nil, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, notfs, 3)
+	cnt, err = GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+	cnt, err = GetInboxNotificationCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, cnt)
+
+	setting.Service.NotificationInboxStatuses = nil
+	assert.Equal(t, []NotificationStatus{NotificationStatusUnread}, InboxStatuses())
+}
+
 func TestNotification_GetRepo(t *testing.T) {
 	assert.NoError(t, PrepareTestDatabase())
 	notf := AssertExistsAndLoadBean(t, &Notification{RepoID: 1}).(*Notification)
@@ -71,6 +145,104 @@ func TestGetNotificationCount(t *testing.T) {
 	assert.EqualValues(t, 1, cnt)
 }
 
+func TestSetNotificationStatus_Retried(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+	before := CollectNotificationMetrics()
+
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusRead))
+	first := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Equal(t, NotificationStatusRead, first.Status)
+
+	// the retry does not change the notification again
+	_, err := x.ID(4).Cols("updated_unix").NoAutoTime().Update(&Notification{UpdatedUnix: 100})
+	assert.NoError(t, err)
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusRead))
+	retried := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.EqualValues(t, 100, retried.UpdatedUnix)
+	assert.Equal(t, first.ReadUnix, retried.ReadUnix)
+
+	assert.EqualValues(t, 1, CollectNotificationMetrics().ReadTotal-before.ReadTotal)
+}
+
+func TestNotification_ActionSinceRead(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 1}).(*User)
+
+	assert.NoError(t, SetNotificationStatus(1, user, NotificationStatusRead))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.Equal(t, "open", notf.ReadSubjectState)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Empty(t, notf.APIFormat("en-US").ActionSinceRead)
+
+	// issue 1 is closed after the user read the notification
+	_, err := x.ID(1).Cols("is_closed").Update(&Issue{IsClosed: true})
+	assert.NoError(t, err)
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Equal(t, NotificationActionClosed, notf.APIFormat("en-US").ActionSinceRead)
+
+	// reading it again catches up
+	assert.NoError(t, SetNotificationStatus(1, user, NotificationStatusPinned))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Empty(t, notf.ActionSinceRead())
+
+	_, err = x.ID(1).Cols("is_closed").Update(&Issue{IsClosed: false})
+	assert.NoError(t, err)
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Equal(t, NotificationActionReopened, notf.ActionSinceRead())
+}
+
+func TestUpdateNotificationStatuses_ReadSubjectState(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// pull 2 of notification 2 is merged, issue 5 of notification 4 is closed
+	_, err := x.ID(2).Cols("status").Update(&Notification{Status: NotificationStatusUnread})
+	assert.NoError(t, err)
+	assert.NoError(t, UpdateNotificationStatuses(user, NotificationStatusUnread, NotificationStatusRead))
+
+	assert.Equal(t, "merged", AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification).ReadSubjectState)
+	assert.Equal(t, "closed", AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification).ReadSubjectState)
+	// issue 4 of notification 5 is closed too, the other notifications were not affected
+	assert.Equal(t, "closed", AssertExistsAndLoadBean(t, &Notification{ID: 5}).(*Notification).ReadSubjectState)
+	assert.Empty(t, AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification).ReadSubjectState)
+}
+
+func TestPinNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	assert.NoError(t, PinNotification(4, user, "  waiting on\nQA\t"))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Equal(t, NotificationStatusPinned, notf.Status)
+	assert.Equal(t, "waiting on QA", notf.PinNote)
+	thread := notf.APIFormat("en-US")
+	assert.True(t, thread.Pinned)
+	assert.Equal(t, "waiting on QA", thread.PinNote)
+
+	// long notes are truncated
+	assert.NoError(t, PinNotification(4, user, strings.Repeat("é", maxNotificationPinNoteLength+10)))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Equal(t, strings.Repeat("é", maxNotificationPinNoteLength), notf.PinNote)
+
+	// unpinning clears the note
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusRead))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Equal(t, NotificationStatusRead, notf.Status)
+	assert.Empty(t, notf.PinNote)
+	assert.Empty(t, notf.APIFormat("en-US").PinNote)
+
+	assert.NoError(t, PinNotification(4, user, "later"))
+	assert.NoError(t, UpdateNotificationStatuses(user, NotificationStatusPinned, NotificationStatusRead))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Empty(t, notf.PinNote)
+
+	assert.True(t, IsErrNotificationForbidden(PinNotification(1, user, "not mine")))
+}
+
 func TestSetNotificationStatus(t *testing.T) {
 	assert.NoError(t, PrepareTestDatabase())
 	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
@@ -101,3 +273,2824 @@ func TestUpdateNotificationStatuses(t *testing.T) {
 	AssertExistsAndLoadBean(t,
 		&Notification{ID: notfPinned.ID, Status: NotificationStatusPinned})
 }
+
+func TestNotification_MarshalJSON(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.NotNil(t, notf.Issue.Repo)
+
+	data, err := json.Marshal(notf)
+	assert.NoError(t, err)
+
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	assert.EqualValues(t, 1, fields["id"])
+	assert.Equal(t, "unread", fields["status"])
+	assert.Equal(t, "issue", fields["source"])
+	assert.EqualValues(t, notf.RepoID, fields["repo_id"])
+	assert.Equal(t, notf.Repository.HTMLURL(), fields["repo_url"])
+	assert.EqualValues(t, notf.IssueID, fields["issue_id"])
+	assert.Equal(t, notf.Issue.HTMLURL(), fields["issue_url"])
+	for _, key := range []string{"Issue", "Repository", "Comment", "User"} {
+		assert.NotContains(t, fields, key)
+	}
+	for _, value := range fields {
+		_, isObject := value.(map[string]interface{})
+		assert.False(t, isObject)
+	}
+}
+
+func TestGetNotifications_NeverRead(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// notification 4 gets read and reopened, notification 5 has never been read
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusRead))
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusUnread))
+	reopened := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, reopened.Status)
+	assert.NotZero(t, reopened.FirstReadUnix)
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: user.ID, NeverRead: true})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 5, nl[0].ID)
+	}
+
+	nl, err = GetNotifications(FindNotificationOptions{UserID: user.ID, Status: NotificationStatusUnread})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+}
+
+func TestReassignNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 1 gets a more recent notification on issue 2, which user 2 already has
+	newer := &Notification{
+		UserID:    1,
+		RepoID:    1,
+		Status:    NotificationStatusUnread,
+		Source:    NotificationSourcePullRequest,
+		IssueID:   2,
+		UpdatedBy: 4,
+	}
+	AssertSuccessfulInsert(t, newer)
+
+	affected, err := ReassignNotifications(1, 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, affected)
+
+	AssertNotExistsBean(t, &Notification{UserID: 1})
+	AssertNotExistsBean(t, &Notification{ID: 2})
+	AssertExistsAndLoadBean(t, &Notification{ID: newer.ID, UserID: 2, IssueID: 2})
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, UserID: 2, IssueID: 1})
+	AssertNotExistsBean(t, &Notification{UpdatedBy: 1})
+	assert.EqualValues(t, 5, GetCount(t, &Notification{UserID: 2}))
+}
+
+func TestReassignNotifications_SourceAndDeleted(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user2 := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// user 2 has a pull request notification on issue 2, user 1 a commit notification on the same issue
+	commit := &Notification{UserID: 1, RepoID: 1, Status: NotificationStatusUnread, Source: NotificationSourceCommit,
+		IssueID: 2, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d"}
+	AssertSuccessfulInsert(t, commit)
+	// and a notification on issue 5, which user 2 has deleted
+	assert.NoError(t, DeleteNotification(4, user2))
+	issue := &Notification{UserID: 1, RepoID: 1, Status: NotificationStatusUnread, Source: NotificationSourceIssue, IssueID: 5}
+	AssertSuccessfulInsert(t, issue)
+
+	_, err := ReassignNotifications(1, 2)
+	assert.NoError(t, err)
+
+	AssertExistsAndLoadBean(t, &Notification{ID: 2, UserID: 2})
+	AssertExistsAndLoadBean(t, &Notification{ID: commit.ID, UserID: 2})
+	AssertExistsAndLoadBean(t, &Notification{ID: issue.ID, UserID: 2})
+	AssertExistsAndLoadBean(t, &Notification{ID: 4, UserID: 2})
+}
+
+func TestMarkIssueNotificationReadForUser(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	assert.NoError(t, MarkIssueNotificationReadForUser(2, 5))
+	AssertExistsAndLoadBean(t, &Notification{ID: 4, Status: NotificationStatusRead})
+
+	// pinned notifications are left untouched
+	assert.NoError(t, MarkIssueNotificationReadForUser(2, 3))
+	AssertExistsAndLoadBean(t, &Notification{ID: 3, Status: NotificationStatusPinned})
+
+	// no notification for this user and issue
+	assert.NoError(t, MarkIssueNotificationReadForUser(4, 5))
+	AssertNotExistsBean(t, &Notification{UserID: 4, IssueID: 5})
+}
+
+func TestSyncNotificationSourceForIssue(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 1 of notification 1 becomes a pull request, commit notifications referencing it are kept
+	AssertSuccessfulInsert(t, &Notification{UserID: 4, RepoID: 1, IssueID: 1, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d", Source: NotificationSourceCommit, Status: NotificationStatusRead})
+	_, err := x.ID(1).Cols("is_pull").Update(&Issue{IsPull: true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, SyncNotificationSourceForIssue(1))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.Equal(t, NotificationSourcePullRequest, notf.Source)
+	assert.EqualValues(t, 946684820, notf.UpdatedUnix)
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1, Source: NotificationSourceCommit})
+
+	// and back
+	_, err = x.ID(1).Cols("is_pull").Update(&Issue{IsPull: false})
+	assert.NoError(t, err)
+	assert.NoError(t, SyncNotificationSourceForIssue(1))
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Source: NotificationSourceIssue})
+
+	assert.True(t, IsErrIssueNotExist(SyncNotificationSourceForIssue(NonexistentID)))
+
+	// a conversion syncs the sources in its own transaction, so a rollback keeps them in sync with IsPull
+	sess := x.NewSession()
+	defer sess.Close()
+	assert.NoError(t, sess.Begin())
+	issue := &Issue{ID: 1, IsPull: true}
+	_, err = sess.ID(issue.ID).Cols("is_pull").Update(issue)
+	assert.NoError(t, err)
+	assert.NoError(t, syncNotificationSourceForIssue(sess, issue))
+	assert.NoError(t, sess.Rollback())
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Source: NotificationSourceIssue})
+}
+
+func TestCreateReopenNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	watcher := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	// user 4 watches repo 1 and has read the thread of issue 1
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification)
+	assert.NoError(t, SetNotificationStatus(notf.ID, watcher, NotificationStatusRead))
+
+	assert.NoError(t, CreateReopenNotifications(1, 2))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: notf.ID}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationActionReopened, notf.Action)
+	assert.EqualValues(t, 2, notf.UpdatedBy)
+
+	// the actor is not notified
+	AssertNotExistsBean(t, &Notification{UserID: 2, IssueID: 1})
+}
+
+func TestSeedNotificationsForPastParticipants(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// users 3 and 5 commented on issue 1, add a third commenter
+	AssertSuccessfulInsert(t, &Comment{Type: CommentTypeComment, PosterID: 4, IssueID: 1, Content: "+1"})
+	AssertSuccessfulInsert(t, &Comment{Type: CommentTypeComment, PosterID: 4, IssueID: 1, Content: "+2"})
+
+	seeded, err := SeedNotificationsForPastParticipants(1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, seeded)
+	for _, userID := range []int64{3, 4, 5} {
+		AssertExistsAndLoadBean(t, &Notification{UserID: userID, IssueID: 1, Status: NotificationStatusRead})
+	}
+	AssertCount(t, &Notification{IssueID: 1}, 4)
+
+	// existing recipients are skipped
+	seeded, err = SeedNotificationsForPastParticipants(1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, seeded)
+
+	_, err = SeedNotificationsForPastParticipants(NonexistentID)
+	assert.True(t, IsErrIssueNotExist(err))
+}
+
+func TestIssue_ChangeStatus_MarksCloserNotificationRead(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	closer := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// user 2 closes their own issue 5
+	_, err := x.ID(5).Cols("is_closed").Update(&Issue{IsClosed: false})
+	assert.NoError(t, err)
+	issue := AssertExistsAndLoadBean(t, &Issue{ID: 5}).(*Issue)
+	_, err = issue.ChangeStatus(closer, true)
+	assert.NoError(t, err)
+	AssertExistsAndLoadBean(t, &Notification{ID: 4, Status: NotificationStatusRead})
+
+	// closing an issue the closer has no notification for is fine, others keep theirs
+	issue = AssertExistsAndLoadBean(t, &Issue{ID: 1}).(*Issue)
+	_, err = issue.ChangeStatus(closer, true)
+	assert.NoError(t, err)
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Status: NotificationStatusUnread})
+}
+
+func TestGetNotifications_OnlyAssigned(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+
+	// user 1 is assigned to issue 1
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 1, OnlyAssigned: true})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 1, nl[0].ID)
+		assert.EqualValues(t, 1, nl[0].IssueID)
+	}
+
+	// user 4 only watches the repository
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1})
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 4, OnlyAssigned: true})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+}
+
+func TestCreateNotification_DefaultStatus(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 1}).(*User)
+
+	commit := &Notification{
+		UserID:    user.ID,
+		RepoID:    1,
+		Source:    NotificationSourceCommit,
+		CommitID:  "65f1bf27bc3bf70f64657658635e66094edbcb4d",
+		Status:    NotificationStatusRead,
+		UpdatedBy: 2,
+	}
+	assert.NoError(t, createNotification(x, commit))
+	AssertExistsAndLoadBean(t, &Notification{ID: commit.ID, Status: NotificationStatusRead})
+
+	cnt, err := GetNotificationCount(user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// notifications start unread by default, whatever their source
+	commit = &Notification{
+		UserID:    user.ID,
+		RepoID:    1,
+		Source:    NotificationSourceCommit,
+		CommitID:  "2a47ca4b614a9f5a43abbd5ad851a54a616ffee6",
+		UpdatedBy: 2,
+	}
+	assert.NoError(t, createNotification(x, commit))
+	AssertExistsAndLoadBean(t, &Notification{ID: commit.ID, Status: NotificationStatusUnread})
+
+	issue := AssertExistsAndLoadBean(t, &Issue{ID: 2}).(*Issue)
+	assert.NoError(t, createIssueNotification(x, user.ID, issue, 0, 2, 0, NotificationReasonSubscribed, NotificationActionCommented))
+	AssertExistsAndLoadBean(t, &Notification{UserID: user.ID, IssueID: issue.ID, Status: NotificationStatusUnread})
+
+	issue = AssertExistsAndLoadBean(t, &Issue{ID: 3}).(*Issue)
+	assert.NoError(t, createIssueNotification(x, user.ID, issue, 0, 2, NotificationStatusRead, NotificationReasonSubscribed, NotificationActionCommented))
+	AssertExistsAndLoadBean(t, &Notification{UserID: user.ID, IssueID: issue.ID, Status: NotificationStatusRead})
+}
+
+func TestSetNotificationStatusAndCount(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	cnt, err := SetNotificationStatusAndCount(4, user, NotificationStatusRead)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	AssertExistsAndLoadBean(t, &Notification{ID: 4, Status: NotificationStatusRead})
+
+	cnt, err = SetNotificationStatusAndCount(5, user, NotificationStatusRead)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, cnt)
+
+	// the count matches the notification badge, which does not count snoozed notifications
+	assert.NoError(t, SnoozeNotification(5, user, timeutil.TimeStampNow()+3600))
+	cnt, err = SetNotificationStatusAndCount(4, user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+	cnt, err = SetNotificationStatusAndCount(5, user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	badge, err := GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.Equal(t, badge, cnt)
+
+	_, err = SetNotificationStatusAndCount(1, user, NotificationStatusRead)
+	assert.Error(t, err)
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Status: NotificationStatusUnread})
+}
+
+func TestSeedIssueNotificationOnSubscribe(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	assert.NoError(t, CreateOrUpdateIssueWatch(4, 2, true))
+	assert.NoError(t, SeedIssueNotificationOnSubscribe(4, 2))
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 2, Status: NotificationStatusRead})
+
+	// existing notifications are kept as they are
+	assert.NoError(t, SeedIssueNotificationOnSubscribe(1, 1))
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Status: NotificationStatusUnread})
+	assert.EqualValues(t, 1, GetCount(t, &Notification{UserID: 1, IssueID: 1}))
+}
+
+func TestNotificationList_LoadParticipants(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 1 already has comments of user 3 and 5
+	for _, posterID := range []int64{1, 3, 2, 4, 6} {
+		AssertSuccessfulInsert(t, &Comment{Type: CommentTypeComment, PosterID: posterID, IssueID: 1})
+	}
+	AssertSuccessfulInsert(t, &Comment{Type: CommentTypeComment, PosterID: NonexistentID, IssueID: 4})
+
+	commit := &Notification{UserID: 2, RepoID: 1, Source: NotificationSourceCommit, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d"}
+	nl := NotificationList{
+		AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification),
+		AssertExistsAndLoadBean(t, &Notification{ID: 5}).(*Notification),
+		commit,
+	}
+	assert.NoError(t, nl.LoadParticipants())
+
+	var participantIDs []int64
+	for _, participant := range nl[0].Participants {
+		participantIDs = append(participantIDs, participant.ID)
+	}
+	assert.Equal(t, []int64{3, 5, 1, 2, 4}, participantIDs)
+
+	if assert.Len(t, nl[1].Participants, 1) {
+		assert.True(t, nl[1].Participants[0].IsGhost())
+	}
+
+	assert.NotNil(t, commit.Participants)
+	assert.Len(t, commit.Participants, 0)
+
+	assert.NoError(t, nl[0].LoadAttributes())
+	assert.Len(t, nl[0].APIFormat("en-US").Subject.Participants, 5)
+}
+
+func TestSetNotificationsReadByLabel(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// issue 5 has label 2, issue 4 has no labels
+	affected, err := SetNotificationsReadByLabel(user, 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, affected)
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 4, Status: NotificationStatusRead}).(*Notification)
+	assert.NotZero(t, notf.FirstReadUnix)
+	AssertExistsAndLoadBean(t, &Notification{ID: 5, Status: NotificationStatusUnread})
+
+	// issue 1 has label 1 but its notification belongs to user 1
+	affected, err = SetNotificationsReadByLabel(user, 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, affected)
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Status: NotificationStatusUnread})
+}
+
+func TestNotificationsForUserPaged(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+	statuses := []NotificationStatus{NotificationStatusRead, NotificationStatusUnread}
+
+	// exactly one full page
+	nl, hasNext, err := NotificationsForUserPaged(user, statuses, 1, 3)
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, nl, 3)
+
+	nl, hasNext, err = NotificationsForUserPaged(user, statuses, 1, 2)
+	assert.NoError(t, err)
+	assert.True(t, hasNext)
+	if assert.Len(t, nl, 2) {
+		assert.EqualValues(t, 5, nl[0].ID)
+		assert.EqualValues(t, 4, nl[1].ID)
+	}
+
+	// partial last page
+	nl, hasNext, err = NotificationsForUserPaged(user, statuses, 2, 2)
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 2, nl[0].ID)
+	}
+}
+
+func TestBroadcastSystemNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	activeUsers := GetCount(t, &User{}, Cond("`type` = ? AND is_active = ?", UserTypeIndividual, true))
+
+	cnt, err := BroadcastSystemNotification("Scheduled maintenance", "https://example.com/maintenance", 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, activeUsers, cnt)
+
+	// user 9 is inactive and user 3 is an organization
+	AssertNotExistsBean(t, &Notification{UserID: 9, Source: NotificationSourceSystem})
+	AssertNotExistsBean(t, &Notification{UserID: 3, Source: NotificationSourceSystem})
+
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 2, Source: NotificationSourceSystem}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Equal(t, "https://example.com/maintenance", notf.HTMLURL())
+
+	thread := notf.APIFormat("en-US")
+	assert.Equal(t, "System", thread.Subject.Type)
+	assert.Equal(t, "Scheduled maintenance", thread.Subject.Title)
+	assert.Equal(t, "https://example.com/maintenance", thread.Subject.URL)
+
+	nl, err := NotificationsForUser(&User{ID: 2}, []NotificationStatus{NotificationStatusUnread}, 1, 10)
+	assert.NoError(t, err)
+	_, err = nl.LoadRepos()
+	assert.NoError(t, err)
+	assert.NoError(t, nl.LoadIssues())
+	assert.NoError(t, nl.LoadComments())
+}
+
+func TestBroadcastSystemNotification_LongTitle(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	_, err := BroadcastSystemNotification(strings.Repeat("ü", 300), "https://example.com/maintenance", 1)
+	assert.NoError(t, err)
+
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 2, Source: NotificationSourceSystem}).(*Notification)
+	assert.Equal(t, strings.Repeat("ü", 255), notf.SubjectTitle)
+}
+
+func TestWakeConditionalSnoozes(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// snooze notification 4 until issue 5 is closed
+	_, err := x.ID(5).Cols("is_closed").Update(&Issue{IsClosed: false})
+	assert.NoError(t, err)
+	assert.NoError(t, SnoozeNotificationUntilCondition(4, user, NotificationSnoozeUntilIssueClosed))
+	cnt, err := GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// snooze notification 3 until pull 3 is mergeable
+	_, err = x.Where("issue_id = ?", 3).Cols("status").Update(&PullRequest{Status: PullRequestStatusChecking})
+	assert.NoError(t, err)
+	assert.NoError(t, SnoozeNotificationUntilCondition(3, user, NotificationSnoozeUntilPRMergeable))
+
+	woken, err := WakeConditionalSnoozes()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, woken)
+
+	_, err = x.ID(5).Cols("is_closed").Update(&Issue{IsClosed: true})
+	assert.NoError(t, err)
+	woken, err = WakeConditionalSnoozes()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, woken)
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Empty(t, notf.SnoozeCondition)
+	assert.EqualValues(t, 0, notf.SnoozedUntilUnix)
+	cnt, err = GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	_, err = x.Where("issue_id = ?", 3).Cols("status").Update(&PullRequest{Status: PullRequestStatusMergeable})
+	assert.NoError(t, err)
+	woken, err = WakeConditionalSnoozes()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, woken)
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 3}).(*Notification)
+	assert.Empty(t, notf.SnoozeCondition)
+
+	// conditions must fit the subject
+	assert.Error(t, SnoozeNotificationUntilCondition(4, user, NotificationSnoozeUntilPRMergeable))
+	assert.Error(t, SnoozeNotificationUntilCondition(4, user, "unknown"))
+}
+
+func TestGetEffectiveUnreadCount(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	cnt, err := GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	assert.NoError(t, SnoozeNotification(4, user, timeutil.TimeStampNow().Add(3600)))
+	cnt, err = GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, cnt)
+
+	// the plain status count still includes the snoozed notification
+	cnt, err = GetNotificationCount(user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	// the notification wakes up once the snooze time has passed
+	assert.NoError(t, SnoozeNotification(4, user, timeutil.TimeStampNow().Add(-1)))
+	cnt, err = GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, cnt)
+
+	assert.Error(t, SnoozeNotification(1, user, timeutil.TimeStampNow().Add(3600)))
+}
+
+func TestNotification_RefURL(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	for _, test := range []struct {
+		Notification *Notification
+		URL          string
+	}{
+		{
+			&Notification{Source: NotificationSourceIssue, RepoID: 1, IssueID: 1},
+			"https://try.gitea.io/user2/repo1/issues/1",
+		},
+		{
+			&Notification{Source: NotificationSourceIssue, RepoID: 1, IssueID: 1, CommentID: 2},
+			"https://try.gitea.io/user2/repo1/issues/1#issuecomment-2",
+		},
+		{
+			&Notification{Source: NotificationSourcePullRequest, RepoID: 1, IssueID: 2},
+			"https://try.gitea.io/user2/repo1/pulls/2",
+		},
+		{
+			&Notification{Source: NotificationSourceCommit, RepoID: 1, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d"},
+			"https://try.gitea.io/user2/repo1/commit/65f1bf27bc3bf70f64657658635e66094edbcb4d",
+		},
+		{
+			&Notification{Source: NotificationSourceSystem, SubjectURL: "https://example.com/maintenance"},
+			"https://example.com/maintenance",
+		},
+	} {
+		url, err := test.Notification.RefURL()
+		assert.NoError(t, err)
+		assert.Equal(t, test.URL, url)
+		assert.Equal(t, test.URL, test.Notification.HTMLURL())
+	}
+
+	_, err := (&Notification{Source: NotificationSourceIssue, RepoID: 1, IssueID: NonexistentID}).RefURL()
+	assert.Error(t, err)
+	assert.Empty(t, (&Notification{Source: NotificationSourceCommit, RepoID: NonexistentID}).HTMLURL())
+}
+
+func TestNotificationList_LoadRefs(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	nl := NotificationList{
+		&Notification{Source: NotificationSourceIssue, RepoID: 1, IssueID: 1},
+		&Notification{Source: NotificationSourcePullRequest, RepoID: 1, IssueID: 2, CommentID: 4},
+	}
+	_, err := nl.LoadRepos()
+	assert.NoError(t, err)
+	assert.NoError(t, nl.LoadIssues())
+	assert.NoError(t, nl.LoadComments())
+
+	// everything needed for the URLs is loaded together for the whole list
+	for _, n := range nl {
+		assert.NotNil(t, n.Repository.Units)
+		assert.Equal(t, n.Repository, n.Issue.Repo)
+	}
+	if assert.NotNil(t, nl[1].Comment.Review) {
+		assert.EqualValues(t, 4, nl[1].Comment.Review.ID)
+	}
+
+	assert.Equal(t, "https://try.gitea.io/user2/repo1/issues/1", nl[0].HTMLURL())
+	assert.Equal(t, "https://try.gitea.io/user2/repo1/pulls/2/files#issuecomment-4", nl[1].HTMLURL())
+}
+
+func TestAllUnreadNotificationsOrdered(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// same updated time as notification 4, the higher ID comes first
+	AssertSuccessfulInsert(t, &Notification{UserID: user.ID, RepoID: 1, Status: NotificationStatusUnread, Source: NotificationSourceIssue, IssueID: 6})
+	_, err := x.Exec("UPDATE notification SET updated_unix = ? WHERE issue_id = 6", 946687800)
+	assert.NoError(t, err)
+	newest := &Notification{UserID: user.ID, RepoID: 1, Status: NotificationStatusUnread, Source: NotificationSourceIssue, IssueID: 7}
+	AssertSuccessfulInsert(t, newest)
+
+	nl, err := AllUnreadNotificationsOrdered(user)
+	assert.NoError(t, err)
+	var ids []int64
+	for _, n := range nl {
+		ids = append(ids, n.ID)
+	}
+	assert.Equal(t, []int64{newest.ID, 5, newest.ID - 1, 4}, ids)
+
+	defer func(size int) {
+		setting.UI.Notification.MaxUnreadListSize = size
+	}(setting.UI.Notification.MaxUnreadListSize)
+	setting.UI.Notification.MaxUnreadListSize = 2
+	nl, err = AllUnreadNotificationsOrdered(user)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+}
+
+func TestGetNotifications_CreatedWindow(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// notifications 2 to 5 of user 2 are created at 946685800, 946686800, 946687800 and 946688800
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 2, CreatedAfterUnix: 946686800, CreatedBeforeUnix: 946687800})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 2) {
+		assert.EqualValues(t, 4, nl[0].ID)
+		assert.EqualValues(t, 3, nl[1].ID)
+	}
+
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 2, CreatedAfterUnix: 946687801})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 5, nl[0].ID)
+	}
+
+	// bumping a notification does not change its creation time
+	_, err = x.Exec("UPDATE notification SET updated_unix = ? WHERE id = 2", 946689000)
+	assert.NoError(t, err)
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 2, CreatedBeforeUnix: 946685800})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 2, nl[0].ID)
+	}
+}
+
+func TestCreatePRPushNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 2 is a pull request of user 1, user 2 has already read its notification
+	assert.NoError(t, CreatePRPushNotification(2, 1, []int64{1, 2, 4, 4}))
+
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonPush, notf.Reason)
+	assert.EqualValues(t, 1, notf.UpdatedBy)
+	assert.True(t, notf.UpdatedUnix > 946685820)
+	assert.EqualValues(t, 1, GetCount(t, &Notification{UserID: 2, IssueID: 2}))
+
+	notf = AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonPush, notf.Reason)
+	assert.EqualValues(t, 1, GetCount(t, &Notification{UserID: 4, IssueID: 2}))
+
+	AssertNotExistsBean(t, &Notification{UserID: 1, IssueID: 2})
+
+	assert.Error(t, CreatePRPushNotification(1, 1, []int64{2}))
+}
+
+func TestResetUserNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	deleted, err := ResetUserNotifications(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, deleted)
+	AssertNotExistsBean(t, &Notification{UserID: user.ID})
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, UserID: 1})
+
+	deleted, err = ResetUserNotifications(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, deleted)
+
+	_, err = ResetUserNotifications(&User{})
+	assert.Error(t, err)
+	_, err = ResetUserNotifications(NewGhostUser())
+	assert.Error(t, err)
+	AssertExistsAndLoadBean(t, &Notification{ID: 1})
+}
+
+func TestDeleteOrphanedNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	deleted, err := DeleteOrphanedNotifications()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, deleted)
+
+	_, err = x.ID(2).Delete(new(User))
+	assert.NoError(t, err)
+
+	deleted, err = DeleteOrphanedNotifications()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, deleted)
+	AssertNotExistsBean(t, &Notification{UserID: 2})
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, UserID: 1})
+}
+
+func TestDeleteNotification_Restore(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	assert.NoError(t, DeleteNotification(4, user))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.NotZero(t, notf.DeletedUnix)
+
+	// deleted notifications are hidden from listings and counts
+	nl, err := GetNotifications(FindNotificationOptions{UserID: user.ID})
+	assert.NoError(t, err)
+	for _, n := range nl {
+		assert.NotEqual(t, int64(4), n.ID)
+	}
+	count, err := GetNotificationCount(user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	_, err = GetOwnedNotification(user, 4)
+	assert.True(t, IsErrNotificationNotExist(err))
+
+	// notifications of other users can not be deleted nor restored
+	assert.True(t, IsErrNotificationForbidden(DeleteNotification(1, user)))
+	assert.True(t, IsErrNotificationForbidden(RestoreNotification(4, AssertExistsAndLoadBean(t, &User{ID: 1}).(*User))))
+
+	assert.NoError(t, RestoreNotification(4, user))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification)
+	assert.Zero(t, notf.DeletedUnix)
+	count, err = GetNotificationCount(user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	// restoring a notification which is not deleted does nothing
+	assert.NoError(t, RestoreNotification(4, user))
+}
+
+func TestDeleteNotification_RestoreConflict(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 1}).(*User)
+
+	// a new notification of the thread is created while the old one is deleted
+	assert.NoError(t, DeleteNotification(1, user))
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	nl, err := GetNotifications(FindNotificationOptions{UserID: user.ID, IssueID: 1})
+	assert.NoError(t, err)
+	if !assert.Len(t, nl, 1) {
+		return
+	}
+	assert.NotEqual(t, int64(1), nl[0].ID)
+
+	err = RestoreNotification(1, user)
+	assert.True(t, IsErrNotificationRestoreConflict(err))
+	assert.EqualValues(t, nl[0].ID, err.(ErrNotificationRestoreConflict).ExistingID)
+	assert.NotZero(t, AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification).DeletedUnix)
+	AssertCount(t, &Notification{UserID: user.ID, IssueID: 1}, 2)
+}
+
+func TestDeleteNotification_Purge(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	assert.NoError(t, DeleteNotification(4, user))
+	assert.NoError(t, DeleteNotification(5, user))
+
+	// the grace period of notification 5 is over
+	expired := timeutil.TimeStampNow().AddDuration(-setting.Cron.PurgeDeletedNotifications.OlderThan - time.Hour)
+	_, err := x.Exec("UPDATE notification SET deleted_unix = ? WHERE id = ?", expired, 5)
+	assert.NoError(t, err)
+	assert.True(t, IsErrNotificationRestoreExpired(RestoreNotification(5, user)))
+
+	purged, err := PurgeDeletedNotifications(timeutil.TimeStampNow().AddDuration(-setting.Cron.PurgeDeletedNotifications.OlderThan))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, purged)
+	AssertNotExistsBean(t, &Notification{ID: 5})
+	AssertExistsAndLoadBean(t, &Notification{ID: 4})
+	assert.True(t, IsErrNotificationNotExist(RestoreNotification(5, user)))
+
+	// notifications which are not deleted are never purged
+	purged, err = PurgeDeletedNotifications(timeutil.TimeStampNow().Add(1))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, purged)
+	AssertNotExistsBean(t, &Notification{ID: 4})
+	AssertExistsAndLoadBean(t, &Notification{ID: 3})
+}
+
+func TestRegisterNotificationSubjectBuilder(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	const source NotificationSource = 100
+	defer delete(notificationSubjectBuilders, source)
+	RegisterNotificationSubjectBuilder(source, func(n *Notification) *api.NotificationSubject {
+		return &api.NotificationSubject{Type: "Custom", Title: n.SubjectTitle}
+	})
+
+	thread := (&Notification{ID: 1, Source: source, SubjectTitle: "custom title"}).APIFormat("en-US")
+	assert.Equal(t, "Custom", thread.Subject.Type)
+	assert.Equal(t, "custom title", thread.Subject.Title)
+
+	// default builders are registered for the existing sources
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	thread = notf.APIFormat("en-US")
+	assert.Equal(t, "Issue", thread.Subject.Type)
+	assert.Equal(t, notf.Issue.Title, thread.Subject.Title)
+	assert.Equal(t, "Commit", (&Notification{Source: NotificationSourceCommit}).APIFormat("en-US").Subject.Type)
+}
+
+func TestGetNotificationByRepoIssueIndex(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 5 has index 4 in repository 1
+	notf, exist, err := GetNotificationByRepoIssueIndex(2, 1, 4)
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	if assert.NotNil(t, notf) {
+		assert.EqualValues(t, 4, notf.ID)
+		assert.EqualValues(t, 5, notf.Issue.ID)
+	}
+
+	notf, exist, err = GetNotificationByRepoIssueIndex(4, 1, 4)
+	assert.NoError(t, err)
+	assert.False(t, exist)
+	assert.Nil(t, notf)
+
+	_, exist, err = GetNotificationByRepoIssueIndex(2, 1, NonexistentID)
+	assert.True(t, IsErrIssueNotExist(err))
+	assert.False(t, exist)
+}
+
+func TestCreateOrUpdateIssueNotificationsForEvent(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 6 is posted by user 1, who does not watch it
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(6, 0, 2, NotificationEventComment))
+	AssertNotExistsBean(t, &Notification{UserID: 1, IssueID: 6})
+
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(6, 0, 2, NotificationEventClose))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 1, IssueID: 6}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.EqualValues(t, 2, notf.UpdatedBy)
+
+	// the poster is never notified about own state changes
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(6, 0, 1, NotificationEventClose))
+	AssertNotExistsBean(t, &Notification{UserID: 2, IssueID: 6})
+	AssertExistsAndLoadBean(t, &Notification{UserID: 1, IssueID: 6, UpdatedBy: 2})
+}
+
+func TestIterateNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	for i := int64(1); i <= 50; i++ {
+		AssertSuccessfulInsert(t, &Notification{UserID: 10, RepoID: 1, Status: NotificationStatusUnread, Source: NotificationSourceIssue, IssueID: i})
+	}
+
+	visited := make(map[int64]int, 50)
+	assert.NoError(t, IterateNotifications(FindNotificationOptions{UserID: 10}, 7, func(n *Notification) error {
+		assert.EqualValues(t, 10, n.UserID)
+		visited[n.ID]++
+		return nil
+	}))
+	assert.Len(t, visited, 50)
+	for _, cnt := range visited {
+		assert.Equal(t, 1, cnt)
+	}
+
+	var calls int
+	err := IterateNotifications(FindNotificationOptions{UserID: 10}, 7, func(n *Notification) error {
+		calls++
+		if calls == 10 {
+			return fmt.Errorf("stop")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "stop")
+	assert.Equal(t, 10, calls)
+}
+
+func TestMarkAllReadKeepPinned(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	affected, err := MarkAllReadKeepPinned(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, affected)
+
+	AssertExistsAndLoadBean(t, &Notification{ID: 3, Status: NotificationStatusPinned})
+	for _, id := range []int64{2, 4, 5} {
+		AssertExistsAndLoadBean(t, &Notification{ID: id, Status: NotificationStatusRead})
+	}
+	AssertExistsAndLoadBean(t, &Notification{ID: 1, Status: NotificationStatusUnread})
+}
+
+func TestNotification_IconName(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	for _, test := range []struct {
+		Source   NotificationSource
+		IssueID  int64
+		IconName string
+	}{
+		{NotificationSourceIssue, 1, "issue-opened"},
+		{NotificationSourceIssue, 5, "issue-closed"},
+		{NotificationSourcePullRequest, 3, "git-pull-request"},
+		{NotificationSourceCommit, 0, "git-commit"},
+		{NotificationSourceSystem, 0, "megaphone"},
+	} {
+		notf := &Notification{Source: test.Source, IssueID: test.IssueID}
+		if test.IssueID > 0 {
+			notf.Issue = AssertExistsAndLoadBean(t, &Issue{ID: test.IssueID}).(*Issue)
+		}
+		assert.Equal(t, test.IconName, notf.IconName())
+	}
+
+	// pull request 1 of issue 2 has been merged
+	notf := &Notification{ID: 2, UserID: 2, RepoID: 1, Source: NotificationSourcePullRequest, IssueID: 2}
+	assert.NoError(t, notf.LoadAttributes())
+	notf.Issue.IsClosed = true
+	assert.Equal(t, "git-merge", notf.APIFormat("en-US").Subject.IconName)
+
+	// lists load the pull requests of all notifications at once
+	nl := NotificationList{
+		{ID: 2, UserID: 2, RepoID: 1, Source: NotificationSourcePullRequest, IssueID: 2},
+		{ID: 3, UserID: 2, RepoID: 1, Source: NotificationSourcePullRequest, IssueID: 3},
+		{ID: 4, UserID: 2, RepoID: 1, Source: NotificationSourceIssue, IssueID: 5},
+	}
+	assert.NoError(t, nl.LoadIssues())
+	if assert.NotNil(t, nl[0].Issue.PullRequest) && assert.NotNil(t, nl[1].Issue.PullRequest) {
+		assert.EqualValues(t, 2, nl[0].Issue.PullRequest.IssueID)
+		assert.EqualValues(t, 3, nl[1].Issue.PullRequest.IssueID)
+	}
+	assert.Nil(t, nl[2].Issue.PullRequest)
+	nl[0].Issue.IsClosed = true
+	assert.Equal(t, "git-merge", nl[0].IconName())
+	assert.Equal(t, "git-pull-request", nl[1].IconName())
+}
+
+func TestLoadAttributesForUserGroups(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	groups := map[int64]NotificationList{
+		1: {{UserID: 1, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue}},
+		2: {
+			{UserID: 2, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue},
+			{UserID: 2, RepoID: 1, IssueID: 2, Source: NotificationSourcePullRequest},
+		},
+	}
+	assert.NoError(t, LoadAttributesForUserGroups(groups))
+
+	for userID, nl := range groups {
+		for _, notf := range nl {
+			assert.NotNil(t, notf.Repository)
+			assert.NotNil(t, notf.Issue)
+			if assert.NotNil(t, notf.User) {
+				assert.EqualValues(t, userID, notf.User.ID)
+			}
+		}
+	}
+	// the issue shared by both users is fetched once
+	assert.True(t, groups[1][0].Issue == groups[2][0].Issue)
+	assert.True(t, groups[1][0].Repository == groups[2][1].Repository)
+
+	assert.NoError(t, LoadAttributesForUserGroups(map[int64]NotificationList{}))
+}
+
+func TestCreateReactionNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// comment 3 on issue 1 has been posted by user 5
+	assert.NoError(t, CreateReactionNotification(1, 3, 5, 5))
+	AssertNotExistsBean(t, &Notification{UserID: 5, IssueID: 1})
+
+	assert.NoError(t, CreateReactionNotification(1, 3, 2, 5))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 5, IssueID: 1}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonReaction, notf.Reason)
+	assert.EqualValues(t, 3, notf.CommentID)
+	assert.EqualValues(t, 2, notf.UpdatedBy)
+
+	// further reactions bump the same notification
+	assert.NoError(t, CreateReactionNotification(1, 3, 4, 5))
+	assert.EqualValues(t, 1, GetCount(t, &Notification{UserID: 5, IssueID: 1}))
+	notf = AssertExistsAndLoadBean(t, &Notification{UserID: 5, IssueID: 1}).(*Notification)
+	assert.EqualValues(t, 4, notf.UpdatedBy)
+}
+
+func TestGetNotifications_ClosedByUser(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	opts := FindNotificationOptions{
+		UserID:       2,
+		Status:       NotificationStatusUnread,
+		ClosedByUser: true,
+	}
+	nl, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+
+	// user 2 closed issue 5 and has read its notification
+	AssertSuccessfulInsert(t, &Comment{Type: CommentTypeClose, PosterID: 2, IssueID: 5})
+	assert.NoError(t, SetNotificationStatus(4, &User{ID: 2}, NotificationStatusRead))
+	assert.NoError(t, CreateOrUpdateIssueWatch(2, 5, true))
+
+	// a new comment of somebody else bumps the notification
+	assert.NoError(t, CreateOrUpdateIssueNotifications(5, 0, 1))
+
+	nl, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 4, nl[0].ID)
+	}
+
+	// the close comment of another user does not count
+	opts.UserID = 4
+	nl, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+}
+
+func TestCreateOrUpdateIssueNotifications_SourceAware(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 1 has an issue notification for issue 1 and gets a commit notification referencing it
+	commitNotf := &Notification{
+		UserID:   1,
+		RepoID:   1,
+		IssueID:  1,
+		CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d",
+		Source:   NotificationSourceCommit,
+		Status:   NotificationStatusRead,
+	}
+	assert.NoError(t, createNotification(x, commitNotf))
+
+	notifications, err := getNotificationsByIssueID(x, 1)
+	assert.NoError(t, err)
+	assert.True(t, notificationExists(notifications, 1, 1, NotificationSourceIssue))
+	assert.True(t, notificationExists(notifications, 1, 1, NotificationSourceCommit))
+	assert.False(t, notificationExists(notifications, 1, 1, NotificationSourcePullRequest))
+
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 2, 2))
+
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.EqualValues(t, 2, notf.UpdatedBy)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: commitNotf.ID}).(*Notification)
+	assert.Equal(t, NotificationSourceCommit, notf.Source)
+	assert.Equal(t, NotificationStatusRead, notf.Status)
+	assert.EqualValues(t, 0, notf.UpdatedBy)
+	assert.EqualValues(t, 2, GetCount(t, &Notification{UserID: 1, IssueID: 1}))
+}
+
+func TestCreateOrUpdateIssueNotificationsConcurrent(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	var sequential, concurrent []*Notification
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(1, 0, 2, NotificationEventClose))
+	assert.NoError(t, x.Where("issue_id = ?", 1).OrderBy("user_id").Find(&sequential))
+
+	assert.NoError(t, PrepareTestDatabase())
+	assert.NoError(t, createOrUpdateIssueNotificationsConcurrent(1, 0, 2, NotificationEventClose, 4))
+	assert.NoError(t, x.Where("issue_id = ?", 1).OrderBy("user_id").Find(&concurrent))
+
+	if assert.Len(t, concurrent, len(sequential)) {
+		for i := range sequential {
+			assert.Equal(t, sequential[i].UserID, concurrent[i].UserID)
+			assert.Equal(t, sequential[i].Status, concurrent[i].Status)
+			assert.Equal(t, sequential[i].UpdatedBy, concurrent[i].UpdatedBy)
+		}
+	}
+	AssertNotExistsBean(t, &Notification{UserID: 2, IssueID: 1})
+}
+
+func BenchmarkCreateOrUpdateIssueNotifications(b *testing.B) {
+	const watchers = 5000
+	assert.NoError(b, PrepareTestDatabase())
+
+	// every watcher is an active user watching repo 1
+	for i := 0; i < watchers; i++ {
+		name := fmt.Sprintf("watcher%d", i)
+		user := &User{Name: name, LowerName: name, Email: name + "@example.com", IsActive: true}
+		_, err := x.Insert(user)
+		assert.NoError(b, err)
+		_, err = x.Insert(&Watch{UserID: user.ID, RepoID: 1, Mode: RepoWatchModeNormal})
+		assert.NoError(b, err)
+	}
+	b.ResetTimer()
+
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if workers == 1 {
+					assert.NoError(b, CreateOrUpdateIssueNotifications(1, 0, 2))
+				} else {
+					assert.NoError(b, createOrUpdateIssueNotificationsConcurrent(1, 0, 2, NotificationEventComment, workers))
+				}
+			}
+		})
+	}
+}
+
+func TestGetMostRecentNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	nl, err := GetMostRecentNotifications(user, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 5, nl[0].ID)
+		assert.NotNil(t, nl[0].Repository)
+		assert.NotNil(t, nl[0].Issue)
+	}
+
+	// only the unread notifications 5 and 4 are returned, most recent first
+	nl, err = GetMostRecentNotifications(user, 5)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 2) {
+		assert.EqualValues(t, 5, nl[0].ID)
+		assert.EqualValues(t, 4, nl[1].ID)
+	}
+
+	nl, err = GetMostRecentNotifications(user, 0)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+}
+
+func TestBucketNotificationsByAge(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, min, sec int) timeutil.TimeStamp {
+		return timeutil.TimeStamp(time.Date(year, month, day, hour, min, sec, 0, setting.DefaultUILocation).Unix())
+	}
+	notification := func(id int64, updated timeutil.TimeStamp) *Notification {
+		return &Notification{ID: id, UpdatedUnix: updated}
+	}
+
+	// 2020-03-18 is a Wednesday
+	nl := NotificationList{
+		notification(1, at(2020, 3, 18, 11, 0, 0)),
+		notification(2, at(2020, 3, 18, 0, 0, 0)),
+		notification(3, at(2020, 3, 17, 23, 59, 59)),
+		notification(4, at(2020, 3, 16, 0, 0, 0)),
+		notification(5, at(2020, 3, 15, 23, 59, 59)),
+		notification(6, at(2019, 12, 24, 8, 0, 0)),
+	}
+	ids := func(nl NotificationList) []int64 {
+		result := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			result = append(result, n.ID)
+		}
+		return result
+	}
+
+	buckets := BucketNotificationsByAge(nl, at(2020, 3, 18, 12, 0, 0))
+	assert.Equal(t, []int64{1, 2}, ids(buckets[NotificationAgeToday]))
+	assert.Equal(t, []int64{3, 4}, ids(buckets[NotificationAgeThisWeek]))
+	assert.Equal(t, []int64{5, 6}, ids(buckets[NotificationAgeOlder]))
+
+	// on Monday the week only consists of today
+	buckets = BucketNotificationsByAge(nl, at(2020, 3, 16, 9, 0, 0))
+	assert.Equal(t, []int64{1, 2, 3, 4}, ids(buckets[NotificationAgeToday]))
+	assert.Empty(t, buckets[NotificationAgeThisWeek])
+	assert.Equal(t, []int64{5, 6}, ids(buckets[NotificationAgeOlder]))
+
+	// on Sunday the week started six days ago
+	nl = append(nl, notification(7, at(2020, 3, 9, 0, 0, 0)), notification(8, at(2020, 3, 8, 23, 59, 59)))
+	buckets = BucketNotificationsByAge(nl[4:], at(2020, 3, 15, 23, 59, 59))
+	assert.Equal(t, []int64{5}, ids(buckets[NotificationAgeToday]))
+	assert.Equal(t, []int64{7}, ids(buckets[NotificationAgeThisWeek]))
+	assert.Equal(t, []int64{6, 8}, ids(buckets[NotificationAgeOlder]))
+
+	assert.Empty(t, BucketNotificationsByAge(NotificationList{}, at(2020, 3, 18, 12, 0, 0)))
+}
+
+func TestFilterAccessibleNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	notifications := func() NotificationList {
+		return NotificationList{
+			{ID: 1, UserID: 4, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue},
+			{ID: 2, UserID: 4, RepoID: 1, IssueID: 2, Source: NotificationSourcePullRequest},
+			// repo 2 is private
+			{ID: 3, UserID: 4, RepoID: 2, IssueID: 4, Source: NotificationSourceIssue},
+			{ID: 4, UserID: 4, Source: NotificationSourceSystem, SubjectTitle: "Maintenance"},
+			{ID: 5, UserID: 4, RepoID: 1, IssueID: NonexistentID, Source: NotificationSourceIssue},
+		}
+	}
+	ids := func(nl NotificationList) []int64 {
+		result := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			result = append(result, n.ID)
+		}
+		return result
+	}
+
+	nl, err := FilterAccessibleNotifications(user, notifications())
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 4}, ids(nl))
+
+	// disabling the issues of repo 1 revokes the access to its issue notifications
+	_, err = x.Delete(&RepoUnit{RepoID: 1, Type: UnitTypeIssues})
+	assert.NoError(t, err)
+
+	nl, err = FilterAccessibleNotifications(user, notifications())
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 4}, ids(nl))
+}
+
+func TestGetNotifications_AccessibleBy(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	accessible := &Notification{UserID: user.ID, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	// repo 2 is private
+	private := &Notification{UserID: user.ID, RepoID: 2, IssueID: 4, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	system := &Notification{UserID: user.ID, Source: NotificationSourceSystem, Status: NotificationStatusUnread, SubjectTitle: "Maintenance"}
+	for _, n := range []*Notification{accessible, private, system} {
+		AssertSuccessfulInsert(t, n)
+	}
+
+	opts := FindNotificationOptions{UserID: user.ID, AccessibleBy: user}
+	nl, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	ids := make([]int64, 0, len(nl))
+	for _, n := range nl {
+		ids = append(ids, n.ID)
+	}
+	assert.ElementsMatch(t, []int64{accessible.ID, system.ID}, ids)
+
+	count, err := CountNotifications(opts)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	count, err = CountNotifications(FindNotificationOptions{UserID: user.ID})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+}
+
+func TestAccessibleNotificationsForUser(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	insert := func(n *Notification) int64 {
+		n.UserID = user.ID
+		n.Status = NotificationStatusUnread
+		AssertSuccessfulInsert(t, n)
+		return n.ID
+	}
+	// repo 2 is private and issue NonexistentID does not exist
+	issue1 := insert(&Notification{RepoID: 1, IssueID: 1, Source: NotificationSourceIssue})
+	pull2 := insert(&Notification{RepoID: 1, IssueID: 2, Source: NotificationSourcePullRequest})
+	insert(&Notification{RepoID: 2, IssueID: 4, Source: NotificationSourceIssue})
+	system := insert(&Notification{Source: NotificationSourceSystem, SubjectTitle: "Maintenance"})
+	insert(&Notification{RepoID: 1, IssueID: NonexistentID, Source: NotificationSourceIssue})
+
+	ids := func(page, perPage int) []int64 {
+		nl, err := AccessibleNotificationsForUser(user, nil, page, perPage)
+		assert.NoError(t, err)
+		result := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			result = append(result, n.ID)
+		}
+		return result
+	}
+
+	// the inaccessible notifications do not leave holes in the pages
+	assert.ElementsMatch(t, []int64{issue1, pull2, system}, append(ids(1, 2), ids(2, 2)...))
+	assert.Len(t, ids(1, 2), 2)
+	count, err := CountAccessibleNotificationsForUser(user, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	// administrators can access private repositories they are no member of
+	admin := AssertExistsAndLoadBean(t, &User{ID: 1}).(*User)
+	AssertSuccessfulInsert(t, &Notification{UserID: admin.ID, RepoID: 2, IssueID: 4, Source: NotificationSourceIssue, Status: NotificationStatusUnread})
+	count, err = CountAccessibleNotificationsForUser(admin, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	// disabling the issues of repo 1 revokes the access to its issue notifications
+	_, err = x.Delete(&RepoUnit{RepoID: 1, Type: UnitTypeIssues})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int64{pull2, system}, ids(1, 10))
+	count, err = CountAccessibleNotificationsForUser(user, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+}
+
+func TestAccessibleNotificationsForUser_Dedup(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	insert := func(n *Notification) int64 {
+		n.UserID = user.ID
+		n.Status = NotificationStatusUnread
+		_, err := x.NoAutoTime().Insert(n)
+		assert.NoError(t, err)
+		return n.ID
+	}
+	// the duplicates of issue 1 are on different pages
+	insert(&Notification{RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, UpdatedUnix: 100})
+	pull := insert(&Notification{RepoID: 1, IssueID: 2, Source: NotificationSourcePullRequest, UpdatedUnix: 200})
+	system := insert(&Notification{Source: NotificationSourceSystem, SubjectTitle: "Maintenance", UpdatedUnix: 300})
+	issue := insert(&Notification{RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, UpdatedUnix: 400})
+
+	ids := func(page, perPage int) []int64 {
+		nl, err := AccessibleNotificationsForUser(user, nil, page, perPage)
+		assert.NoError(t, err)
+		result := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			result = append(result, n.ID)
+		}
+		return result
+	}
+	assert.Equal(t, []int64{issue, system}, ids(1, 2))
+	assert.Equal(t, []int64{pull}, ids(2, 2))
+
+	count, err := CountAccessibleNotificationsForUser(user, nil)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+}
+
+func TestGetNotificationThreadContext(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 1}).(*User)
+
+	ctx, err := GetNotificationThreadContext(user, 1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, ctx.Notification.ID)
+	assert.Equal(t, NotificationReasonSubscribed, ctx.Reason)
+	if assert.NotNil(t, ctx.Repository) {
+		assert.EqualValues(t, 1, ctx.Repository.ID)
+	}
+	if assert.NotNil(t, ctx.Issue) {
+		assert.EqualValues(t, 1, ctx.Issue.ID)
+	}
+	// the comments of issue 1, oldest first
+	if assert.Len(t, ctx.Comments, 2) {
+		assert.EqualValues(t, 2, ctx.Comments[0].ID)
+		assert.EqualValues(t, 3, ctx.Comments[1].ID)
+		assert.EqualValues(t, 5, ctx.Comments[1].Poster.ID)
+	}
+
+	// commit notifications carry the commit instead of an issue
+	assert.NoError(t, CreateOrUpdateCommitNotifications(1, "65f1bf27bc3bf70f64657658635e66094edbcb4d", 2, 2))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 1, Source: NotificationSourceCommit}).(*Notification)
+	ctx, err = GetNotificationThreadContext(user, notf.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, ctx.Issue)
+	assert.Equal(t, "65f1bf27bc3bf70f64657658635e66094edbcb4d", ctx.CommitID)
+	assert.EqualValues(t, 1, ctx.Repository.ID)
+	assert.Len(t, ctx.Comments, 1)
+
+	_, err = GetNotificationThreadContext(user, 2)
+	assert.True(t, IsErrNotificationForbidden(err))
+}
+
+func TestGetOwnedNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	notf, err := GetOwnedNotification(user, 4)
+	assert.NoError(t, err)
+	if assert.NotNil(t, notf) {
+		assert.EqualValues(t, 4, notf.ID)
+	}
+
+	// notification 1 belongs to user 1
+	_, err = GetOwnedNotification(user, 1)
+	assert.True(t, IsErrNotificationForbidden(err))
+	assert.False(t, IsErrNotificationNotExist(err))
+
+	_, err = GetOwnedNotification(user, NonexistentID)
+	assert.True(t, IsErrNotificationNotExist(err))
+
+	assert.True(t, IsErrNotificationForbidden(SetNotificationStatus(1, user, NotificationStatusRead)))
+	assert.True(t, IsErrNotificationNotExist(SetNotificationStatus(NonexistentID, user, NotificationStatusRead)))
+}
+
+func TestSetNotificationsDoneBySource(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	commitNotification := func(userID int64, status NotificationStatus) *Notification {
+		return &Notification{
+			UserID:   userID,
+			RepoID:   1,
+			Source:   NotificationSourceCommit,
+			CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d",
+			Status:   status,
+		}
+	}
+	unread := commitNotification(user.ID, NotificationStatusUnread)
+	read := commitNotification(user.ID, NotificationStatusRead)
+	pinned := commitNotification(user.ID, NotificationStatusPinned)
+	other := commitNotification(1, NotificationStatusUnread)
+	for _, notf := range []*Notification{unread, read, pinned, other} {
+		AssertSuccessfulInsert(t, notf)
+	}
+
+	before := CollectNotificationMetrics()
+	affected, err := SetNotificationsDoneBySource(user, NotificationSourceCommit)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, affected)
+
+	// only the unread notification is read by this
+	assert.EqualValues(t, 1, CollectNotificationMetrics().ReadTotal-before.ReadTotal)
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: unread.ID}).(*Notification)
+	assert.Equal(t, NotificationStatusDone, notf.Status)
+	assert.NotZero(t, notf.ReadUnix)
+	assert.NotZero(t, notf.FirstReadUnix)
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: read.ID}).(*Notification)
+	assert.Equal(t, NotificationStatusDone, notf.Status)
+	assert.Zero(t, notf.ReadUnix)
+	assert.Zero(t, notf.FirstReadUnix)
+	assert.Equal(t, NotificationStatusPinned, AssertExistsAndLoadBean(t, &Notification{ID: pinned.ID}).(*Notification).Status)
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{ID: other.ID}).(*Notification).Status)
+
+	// notifications of other sources are untouched
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification).Status)
+	assert.Equal(t, NotificationStatusRead, AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification).Status)
+
+	// new activity resurfaces a done notification
+	AssertSuccessfulInsert(t, &Notification{UserID: 4, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusDone})
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification).Status)
+}
+
+func TestNotification_Action(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 1 watches repo 1
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.Equal(t, NotificationActionCommented, notf.Action)
+
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(1, 0, 2, NotificationEventClose))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.Equal(t, NotificationActionClosed, notf.Action)
+
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(1, 0, 2, NotificationEventReopen))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.Equal(t, NotificationActionReopened, notf.Action)
+
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Equal(t, NotificationActionReopened, notf.APIFormat("en-US").Subject.Action)
+
+	// new notifications get the action of the event as well
+	assert.NoError(t, CreateOrUpdateIssueNotificationsForEvent(2, 0, 2, NotificationEventMerge))
+	notf = AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationActionMerged, notf.Action)
+}
+
+func TestNotification_Age(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	now := notf.UpdatedUnix.Add(3 * 60 * 60)
+	assert.Equal(t, 3*time.Hour, notf.Age(now))
+	assert.Equal(t, timeutil.RawTimeSinceUnix(notf.UpdatedUnix, now, "en-US"), notf.UpdatedAgo(now, "en-US"))
+}
+
+func TestNotification_TimeToRead(t *testing.T) {
+	notf := &Notification{Status: NotificationStatusRead, CreatedUnix: 1000, ReadUnix: 1090}
+	d, ok := notf.TimeToRead()
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Second, d)
+
+	notf.Status = NotificationStatusUnread
+	_, ok = notf.TimeToRead()
+	assert.False(t, ok)
+}
+
+func TestGetMedianTimeToRead(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	setRead := func(id int64, status NotificationStatus, created, read timeutil.TimeStamp) {
+		// created_unix is never updated by xorm
+		_, err := x.Exec("UPDATE notification SET status = ?, created_unix = ?, read_unix = ? WHERE id = ?", status, created, read, id)
+		assert.NoError(t, err)
+	}
+	setRead(2, NotificationStatusRead, 10000, 10060)
+	setRead(3, NotificationStatusPinned, 10000, 10300)
+
+	median, err := GetMedianTimeToRead(user, 10000)
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Minute, median)
+
+	setRead(4, NotificationStatusRead, 10000, 10120)
+	median, err = GetMedianTimeToRead(user, 10000)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, median)
+
+	// notifications created before are ignored
+	median, err = GetMedianTimeToRead(user, 10001)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, median)
+}
+
+func TestGetNotifications_OnlyAwaitingMyReview(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	opts := FindNotificationOptions{
+		UserID:               2,
+		OnlyAwaitingMyReview: true,
+	}
+	nl, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+
+	// user 2 is assigned to pull 2 and has only a pending review
+	AssertSuccessfulInsert(t, &IssueAssignees{AssigneeID: 2, IssueID: 2})
+	AssertSuccessfulInsert(t, &Review{Type: ReviewTypePending, ReviewerID: 2, IssueID: 2})
+	// user 2 has already reviewed pull 3
+	AssertSuccessfulInsert(t, &IssueAssignees{AssigneeID: 2, IssueID: 3})
+	AssertSuccessfulInsert(t, &Review{Type: ReviewTypeApprove, ReviewerID: 2, IssueID: 3})
+
+	nl, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 2, nl[0].ID)
+	}
+
+	// closed pull requests do not await a review anymore
+	_, err = x.ID(2).Cols("is_closed").Update(&Issue{IsClosed: true})
+	assert.NoError(t, err)
+	nl, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+}
+
+func TestBackfillNotificationUpdatedBy(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	// process the notifications one by one to cover the batching
+	defer func(size int) { setting.Database.IterateBufferSize = size }(setting.Database.IterateBufferSize)
+	setting.Database.IterateBufferSize = 1
+
+	// comment 3 was posted by user 5, issue 5 by user 2
+	withComment := &Notification{UserID: 4, RepoID: 1, IssueID: 1, CommentID: 3, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	withIssue := &Notification{UserID: 4, RepoID: 1, IssueID: 5, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	AssertSuccessfulInsert(t, withComment)
+	AssertSuccessfulInsert(t, withIssue)
+
+	fixed, err := BackfillNotificationUpdatedBy()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, fixed)
+	assert.EqualValues(t, 5, AssertExistsAndLoadBean(t, &Notification{ID: withComment.ID}).(*Notification).UpdatedBy)
+	assert.EqualValues(t, 2, AssertExistsAndLoadBean(t, &Notification{ID: withIssue.ID}).(*Notification).UpdatedBy)
+
+	fixed, err = BackfillNotificationUpdatedBy()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, fixed)
+}
+
+func TestCreateOrUpdateCommitNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	const commitID = "65f1bf27bc3bf70f64657658635e66094edbcb4d"
+
+	// user 2 does not watch repo 1 but subscribed to the commit, user 4 does both
+	assert.NoError(t, WatchCommit(2, 1, commitID))
+	assert.NoError(t, WatchCommit(4, 1, commitID))
+
+	assert.NoError(t, CreateOrUpdateCommitNotifications(1, commitID, 0, 5))
+	for _, userID := range []int64{1, 2, 4, 11} {
+		AssertExistsAndLoadBean(t, &Notification{UserID: userID, RepoID: 1, CommitID: commitID, Source: NotificationSourceCommit, Status: NotificationStatusUnread})
+	}
+	AssertCount(t, &Notification{CommitID: commitID}, 4)
+
+	// existing notifications are updated instead of duplicated
+	assert.NoError(t, CreateOrUpdateCommitNotifications(1, commitID, 0, 1))
+	AssertCount(t, &Notification{CommitID: commitID}, 4)
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 2, CommitID: commitID}).(*Notification)
+	assert.EqualValues(t, 1, notf.UpdatedBy)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+}
+
+func TestGetNotificationCountsSplit(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+	all, participating, err := GetNotificationCountsSplit(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, all)
+	assert.EqualValues(t, 0, participating)
+
+	// a reaction to a comment of user 2 is a participating notification
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue,
+		Status: NotificationStatusUnread, Reason: NotificationReasonReaction})
+	all, participating, err = GetNotificationCountsSplit(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, all)
+	assert.EqualValues(t, 1, participating)
+	assert.True(t, participating <= all)
+
+	effective, err := GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.Equal(t, effective, all)
+
+	// the totals follow the inbox statuses and snoozes like the badge
+	defer func(statuses []string) {
+		setting.Service.NotificationInboxStatuses = statuses
+	}(setting.Service.NotificationInboxStatuses)
+	setting.Service.NotificationInboxStatuses = []string{"unread", "read"}
+	assert.NoError(t, SnoozeNotification(4, user, timeutil.TimeStampNow()+3600))
+	all, _, err = GetNotificationCountsSplit(user)
+	assert.NoError(t, err)
+	effective, err = GetEffectiveUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, all)
+	assert.Equal(t, effective, all)
+}
+
+func TestRedeliverNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+	assert.NoError(t, RedeliverNotification(2, user))
+
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.EqualValues(t, 2, notf.UpdatedBy)
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 2})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, nl) {
+		assert.EqualValues(t, 2, nl[0].ID)
+	}
+
+	// notifications of other users can not be redelivered
+	assert.True(t, IsErrNotificationForbidden(RedeliverNotification(1, user)))
+}
+
+func TestNotification_APIFormatDueDate(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 1 has no deadline
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Nil(t, notf.APIFormat("en-US").Subject.DueDate)
+
+	// issue 10 is due at 1019307200
+	notf = &Notification{UserID: 1, RepoID: 42, IssueID: 10, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	AssertSuccessfulInsert(t, notf)
+	assert.NoError(t, notf.LoadAttributes())
+	dueDate := notf.APIFormat("en-US").Subject.DueDate
+	if assert.NotNil(t, dueDate) {
+		assert.EqualValues(t, 1019307200, dueDate.Unix())
+	}
+}
+
+func TestRemapNotificationComments(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	notfs := []*Notification{
+		{UserID: 1, RepoID: 1, IssueID: 1, CommentID: 2, Source: NotificationSourceIssue, Status: NotificationStatusUnread},
+		{UserID: 4, RepoID: 1, IssueID: 1, CommentID: 3, Source: NotificationSourceIssue, Status: NotificationStatusUnread},
+		{UserID: 11, RepoID: 1, IssueID: 1, CommentID: 3, Source: NotificationSourceIssue, Status: NotificationStatusUnread},
+		{UserID: 2, RepoID: 1, IssueID: 1, CommentID: 5, Source: NotificationSourceIssue, Status: NotificationStatusUnread},
+	}
+	for _, notf := range notfs {
+		AssertSuccessfulInsert(t, notf)
+	}
+
+	affected, err := RemapNotificationComments(map[int64]int64{2: 7, 3: 0, 4: 8})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, affected)
+
+	assert.EqualValues(t, 7, AssertExistsAndLoadBean(t, &Notification{ID: notfs[0].ID}).(*Notification).CommentID)
+	assert.EqualValues(t, 0, AssertExistsAndLoadBean(t, &Notification{ID: notfs[1].ID}).(*Notification).CommentID)
+	assert.EqualValues(t, 0, AssertExistsAndLoadBean(t, &Notification{ID: notfs[2].ID}).(*Notification).CommentID)
+	assert.EqualValues(t, 5, AssertExistsAndLoadBean(t, &Notification{ID: notfs[3].ID}).(*Notification).CommentID)
+}
+
+func TestRemapNotificationComments_Chained(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	first := &Notification{UserID: 1, RepoID: 1, IssueID: 1, CommentID: 901, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	second := &Notification{UserID: 4, RepoID: 1, IssueID: 1, CommentID: 902, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	AssertSuccessfulInsert(t, first)
+	AssertSuccessfulInsert(t, second)
+
+	affected, err := RemapNotificationComments(map[int64]int64{901: 902, 902: 903})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, affected)
+	assert.EqualValues(t, 902, AssertExistsAndLoadBean(t, &Notification{ID: first.ID}).(*Notification).CommentID)
+	assert.EqualValues(t, 903, AssertExistsAndLoadBean(t, &Notification{ID: second.ID}).(*Notification).CommentID)
+}
+
+func TestRemapNotificationComments_Swapped(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	first := &Notification{UserID: 1, RepoID: 1, IssueID: 1, CommentID: 901, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	second := &Notification{UserID: 4, RepoID: 1, IssueID: 1, CommentID: 902, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	AssertSuccessfulInsert(t, first)
+	AssertSuccessfulInsert(t, second)
+
+	affected, err := RemapNotificationComments(map[int64]int64{901: 902, 902: 901})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, affected)
+	assert.EqualValues(t, 902, AssertExistsAndLoadBean(t, &Notification{ID: first.ID}).(*Notification).CommentID)
+	assert.EqualValues(t, 901, AssertExistsAndLoadBean(t, &Notification{ID: second.ID}).(*Notification).CommentID)
+}
+
+func TestGetAllNotificationsForIssue(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// a read notification of another user, a commit notification referencing the issue, one of a deleted user
+	// and a deleted one
+	insert := func(n *Notification) {
+		_, err := x.NoAutoTime().Insert(n)
+		assert.NoError(t, err)
+	}
+	insert(&Notification{UserID: 4, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusRead, CreatedUnix: 946684900, UpdatedUnix: 946684900})
+	insert(&Notification{UserID: 5, RepoID: 1, IssueID: 1, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d", Source: NotificationSourceCommit, Status: NotificationStatusRead, CreatedUnix: 946684700, UpdatedUnix: 946684700})
+	insert(&Notification{UserID: NonexistentID, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread, CreatedUnix: 946685000, UpdatedUnix: 946685000})
+	insert(&Notification{UserID: 11, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusRead, CreatedUnix: 946685100, UpdatedUnix: 946685100, DeletedUnix: 946685200})
+
+	nl, err := GetAllNotificationsForIssue(1)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 5) {
+		assert.EqualValues(t, 5, nl[0].User.ID)
+		assert.Equal(t, NotificationSourceCommit, nl[0].Source)
+		assert.EqualValues(t, 1, nl[1].ID)
+		assert.EqualValues(t, 1, nl[1].User.ID)
+		assert.EqualValues(t, 4, nl[2].User.ID)
+		assert.True(t, nl[3].User.IsGhost())
+		assert.EqualValues(t, 11, nl[4].User.ID)
+		assert.EqualValues(t, 946685200, nl[4].DeletedUnix)
+	}
+
+	nl, err = GetAllNotificationsForIssue(NonexistentID)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+}
+
+func TestGetActiveIssueNotificationRecipients(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 1 watches repo 1, user 9 watches issue 1 and user 2 watches neither
+	AssertSuccessfulInsert(t, &Notification{UserID: 9, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread})
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread})
+
+	userIDs := func() []int64 {
+		nl, err := GetActiveIssueNotificationRecipients(1)
+		assert.NoError(t, err)
+		ids := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			ids = append(ids, n.UserID)
+		}
+		return ids
+	}
+	assert.ElementsMatch(t, []int64{1, 9}, userIDs())
+
+	// user 1 unwatches the issue but still watches the repository
+	assert.NoError(t, CreateOrUpdateIssueWatch(1, 1, false))
+	assert.ElementsMatch(t, []int64{9}, userIDs())
+}
+
+func TestGetIssueNotificationRecipientsByReason(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 2, 2))
+	assert.NoError(t, CreateMentionNotifications(1, 2, 2, []int64{5}))
+
+	recipients, err := GetIssueNotificationRecipientsByReason(1)
+	assert.NoError(t, err)
+	userIDs := func(reason string) []int64 {
+		ids := make([]int64, 0, len(recipients[reason]))
+		for _, u := range recipients[reason] {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+	assert.Len(t, recipients, 2)
+	assert.Equal(t, []int64{5}, userIDs(NotificationReasonMention))
+	assert.Equal(t, []int64{1, 4, 11}, userIDs(NotificationReasonSubscribed))
+
+	recipients, err = GetIssueNotificationRecipientsByReason(NonexistentID)
+	assert.NoError(t, err)
+	assert.Empty(t, recipients)
+}
+
+func TestGetInboxZeroTime(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// user 2 has never read anything since notifications 4 and 5 arrived
+	_, atZero, err := GetInboxZeroTime(user)
+	assert.NoError(t, err)
+	assert.False(t, atZero)
+
+	before := timeutil.TimeStampNow()
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusRead))
+	_, atZero, err = GetInboxZeroTime(user)
+	assert.NoError(t, err)
+	assert.False(t, atZero)
+
+	assert.NoError(t, SetNotificationStatus(5, user, NotificationStatusRead))
+	zeroTime, atZero, err := GetInboxZeroTime(user)
+	assert.NoError(t, err)
+	assert.True(t, atZero)
+	assert.True(t, zeroTime >= before)
+	assert.Equal(t, AssertExistsAndLoadBean(t, &Notification{ID: 5}).(*Notification).ReadUnix, zeroTime)
+
+	// an unread notification older than the reads is not hidden by a later bump of its updated_unix
+	unread := &Notification{UserID: user.ID, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	AssertSuccessfulInsert(t, unread)
+	_, err = x.ID(unread.ID).Cols("created_unix", "updated_unix").NoAutoTime().
+		Update(&Notification{CreatedUnix: before - 10, UpdatedUnix: zeroTime + 3600})
+	assert.NoError(t, err)
+	_, atZero, err = GetInboxZeroTime(user)
+	assert.NoError(t, err)
+	assert.False(t, atZero)
+}
+
+func TestCreateReviewVerdictNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 1 is the author of pull 2
+	assert.NoError(t, CreateReviewVerdictNotification(2, 1, 4, NotificationActionReviewApprove))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 1, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonReview, notf.Reason)
+	assert.Equal(t, NotificationActionReviewApprove, notf.Action)
+	assert.EqualValues(t, 4, notf.UpdatedBy)
+
+	// further verdicts bump the same thread
+	assert.NoError(t, CreateReviewVerdictNotification(2, 1, 4, NotificationActionReviewReject))
+	AssertCount(t, &Notification{UserID: 1, IssueID: 2}, 1)
+	notf = AssertExistsAndLoadBean(t, &Notification{UserID: 1, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationActionReviewReject, notf.Action)
+
+	// self reviews are ignored
+	assert.NoError(t, CreateReviewVerdictNotification(2, 1, 1, NotificationActionReviewComment))
+	notf = AssertExistsAndLoadBean(t, &Notification{UserID: 1, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationActionReviewReject, notf.Action)
+
+	assert.Error(t, CreateReviewVerdictNotification(2, 1, 4, "unknown"))
+}
+
+func TestCreateReviewRequestNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	// user 1 requests a review of pull 2 from user 4
+	assert.NoError(t, CreateReviewRequestNotification(2, 4, 1))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationReasonReviewRequested, notf.Reason)
+	assert.Equal(t, NotificationActionReviewRequested, notf.Action)
+
+	// the reviewer reads it while a newer notification arrives
+	assert.NoError(t, SetNotificationStatus(notf.ID, user, NotificationStatusRead))
+	_, err := x.ID(notf.ID).Cols("updated_unix").NoAutoTime().Update(&Notification{UpdatedUnix: 100})
+	assert.NoError(t, err)
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	other := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification)
+	_, err = x.ID(other.ID).Cols("updated_unix").NoAutoTime().Update(&Notification{UpdatedUnix: 200})
+	assert.NoError(t, err)
+
+	// the re-request surfaces the thread again
+	assert.NoError(t, CreateReviewRequestNotification(2, 4, 1))
+	AssertCount(t, &Notification{UserID: 4, IssueID: 2}, 1)
+	notf = AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 2}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationActionReReviewRequested, notf.Action)
+
+	notifications, err := NotificationsForUser(user, []NotificationStatus{NotificationStatusUnread}, 1, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, notifications, 2) {
+		assert.EqualValues(t, notf.ID, notifications[0].ID)
+	}
+
+	// requesting the own review is ignored
+	assert.NoError(t, CreateReviewRequestNotification(2, 1, 1))
+	AssertNotExistsBean(t, &Notification{UserID: 1, IssueID: 2})
+
+	assert.Error(t, CreateReviewRequestNotification(1, 4, 1))
+}
+
+func TestCreateOrUpdateIssueNotifications_RepoCap(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	defer func(limit int, window time.Duration) {
+		setting.Service.NotificationRepoCap = limit
+		setting.Service.NotificationRepoCapWindow = window
+		notificationRepoVolume.reset()
+	}(setting.Service.NotificationRepoCap, setting.Service.NotificationRepoCapWindow)
+	setting.Service.NotificationRepoCap = 2
+	setting.Service.NotificationRepoCapWindow = time.Hour
+	notificationRepoVolume.reset()
+
+	// a burst of events on the issues of repo 1, which is watched by user 4
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	assert.NoError(t, CreateOrUpdateIssueNotifications(2, 0, 2))
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1})
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 2})
+
+	// above the cap the new notifications are collected into one notification for the repository
+	assert.NoError(t, CreateOrUpdateIssueNotifications(3, 0, 2))
+	assert.NoError(t, CreateOrUpdateIssueNotifications(5, 0, 2))
+	AssertNotExistsBean(t, &Notification{UserID: 4, IssueID: 3})
+	AssertNotExistsBean(t, &Notification{UserID: 4, IssueID: 5})
+	AssertCount(t, &Notification{UserID: 4, Source: NotificationSourceRepository}, 1)
+	coalesced := AssertExistsAndLoadBean(t, &Notification{UserID: 4, RepoID: 1, Source: NotificationSourceRepository}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, coalesced.Status)
+	assert.Equal(t, 2, coalesced.CoalescedNotifications())
+	assert.Equal(t, "2 notifications were collected as the repository is very busy", coalesced.SubjectTitle)
+	assert.Equal(t, "https://try.gitea.io/user2/repo1/issues", coalesced.HTMLURL())
+
+	// once read, the next collected notification starts a new count
+	assert.NoError(t, SetNotificationStatus(coalesced.ID, &User{ID: 4}, NotificationStatusRead))
+	assert.NoError(t, CreateOrUpdateIssueNotifications(3, 0, 2))
+	coalesced = AssertExistsAndLoadBean(t, &Notification{ID: coalesced.ID}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, coalesced.Status)
+	assert.Equal(t, 1, coalesced.CoalescedNotifications())
+
+	// existing ones are still bumped
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 5))
+	assert.EqualValues(t, 5, AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification).UpdatedBy)
+}
+
+func TestGetRelevantNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 2 owns repos 1 and 2 and has write access to repo 3
+	inOwnedRepo := &Notification{UserID: 4, RepoID: 2, IssueID: 4, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	inOtherRepo := &Notification{UserID: 4, RepoID: 3, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	AssertSuccessfulInsert(t, inOwnedRepo)
+	AssertSuccessfulInsert(t, inOtherRepo)
+
+	nl, err := GetRelevantNotifications(&User{ID: 2}, FindNotificationOptions{})
+	assert.NoError(t, err)
+	ids := make([]int64, 0, len(nl))
+	for _, n := range nl {
+		ids = append(ids, n.ID)
+	}
+	// notification 1 of user 1 is in repo 1, notification 5 is personal and in repo 2 but listed once
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4, 5, inOwnedRepo.ID}, ids)
+
+	// the options still apply
+	nl, err = GetRelevantNotifications(&User{ID: 2}, FindNotificationOptions{RepoID: 2})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+}
+
+func TestMarkNotificationMailed(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	opts := FindNotificationOptions{UserID: 2, Status: NotificationStatusUnread, MailNotSent: true}
+	nl, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+
+	assert.NoError(t, MarkNotificationMailed([]int64{nl[0].ID}))
+	assert.NotZero(t, AssertExistsAndLoadBean(t, &Notification{ID: nl[0].ID}).(*Notification).MailSentUnix)
+
+	remaining, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, remaining, 1) {
+		assert.Equal(t, nl[1].ID, remaining[0].ID)
+	}
+
+	assert.NoError(t, MarkNotificationMailed([]int64{nl[1].ID}))
+	remaining, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 0)
+}
+
+func TestNotificationsForUserWindow(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+	statuses := []NotificationStatus{NotificationStatusUnread, NotificationStatusRead}
+
+	window, err := NotificationsForUserWindow(user, statuses, 0, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, window, 2) {
+		assert.EqualValues(t, 5, window[0].ID)
+		assert.EqualValues(t, 4, window[1].ID)
+	}
+
+	// reading the notifications while scrolling does not shift the next window
+	assert.NoError(t, SetNotificationStatus(5, user, NotificationStatusRead))
+	assert.NoError(t, SetNotificationStatus(4, user, NotificationStatusRead))
+
+	window, err = NotificationsForUserWindow(user, statuses, window[1].ID, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, window, 1) {
+		// notification 3 is pinned
+		assert.EqualValues(t, 2, window[0].ID)
+	}
+
+	window, err = NotificationsForUserWindow(user, statuses, window[0].ID, 2)
+	assert.NoError(t, err)
+	assert.Len(t, window, 0)
+}
+
+func TestNotificationDelivery(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	pendingIDs := func() []int64 {
+		nl, err := GetNotificationsPendingDelivery(10)
+		assert.NoError(t, err)
+		ids := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, pendingIDs())
+
+	assert.NoError(t, MarkNotificationDelivered(1))
+	assert.Equal(t, []int64{2, 3, 4, 5}, pendingIDs())
+
+	// failed deliveries are retried until the cap is reached
+	for i := 1; i < maxNotificationDeliveryAttempts; i++ {
+		assert.NoError(t, MarkNotificationFailed(2, fmt.Errorf("connection refused")))
+		notf := AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification)
+		assert.Equal(t, NotificationDeliveryFailed, notf.DeliveryStatus)
+		assert.Equal(t, i, notf.DeliveryAttempts)
+		assert.Contains(t, pendingIDs(), int64(2))
+	}
+
+	assert.NoError(t, MarkNotificationFailed(2, fmt.Errorf("connection refused")))
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification)
+	assert.Equal(t, NotificationDeliveryDead, notf.DeliveryStatus)
+	assert.Equal(t, []int64{3, 4, 5}, pendingIDs())
+}
+
+func TestGetUnreadCountsForUserRepos(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 2 is not a member of repo 4
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, RepoID: 4, Source: NotificationSourceIssue, Status: NotificationStatusUnread})
+
+	counts, err := GetUnreadCountsForUserRepos(&User{ID: 2})
+	assert.NoError(t, err)
+	// user 2 owns repos 1 and 2 and collaborates on repo 3
+	assert.EqualValues(t, 1, counts[1])
+	assert.EqualValues(t, 1, counts[2])
+	count, ok := counts[3]
+	assert.True(t, ok)
+	assert.EqualValues(t, 0, count)
+	_, ok = counts[4]
+	assert.False(t, ok)
+}
+
+func TestOpenNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	notf, err := OpenNotification(user, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, NotificationStatusRead, notf.Status)
+	assert.NotNil(t, notf.Issue)
+	assert.NotNil(t, notf.Repository)
+	assert.Equal(t, NotificationStatusRead, AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification).Status)
+
+	// pinned notifications stay pinned
+	notf, err = OpenNotification(user, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, NotificationStatusPinned, notf.Status)
+
+	_, err = OpenNotification(user, 1)
+	assert.True(t, IsErrNotificationForbidden(err))
+}
+
+func TestGetNotifications_ExcludeDraftPRs(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 2 has notifications for pulls 2 and 3 and for issues 4 and 5
+	_, err := x.ID(2).Cols("name").Update(&Issue{Title: "wip: not ready yet"})
+	assert.NoError(t, err)
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 2, ExcludeDraftPRs: true})
+	assert.NoError(t, err)
+	ids := make([]int64, 0, len(nl))
+	for _, n := range nl {
+		ids = append(ids, n.ID)
+	}
+	assert.ElementsMatch(t, []int64{3, 4, 5}, ids)
+
+	// the prefixes are matched literally
+	_, err = x.ID(3).Cols("name").Update(&Issue{Title: "[WIP] not ready either"})
+	assert.NoError(t, err)
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 2, ExcludeDraftPRs: true})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+
+	prefixes := setting.Repository.PullRequest.WorkInProgressPrefixes
+	setting.Repository.PullRequest.WorkInProgressPrefixes = []string{"WIP_"}
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 2, ExcludeDraftPRs: true})
+	setting.Repository.PullRequest.WorkInProgressPrefixes = prefixes
+	assert.NoError(t, err)
+	assert.Len(t, nl, 4)
+
+	// system notifications without an issue are kept
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, Source: NotificationSourceSystem, Status: NotificationStatusUnread, SubjectTitle: "Maintenance"})
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 2, ExcludeDraftPRs: true})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 3)
+}
+
+func TestNotificationList_Dedup(t *testing.T) {
+	nl := NotificationList{
+		{ID: 1, UserID: 1, IssueID: 1, Source: NotificationSourceIssue, UpdatedUnix: 20},
+		{ID: 2, UserID: 1, SubjectTitle: "Maintenance", Source: NotificationSourceSystem, UpdatedUnix: 15},
+		{ID: 3, UserID: 1, IssueID: 1, Source: NotificationSourceIssue, UpdatedUnix: 10},
+		{ID: 4, UserID: 1, SubjectTitle: "Maintenance", Source: NotificationSourceSystem, UpdatedUnix: 5},
+		{ID: 5, UserID: 1, IssueID: 1, Source: NotificationSourceCommit, CommitID: "abc", UpdatedUnix: 5},
+	}
+	deduped := nl.Dedup()
+	ids := make([]int64, 0, len(deduped))
+	for _, n := range deduped {
+		ids = append(ids, n.ID)
+	}
+	assert.Equal(t, []int64{1, 2, 4, 5}, ids)
+
+	// lists without duplicates are returned as they are
+	assert.Len(t, deduped.Dedup(), 4)
+}
+
+func TestGetNotifications_Dedup(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// a historic twin of notification 4
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, RepoID: 1, IssueID: 5, Source: NotificationSourceIssue, Status: NotificationStatusUnread})
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 2, IssueID: 5})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 2, IssueID: 5, Dedup: true})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.NotEqual(t, int64(4), nl[0].ID)
+	}
+}
+
+func TestGetNotifications_PosterID(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	// system notifications are never matched
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, Source: NotificationSourceSystem, Status: NotificationStatusUnread, SubjectTitle: "Maintenance"})
+
+	ids := func(opts FindNotificationOptions) []int64 {
+		nl, err := GetNotifications(opts)
+		assert.NoError(t, err)
+		ids := make([]int64, 0, len(nl))
+		for _, n := range nl {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+
+	// user 2 has notifications for pulls 2 and 3 opened by user 1 and for issues 4 and 5 opened by user 2
+	assert.ElementsMatch(t, []int64{2, 3}, ids(FindNotificationOptions{UserID: 2, PosterID: 1}))
+	assert.ElementsMatch(t, []int64{4, 5}, ids(FindNotificationOptions{UserID: 2, PosterID: 2}))
+	assert.Empty(t, ids(FindNotificationOptions{UserID: 2, PosterID: 3}))
+}
+
+func TestGetNotifications_SortMostCommented(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// issue 4 of notification 5 is the most active discussion
+	_, err := x.ID(4).Cols("num_comments").Update(&Issue{NumComments: 10})
+	assert.NoError(t, err)
+	_, err = x.ID(3).Cols("num_comments").Update(&Issue{NumComments: 3})
+	assert.NoError(t, err)
+	AssertSuccessfulInsert(t, &Notification{UserID: 2, Source: NotificationSourceSystem, Status: NotificationStatusUnread, SubjectTitle: "Maintenance"})
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 2, SortType: "mostcommented"})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 5) {
+		assert.EqualValues(t, 5, nl[0].ID)
+		assert.EqualValues(t, 3, nl[1].ID)
+		// then by recency
+		assert.EqualValues(t, 4, nl[2].ID)
+		assert.EqualValues(t, 2, nl[3].ID)
+		assert.Equal(t, NotificationSourceSystem, nl[4].Source)
+	}
+}
+
+func TestGetNotifications_StatusesAndSource(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	opts := FindNotificationOptions{
+		UserID:   2,
+		Statuses: []NotificationStatus{NotificationStatusUnread, NotificationStatusPinned},
+		Source:   NotificationSourcePullRequest,
+	}
+	nl, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 3, nl[0].ID)
+	}
+
+	opts.Source = NotificationSourceIssue
+	nl, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+
+	if !setting.Database.UseSQLite3 {
+		return
+	}
+	// the combined filter of the inbox is served by the inbox index
+	sql, args, err := builder.Select("id").From("notification").
+		Where(opts.ToCond()).
+		OrderBy("notification.updated_unix DESC").
+		ToSQL()
+	assert.NoError(t, err)
+	plan, err := x.QueryString(append([]interface{}{"EXPLAIN QUERY PLAN " + sql}, args...)...)
+	assert.NoError(t, err)
+	details := make([]string, 0, len(plan))
+	for _, row := range plan {
+		details = append(details, row["detail"])
+	}
+	assert.Contains(t, strings.Join(details, "\n"), "IDX_notification_inbox")
+}
+
+func TestGetNotificationFunnelStats(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	since := timeutil.TimeStampNow()
+
+	// users 4 and 11 watch repo 1
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	created, read, opened, err := GetNotificationFunnelStats(since)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, created)
+	assert.EqualValues(t, 0, read)
+	assert.EqualValues(t, 0, opened)
+
+	// user 4 marks the notification as read without opening it
+	notf4 := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification)
+	assert.NoError(t, SetNotificationStatus(notf4.ID, &User{ID: 4}, NotificationStatusRead))
+	// user 11 opens the notification
+	notf11 := AssertExistsAndLoadBean(t, &Notification{UserID: 11, IssueID: 1}).(*Notification)
+	_, err = OpenNotification(&User{ID: 11}, notf11.ID)
+	assert.NoError(t, err)
+
+	created, read, opened, err = GetNotificationFunnelStats(since)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, created)
+	assert.EqualValues(t, 2, read)
+	assert.EqualValues(t, 1, opened)
+	assert.Zero(t, AssertExistsAndLoadBean(t, &Notification{ID: notf4.ID}).(*Notification).OpenedUnix)
+}
+
+func TestCreatePushNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	commitIDs := make([]string, 0, 20)
+	for i := 20; i > 0; i-- {
+		commitIDs = append(commitIDs, fmt.Sprintf("%040d", i))
+	}
+	// user 2 does not watch repo 1 but subscribed to one of the commits
+	assert.NoError(t, WatchCommit(2, 1, commitIDs[5]))
+
+	assert.NoError(t, CreatePushNotifications(1, commitIDs, 5))
+	for _, userID := range []int64{1, 2, 4, 11} {
+		AssertCount(t, &Notification{UserID: userID, Source: NotificationSourceCommit}, 1)
+	}
+
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 4, Source: NotificationSourceCommit}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, commitIDs[0], notf.CommitID)
+	assert.Equal(t, 20, notf.PushedCommits())
+	assert.NoError(t, notf.LoadAttributes())
+	subject := notf.APIFormat("en-US").Subject
+	assert.Equal(t, "pushed 20 commits", subject.Title)
+	assert.Equal(t, NotificationActionPushed, subject.Action)
+
+	// pushing the commits again bumps the existing threads
+	assert.NoError(t, SetNotificationStatus(notf.ID, &User{ID: 4}, NotificationStatusRead))
+	assert.NoError(t, CreatePushNotifications(1, commitIDs[:3], 5))
+	for _, userID := range []int64{1, 2, 4, 11} {
+		AssertCount(t, &Notification{UserID: userID, Source: NotificationSourceCommit}, 1)
+	}
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: notf.ID}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, 3, notf.PushedCommits())
+}
+
+func TestImportNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	notf := &Notification{
+		UserID:      4,
+		RepoID:      1,
+		IssueID:     1,
+		Source:      NotificationSourceIssue,
+		Status:      NotificationStatusRead,
+		CreatedUnix: 1262304000,
+		UpdatedUnix: 1262390400,
+	}
+	assert.NoError(t, ImportNotification(notf))
+
+	imported := AssertExistsAndLoadBean(t, &Notification{ID: notf.ID}).(*Notification)
+	assert.EqualValues(t, 1262304000, imported.CreatedUnix)
+	assert.EqualValues(t, 1262390400, imported.UpdatedUnix)
+	assert.Equal(t, NotificationStatusRead, imported.Status)
+
+	assert.Error(t, ImportNotification(&Notification{RepoID: 1, IssueID: 1, Source: NotificationSourceIssue}))
+	assert.Error(t, ImportNotification(&Notification{UserID: 4, Source: NotificationSourceIssue}))
+	assert.Error(t, ImportNotification(&Notification{UserID: 4, RepoID: 1, Source: NotificationSourceCommit}))
+	assert.Error(t, ImportNotification(&Notification{UserID: 4}))
+}
+
+func TestGetNotificationDailyCounts(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// 2020-03-01 00:00:00 UTC
+	const day = 1583020800
+	for _, createdUnix := range []timeutil.TimeStamp{
+		day, day + 3600, day + 86399,
+		day + 86400,
+		day + 3*86400 + 7200, day + 3*86400 + 7300,
+		day + 10*86400,
+	} {
+		assert.NoError(t, ImportNotification(&Notification{UserID: 4, Source: NotificationSourceSystem, SubjectTitle: "Import", CreatedUnix: createdUnix}))
+	}
+
+	counts, err := GetNotificationDailyCounts(&User{ID: 4}, day, day+7*86400)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"2020-03-01": 3,
+		"2020-03-02": 1,
+		"2020-03-04": 2,
+	}, counts)
+}
+
+func TestApplyNotificationFilter(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification)
+
+	filter := FindNotificationOptions{RepoID: 1, Status: NotificationStatusUnread}
+	nl, err := ApplyNotificationFilter(user, filter)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.Equal(t, notf.ID, nl[0].ID)
+	}
+
+	// user 4 has no access to repo 1 once it is private, even if the filter still names it
+	_, err = x.ID(1).Cols("is_private").Update(&Repository{IsPrivate: true})
+	assert.NoError(t, err)
+	nl, err = ApplyNotificationFilter(user, filter)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+
+	// the owner of repo 1 still sees their notifications of it
+	nl, err = ApplyNotificationFilter(&User{ID: 2}, FindNotificationOptions{RepoID: 1})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, nl)
+}
+
+func TestGetNotificationSummary(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	for _, notf := range []*Notification{
+		{UserID: 2, RepoID: 1, IssueID: 5, Source: NotificationSourceIssue, Status: NotificationStatusUnread},
+		{UserID: 2, RepoID: 2, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d", Source: NotificationSourceCommit, Status: NotificationStatusUnread},
+		{UserID: 2, Source: NotificationSourceSystem, SubjectTitle: "Maintenance", Status: NotificationStatusUnread},
+	} {
+		assert.NoError(t, ImportNotification(notf))
+	}
+
+	total, repos, issues, err := GetNotificationSummary(user, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, total)
+	assert.EqualValues(t, 2, repos)
+	assert.EqualValues(t, 2, issues)
+
+	total, repos, issues, err = GetNotificationSummary(user, NotificationStatusRead)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+	assert.EqualValues(t, 1, repos)
+	assert.EqualValues(t, 1, issues)
+
+	total, repos, issues, err = GetNotificationSummary(&User{ID: 4}, NotificationStatusUnread)
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Zero(t, repos)
+	assert.Zero(t, issues)
+}
+
+func TestMarkAllReadWithUndo(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	token, affected, err := MarkAllReadWithUndo(user)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.EqualValues(t, 2, affected)
+	for _, id := range []int64{4, 5} {
+		notf := AssertExistsAndLoadBean(t, &Notification{ID: id}).(*Notification)
+		assert.Equal(t, NotificationStatusRead, notf.Status)
+		assert.NotZero(t, notf.FirstReadUnix)
+	}
+
+	assert.NoError(t, UndoMarkAllRead(token))
+	for _, id := range []int64{4, 5} {
+		notf := AssertExistsAndLoadBean(t, &Notification{ID: id}).(*Notification)
+		assert.Equal(t, NotificationStatusUnread, notf.Status)
+		assert.Zero(t, notf.FirstReadUnix)
+		assert.Zero(t, notf.ReadUnix)
+	}
+	// the read and pinned notifications are not touched
+	assert.Equal(t, NotificationStatusRead, AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification).Status)
+	assert.Equal(t, NotificationStatusPinned, AssertExistsAndLoadBean(t, &Notification{ID: 3}).(*Notification).Status)
+
+	// a token can only be used once
+	assert.True(t, IsErrNotificationUndoTokenNotExist(UndoMarkAllRead(token)))
+
+	// the notifications are kept read once the token has expired
+	defer func(window time.Duration) { markAllReadUndoWindow = window }(markAllReadUndoWindow)
+	markAllReadUndoWindow = 0
+	token, _, err = MarkAllReadWithUndo(user)
+	assert.NoError(t, err)
+	assert.True(t, IsErrNotificationUndoTokenNotExist(UndoMarkAllRead(token)))
+	AssertCount(t, &Notification{UserID: 2, Status: NotificationStatusUnread}, 0)
+
+	token, affected, err = MarkAllReadWithUndo(user)
+	assert.NoError(t, err)
+	assert.Empty(t, token)
+	assert.Zero(t, affected)
+}
+
+func TestGetNotifications_HasAttachment(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// comment 2 has attachments, comment 3 has none
+	withAttachment := &Notification{UserID: 4, RepoID: 1, IssueID: 1, CommentID: 2, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	for _, notf := range []*Notification{
+		withAttachment,
+		{UserID: 4, RepoID: 1, IssueID: 1, CommentID: 3, Source: NotificationSourceIssue, Status: NotificationStatusUnread},
+		{UserID: 4, RepoID: 1, IssueID: 2, Source: NotificationSourcePullRequest, Status: NotificationStatusUnread},
+	} {
+		assert.NoError(t, ImportNotification(notf))
+	}
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 4, HasAttachment: true})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.Equal(t, withAttachment.ID, nl[0].ID)
+	}
+
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 4})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 3)
+}
+
+func TestGetNotificationsDueForEmail(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 4}).(*User)
+	assert.NoError(t, user.SetEmailFrequency(time.Hour))
+
+	first := &Notification{UserID: 4, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	assert.NoError(t, ImportNotification(first))
+
+	now := timeutil.TimeStampNow()
+	nl, err := GetNotificationsDueForEmail(user, now)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.Equal(t, first.ID, nl[0].ID)
+	}
+	assert.NoError(t, MarkNotificationMailed([]int64{first.ID}))
+	assert.NotZero(t, AssertExistsAndLoadBean(t, &User{ID: 4}).(*User).LastEmailedUnix)
+
+	second := &Notification{UserID: 4, RepoID: 1, IssueID: 2, Source: NotificationSourcePullRequest, Status: NotificationStatusUnread}
+	assert.NoError(t, ImportNotification(second))
+
+	// the second batch is held back within the hour after the last email
+	nl, err = GetNotificationsDueForEmail(user, now.Add(30*60))
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+
+	nl, err = GetNotificationsDueForEmail(user, now.Add(3601))
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.Equal(t, second.ID, nl[0].ID)
+	}
+
+	// users without a frequency are emailed immediately
+	assert.NoError(t, MarkNotificationMailed([]int64{4}))
+	nl, err = GetNotificationsDueForEmail(&User{ID: 2}, now)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 1)
+}
+
+func TestGetNotificationSyncEntries(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	entries, err := GetNotificationSyncEntries(user, 946686000)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		for i, id := range []int64{3, 4, 5} {
+			notf := AssertExistsAndLoadBean(t, &Notification{ID: id}).(*Notification)
+			assert.Equal(t, NotificationSyncEntry{
+				ID:          notf.ID,
+				Status:      notf.Status,
+				IssueID:     notf.IssueID,
+				UpdatedUnix: notf.UpdatedUnix,
+			}, entries[i])
+		}
+	}
+
+	entries, err = GetNotificationSyncEntries(user, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestCreateMirrorFailureNotification(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 2 owns repo 1 and user 1 is a site admin, user 4 is no admin of repo 1
+	assert.NoError(t, CreateMirrorFailureNotification(1, []int64{1, 2, 4}, "connection refused"))
+	assert.NoError(t, CreateMirrorFailureNotification(1, []int64{1, 2, 4}, "authentication\nfailed"))
+	for _, userID := range []int64{1, 2} {
+		AssertCount(t, &Notification{UserID: userID, Source: NotificationSourceRepository}, 1)
+	}
+	AssertCount(t, &Notification{UserID: 4, Source: NotificationSourceRepository}, 0)
+
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 2, Source: NotificationSourceRepository}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, NotificationActionMirrorFailed, notf.Action)
+	assert.Equal(t, "authentication failed", notf.SubjectTitle)
+
+	// another failure after the notification has been read bumps it back to unread
+	assert.NoError(t, SetNotificationStatus(notf.ID, &User{ID: 2}, NotificationStatusRead))
+	assert.NoError(t, CreateMirrorFailureNotification(1, []int64{2}, "timeout"))
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: notf.ID}).(*Notification)
+	assert.Equal(t, NotificationStatusUnread, notf.Status)
+	assert.Equal(t, "timeout", notf.SubjectTitle)
+
+	assert.NoError(t, notf.LoadAttributes())
+	subject := notf.APIFormat("en-US").Subject
+	assert.Equal(t, "Repository", subject.Type)
+	assert.Equal(t, "Mirror sync failed: timeout", subject.Title)
+	assert.Equal(t, setting.AppURL+"user2/repo1/settings", subject.URL)
+	assert.Equal(t, NotificationActionMirrorFailed, subject.Action)
+	assert.Equal(t, setting.AppURL+"user2/repo1/settings", notf.HTMLURL())
+}
+
+func TestNotification_ExternalTrackerURL(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	notf := AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	url, err := notf.RefURL()
+	assert.NoError(t, err)
+	assert.Equal(t, setting.AppURL+"user2/repo1/issues/1", url)
+
+	_, err = x.Insert(&RepoUnit{
+		RepoID: 1,
+		Type:   UnitTypeExternalTracker,
+		Config: &ExternalTrackerConfig{
+			ExternalTrackerURL:    "https://tracker.example.com",
+			ExternalTrackerFormat: "https://tracker.example.com/{user}/{repo}/issues/{index}",
+			ExternalTrackerStyle:  "numeric",
+		},
+	})
+	assert.NoError(t, err)
+
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification)
+	url, err = notf.RefURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://tracker.example.com/user2/repo1/issues/1", url)
+	assert.NoError(t, notf.LoadAttributes())
+	assert.Equal(t, "https://tracker.example.com/user2/repo1/issues/1", notf.APIFormat("en-US").Subject.URL)
+
+	// pull requests are not tracked externally
+	notf = AssertExistsAndLoadBean(t, &Notification{ID: 2}).(*Notification)
+	url, err = notf.RefURL()
+	assert.NoError(t, err)
+	assert.Equal(t, setting.AppURL+"user2/repo1/pulls/2", url)
+}
+
+func TestApplyNotificationStatusChanges(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	affected, err := ApplyNotificationStatusChanges(user, map[int64]NotificationStatus{
+		2: NotificationStatusUnread,
+		3: NotificationStatusPinned,
+		4: NotificationStatusRead,
+		5: NotificationStatusDone,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, affected)
+	for id, status := range map[int64]NotificationStatus{
+		2: NotificationStatusUnread,
+		3: NotificationStatusPinned,
+		4: NotificationStatusRead,
+		5: NotificationStatusDone,
+	} {
+		assert.Equal(t, status, AssertExistsAndLoadBean(t, &Notification{ID: id}).(*Notification).Status)
+	}
+	assert.NotZero(t, AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification).ReadUnix)
+}
+
+func TestApplyNotificationStatusChanges_Rollback(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	// notification 1 belongs to user 1, so none of the changes is applied
+	_, err := ApplyNotificationStatusChanges(user, map[int64]NotificationStatus{
+		1: NotificationStatusRead,
+		4: NotificationStatusRead,
+		5: NotificationStatusDone,
+	})
+	assert.True(t, IsErrNotificationForbidden(err))
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{ID: 1}).(*Notification).Status)
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification).Status)
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{ID: 5}).(*Notification).Status)
+
+	_, err = ApplyNotificationStatusChanges(user, map[int64]NotificationStatus{4: NotificationStatusRead, 1000: NotificationStatusRead})
+	assert.True(t, IsErrNotificationNotExist(err))
+	assert.Equal(t, NotificationStatusUnread, AssertExistsAndLoadBean(t, &Notification{ID: 4}).(*Notification).Status)
+
+	_, err = ApplyNotificationStatusChanges(user, map[int64]NotificationStatus{4: 0})
+	assert.Error(t, err)
+}
+
+func TestGetCachedUnreadCount(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	notificationUnreadCounts.invalidate(0)
+	user := AssertExistsAndLoadBean(t, &User{ID: 2}).(*User)
+
+	count, err := GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	// raw statements bypass the invalidation, so the cached count is served
+	_, err = x.Exec("UPDATE notification SET status = ? WHERE id = ?", NotificationStatusRead, 4)
+	assert.NoError(t, err)
+	count, err = GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+	_, err = x.Exec("UPDATE notification SET status = ? WHERE id = ?", NotificationStatusUnread, 4)
+	assert.NoError(t, err)
+
+	notf := &Notification{UserID: 2, RepoID: 1, IssueID: 1, Source: NotificationSourceIssue, Status: NotificationStatusUnread}
+	assert.NoError(t, ImportNotification(notf))
+	count, err = GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	assert.NoError(t, SetNotificationStatus(notf.ID, user, NotificationStatusRead))
+	count, err = GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	// snoozed notifications are not counted until they wake up
+	assert.NoError(t, SnoozeNotification(4, user, timeutil.TimeStampNow()+2))
+	count, err = GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	_, generation, ok := notificationUnreadCounts.get(user.ID, timeutil.TimeStampNow()+2)
+	assert.False(t, ok)
+	assert.NoError(t, SnoozeNotification(4, user, 0))
+	count, err = GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+	_, newGeneration, _ := notificationUnreadCounts.get(user.ID, timeutil.TimeStampNow())
+	assert.NotEqual(t, generation, newGeneration)
+
+	// updates by condition invalidate all counts
+	_, err = MarkAllReadKeepPinned(user)
+	assert.NoError(t, err)
+	count, err = GetCachedUnreadCount(user)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestGetNotifications_OnlyActionable(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 4 is a collaborator with write access to repo 4
+	issue := &Issue{RepoID: 4, Index: 1, PosterID: 5, Title: "review me", IsPull: true}
+	_, err := x.Insert(issue)
+	assert.NoError(t, err)
+	assert.NoError(t, CreateReviewRequestNotification(issue.ID, 4, 5))
+	assert.NoError(t, ImportNotification(&Notification{UserID: 4, Source: NotificationSourceSystem, SubjectTitle: "Maintenance"}))
+
+	opts := FindNotificationOptions{UserID: 4, OnlyActionable: true}
+	nl, err := GetNotifications(opts)
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+
+	repo := AssertExistsAndLoadBean(t, &Repository{ID: 4}).(*Repository)
+	assert.NoError(t, repo.ChangeCollaborationAccessMode(4, AccessModeRead))
+	nl, err = GetNotifications(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.Equal(t, NotificationSourceSystem, nl[0].Source)
+	}
+
+	nl, err = GetNotifications(FindNotificationOptions{UserID: 4})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 2)
+}
+
+func TestDiffNotifications(t *testing.T) {
+	previous := NotificationList{
+		{ID: 1, Status: NotificationStatusUnread, UpdatedUnix: 100},
+		{ID: 2, Status: NotificationStatusUnread, UpdatedUnix: 100},
+		{ID: 3, Status: NotificationStatusRead, UpdatedUnix: 100},
+		{ID: 4, Status: NotificationStatusUnread, UpdatedUnix: 100},
+	}
+
+	delta := DiffNotifications(previous, previous)
+	assert.True(t, delta.IsEmpty())
+
+	current := NotificationList{
+		{ID: 6, Status: NotificationStatusUnread, UpdatedUnix: 200},
+		{ID: 4, Status: NotificationStatusUnread, UpdatedUnix: 150},
+		{ID: 3, Status: NotificationStatusUnread, UpdatedUnix: 100},
+		{ID: 5, Status: NotificationStatusUnread, UpdatedUnix: 200},
+		{ID: 1, Status: NotificationStatusDone, UpdatedUnix: 120},
+	}
+	delta = DiffNotifications(previous, current)
+	assert.False(t, delta.IsEmpty())
+	assert.Equal(t, []int64{5, 6}, delta.Added)
+	assert.Equal(t, []int64{2}, delta.Removed)
+	assert.Equal(t, []int64{1, 3}, delta.StatusChanged)
+	assert.Equal(t, []int64{4}, delta.Updated)
+
+	delta = DiffNotifications(nil, previous)
+	assert.Equal(t, []int64{1, 2, 3, 4}, delta.Added)
+	assert.Empty(t, delta.Removed)
+
+	delta = DiffNotifications(previous, nil)
+	assert.Equal(t, []int64{1, 2, 3, 4}, delta.Removed)
+	assert.Empty(t, delta.Added)
+}
+
+func TestGetMentionOnlyNotifications(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 4 watches repo 1, user 5 does not
+	assert.NoError(t, CreateMentionNotifications(1, 2, 2, []int64{2, 4, 5, 5}))
+	AssertCount(t, &Notification{IssueID: 1, UserID: 2}, 0)
+	for _, userID := range []int64{4, 5} {
+		notf := AssertExistsAndLoadBean(t, &Notification{UserID: userID, IssueID: 1}).(*Notification)
+		assert.Equal(t, NotificationReasonMention, notf.Reason)
+		assert.EqualValues(t, 2, notf.CommentID)
+	}
+
+	user := AssertExistsAndLoadBean(t, &User{ID: 5}).(*User)
+	nl, err := GetMentionOnlyNotifications(user, FindNotificationOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, nl, 1) {
+		assert.EqualValues(t, 1, nl[0].IssueID)
+	}
+
+	nl, err = GetMentionOnlyNotifications(AssertExistsAndLoadBean(t, &User{ID: 4}).(*User), FindNotificationOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+
+	// once user 5 watches the issue the mention is no longer the only way to be notified
+	assert.NoError(t, CreateOrUpdateIssueWatch(5, 1, true))
+	nl, err = GetMentionOnlyNotifications(user, FindNotificationOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, nl, 0)
+}
+
+func TestSetNotificationStatus_MarksIssueRead(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	// user 4 has an unread issue-user relation to issue 1
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	notf := AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1}).(*Notification)
+	issue := AssertExistsAndLoadBean(t, &Issue{ID: 1}).(*Issue)
+	assert.NoError(t, issue.GetIsRead(4))
+	assert.False(t, issue.IsRead)
+
+	assert.NoError(t, SetNotificationStatus(notf.ID, &User{ID: 4}, NotificationStatusRead))
+	assert.Equal(t, NotificationStatusRead, AssertExistsAndLoadBean(t, &Notification{ID: notf.ID}).(*Notification).Status)
+	assert.NoError(t, issue.GetIsRead(4))
+	assert.True(t, issue.IsRead)
+
+	// user 2 has no relation to issue 5 yet
+	assert.NoError(t, SetNotificationStatus(4, &User{ID: 2}, NotificationStatusDone))
+	AssertExistsAndLoadBean(t, &IssueUser{UID: 2, IssueID: 5, IsRead: true})
+
+	// pinning a read notification does not touch the issue
+	assert.NoError(t, SetNotificationStatus(2, &User{ID: 2}, NotificationStatusPinned))
+	AssertNotExistsBean(t, &IssueUser{UID: 2, IssueID: 2})
+}
+
+func TestCreateOrUpdateIssueNotifications_SkipBots(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+	defer func(skip bool) { setting.Service.NotificationSkipBots = skip }(setting.Service.NotificationSkipBots)
+	setting.Service.NotificationSkipBots = true
+
+	// user 4 watches repo 1
+	_, err := x.ID(4).Cols("type").Update(&User{Type: UserTypeBot})
+	assert.NoError(t, err)
+
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	AssertExistsAndLoadBean(t, &Notification{UserID: 1, IssueID: 1})
+	AssertNotExistsBean(t, &Notification{UserID: 4, IssueID: 1})
+
+	_, err = x.ID(4).Cols("bot_notifications_opt_in").Update(&User{BotNotificationsOptIn: true})
+	assert.NoError(t, err)
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1})
+
+	// bots are notified like any other user if they are not skipped
+	assert.NoError(t, PrepareTestDatabase())
+	_, err = x.ID(4).Cols("type").Update(&User{Type: UserTypeBot})
+	assert.NoError(t, err)
+	setting.Service.NotificationSkipBots = false
+	assert.NoError(t, CreateOrUpdateIssueNotifications(1, 0, 2))
+	AssertExistsAndLoadBean(t, &Notification{UserID: 4, IssueID: 1})
+}
+
+func TestGetNotifications_SortRepoRecency(t *testing.T) {
+	assert.NoError(t, PrepareTestDatabase())
+
+	older := &Notification{UserID: 2, RepoID: 2, IssueID: 4, Source: NotificationSourcePullRequest, Status: NotificationStatusUnread, UpdatedUnix: 946680000}
+	// repo10 is sorted by name between repo1 and repo2
+	repo10 := &Notification{UserID: 2, RepoID: 10, CommitID: "65f1bf27bc3bf70f64657658635e66094edbcb4d", Source: NotificationSourceCommit, Status: NotificationStatusRead, UpdatedUnix: 946690000}
+	system := &Notification{UserID: 2, Source: NotificationSourceSystem, SubjectTitle: "Maintenance", UpdatedUnix: 946700000}
+	for _, notf := range []*Notification{older, repo10, system} {
+		assert.NoError(t, ImportNotification(notf))
+	}
+
+	nl, err := GetNotifications(FindNotificationOptions{UserID: 2, SortType: "repo_recency"})
+	assert.NoError(t, err)
+	ids := make([]int64, 0, len(nl))
+	for _, notf := range nl {
+		ids = append(ids, notf.ID)
+	}
+	assert.Equal(t, []int64{4, 3, 2, repo10.ID, 5, older.ID, system.ID}, ids)
+}
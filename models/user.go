@@ -53,6 +53,9 @@ const (
 
 	// UserTypeOrganization defines an organization
 	UserTypeOrganization
+
+	// UserTypeBot defines a bot or service account
+	UserTypeBot
 )
 
 const (
@@ -99,13 +102,20 @@ type User struct {
 	Email                        string `xorm:"NOT NULL"`
 	KeepEmailPrivate             bool
 	EmailNotificationsPreference string `xorm:"VARCHAR(20) NOT NULL DEFAULT 'enabled'"`
-	Passwd                       string `xorm:"NOT NULL"`
-	PasswdHashAlgo               string `xorm:"NOT NULL DEFAULT 'pbkdf2'"`
+	// EmailFrequency is the minimum number of seconds between two notification emails, 0 emails them immediately
+	EmailFrequency int64 `xorm:"NOT NULL DEFAULT 0"`
+	// LastEmailedUnix is the last time notifications have been emailed to the user
+	LastEmailedUnix timeutil.TimeStamp `xorm:"NOT NULL DEFAULT 0"`
+	Passwd          string             `xorm:"NOT NULL"`
+	PasswdHashAlgo  string             `xorm:"NOT NULL DEFAULT 'pbkdf2'"`
 
 	// MustChangePassword is an attribute that determines if a user
 	// is to change his/her password after registration.
 	MustChangePassword bool `xorm:"NOT NULL DEFAULT false"`
 
+	// BotNotificationsOptIn lets a bot receive notifications although setting.Service.NotificationSkipBots is set
+	BotNotificationsOptIn bool `xorm:"NOT NULL DEFAULT false"`
+
 	LoginType   LoginType
 	LoginSource int64 `xorm:"NOT NULL DEFAULT 0"`
 	LoginName   string
@@ -569,6 +579,11 @@ func (u *User) IsOrganization() bool {
 	return u.Type == UserTypeOrganization
 }
 
+// IsBot returns true if user is a bot or service account.
+func (u *User) IsBot() bool {
+	return u.Type == UserTypeBot
+}
+
 // IsUserOrgOwner returns true if user is in the owner team of given organization.
 func (u *User) IsUserOrgOwner(orgID int64) bool {
 	isOwner, err := IsOrganizationOwner(orgID, u.ID)
@@ -761,6 +776,16 @@ func (u *User) SetEmailNotifications(set string) error {
 	return nil
 }
 
+// SetEmailFrequency sets the minimum time between two notification emails of the user
+func (u *User) SetEmailFrequency(frequency time.Duration) error {
+	u.EmailFrequency = int64(frequency / time.Second)
+	if err := UpdateUserCols(u, "email_frequency"); err != nil {
+		log.Error("SetEmailFrequency: %v", err)
+		return err
+	}
+	return nil
+}
+
 func isUserExist(e Engine, uid int64, name string) (bool, error) {
 	if len(name) == 0 {
 		return false, nil
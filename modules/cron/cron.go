@@ -21,13 +21,16 @@ import (
 )
 
 const (
-	mirrorUpdate            = "mirror_update"
-	gitFsck                 = "git_fsck"
-	checkRepos              = "check_repos"
-	archiveCleanup          = "archive_cleanup"
-	syncExternalUsers       = "sync_external_users"
-	deletedBranchesCleanup  = "deleted_branches_cleanup"
-	updateMigrationPosterID = "update_migration_post_id"
+	mirrorUpdate              = "mirror_update"
+	gitFsck                   = "git_fsck"
+	checkRepos                = "check_repos"
+	archiveCleanup            = "archive_cleanup"
+	syncExternalUsers         = "sync_external_users"
+	deletedBranchesCleanup    = "deleted_branches_cleanup"
+	updateMigrationPosterID   = "update_migration_post_id"
+	wakeNotificationSnoozes   = "wake_notification_snoozes"
+	fireNotificationReminders = "fire_notification_reminders"
+	purgeDeletedNotifications = "purge_deleted_notifications"
 )
 
 var c = cron.New()
@@ -123,6 +126,39 @@ func NewContext() {
 			go WithUnique(deletedBranchesCleanup, models.RemoveOldDeletedBranches)()
 		}
 	}
+	if setting.Cron.WakeNotificationSnoozes.Enabled {
+		entry, err = c.AddFunc("Wake snoozed notifications", setting.Cron.WakeNotificationSnoozes.Schedule, WithUnique(wakeNotificationSnoozes, models.WakeNotificationSnoozes))
+		if err != nil {
+			log.Fatal("Cron[Wake snoozed notifications]: %v", err)
+		}
+		if setting.Cron.WakeNotificationSnoozes.RunAtStart {
+			entry.Prev = time.Now()
+			entry.ExecTimes++
+			go WithUnique(wakeNotificationSnoozes, models.WakeNotificationSnoozes)()
+		}
+	}
+	if setting.Cron.FireNotificationReminders.Enabled {
+		entry, err = c.AddFunc("Fire notification reminders", setting.Cron.FireNotificationReminders.Schedule, WithUnique(fireNotificationReminders, models.FireNotificationReminders))
+		if err != nil {
+			log.Fatal("Cron[Fire notification reminders]: %v", err)
+		}
+		if setting.Cron.FireNotificationReminders.RunAtStart {
+			entry.Prev = time.Now()
+			entry.ExecTimes++
+			go WithUnique(fireNotificationReminders, models.FireNotificationReminders)()
+		}
+	}
+	if setting.Cron.PurgeDeletedNotifications.Enabled {
+		entry, err = c.AddFunc("Purge deleted notifications", setting.Cron.PurgeDeletedNotifications.Schedule, WithUnique(purgeDeletedNotifications, models.PurgeOldDeletedNotifications))
+		if err != nil {
+			log.Fatal("Cron[Purge deleted notifications]: %v", err)
+		}
+		if setting.Cron.PurgeDeletedNotifications.RunAtStart {
+			entry.Prev = time.Now()
+			entry.ExecTimes++
+			go WithUnique(purgeDeletedNotifications, models.PurgeOldDeletedNotifications)()
+		}
+	}
 
 	entry, err = c.AddFunc("Update migrated repositories' issues and comments' posterid", setting.Cron.UpdateMigrationPosterID.Schedule, WithUnique(updateMigrationPosterID, migrations.UpdateMigrationPosterID))
 	if err != nil {
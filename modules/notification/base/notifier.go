@@ -40,6 +40,7 @@ type Notifier interface {
 		*models.Issue, *models.Comment)
 	NotifyUpdateComment(*models.User, *models.Comment, string)
 	NotifyDeleteComment(*models.User, *models.Comment)
+	NotifyReaction(doer *models.User, c *models.Comment, reaction *models.Reaction)
 
 	NotifyNewRelease(rel *models.Release)
 	NotifyUpdateRelease(doer *models.User, rel *models.Release)
@@ -62,6 +62,10 @@ func (*NullNotifier) NotifyUpdateComment(doer *models.User, c *models.Comment, o
 func (*NullNotifier) NotifyDeleteComment(doer *models.User, c *models.Comment) {
 }
 
+// NotifyReaction places a place holder function
+func (*NullNotifier) NotifyReaction(doer *models.User, c *models.Comment, reaction *models.Reaction) {
+}
+
 // NotifyNewRelease places a place holder function
 func (*NullNotifier) NotifyNewRelease(rel *models.Release) {
 }
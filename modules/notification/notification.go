@@ -108,6 +108,13 @@ func NotifyDeleteComment(doer *models.User, c *models.Comment) {
 	}
 }
 
+// NotifyReaction notifies a reaction to a comment to notifiers
+func NotifyReaction(doer *models.User, c *models.Comment, reaction *models.Reaction) {
+	for _, notifier := range notifiers {
+		notifier.NotifyReaction(doer, c, reaction)
+	}
+}
+
 // NotifyNewRelease notifies new release to notifiers
 func NotifyNewRelease(rel *models.Release) {
 	for _, notifier := range notifiers {
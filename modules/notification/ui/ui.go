@@ -5,22 +5,55 @@
 package ui
 
 import (
+	"strings"
+
 	"code.gitea.io/gitea/models"
 	"code.gitea.io/gitea/modules/git"
 	"code.gitea.io/gitea/modules/log"
 	"code.gitea.io/gitea/modules/notification/base"
+	"code.gitea.io/gitea/modules/references"
+	"code.gitea.io/gitea/modules/setting"
 )
 
 type (
 	notificationService struct {
 		base.NullNotifier
-		issueQueue chan issueNotificationOpts
+		issueQueue         chan issueNotificationOpts
+		pushQueue          chan pushNotificationOpts
+		reactionQueue      chan reactionNotificationOpts
+		reviewRequestQueue chan reviewRequestNotificationOpts
 	}
 
 	issueNotificationOpts struct {
 		issueID              int64
 		commentID            int64
 		notificationAuthorID int64
+		event                models.NotificationEvent
+		// reviewVerdict and prAuthorID are set for reviews to notify the author of the pull request about the verdict
+		reviewVerdict string
+		prAuthorID    int64
+		// mentionedIDs are the users mentioned in the issue or comment content
+		mentionedIDs []int64
+	}
+
+	pushNotificationOpts struct {
+		repoID int64
+		// commitIDs are the pushed commits, newest first
+		commitIDs []string
+		pusherID  int64
+	}
+
+	reactionNotificationOpts struct {
+		issueID         int64
+		commentID       int64
+		reactorID       int64
+		commentAuthorID int64
+	}
+
+	reviewRequestNotificationOpts struct {
+		issueID     int64
+		reviewerID  int64
+		requesterID int64
 	}
 )
 
@@ -31,18 +64,70 @@ var (
 // NewNotifier create a new notificationService notifier
 func NewNotifier() base.Notifier {
 	return &notificationService{
-		issueQueue: make(chan issueNotificationOpts, 100),
+		issueQueue:         make(chan issueNotificationOpts, 100),
+		pushQueue:          make(chan pushNotificationOpts, 100),
+		reactionQueue:      make(chan reactionNotificationOpts, 100),
+		reviewRequestQueue: make(chan reviewRequestNotificationOpts, 100),
 	}
 }
 
 func (ns *notificationService) Run() {
-	for opts := range ns.issueQueue {
-		if err := models.CreateOrUpdateIssueNotifications(opts.issueID, opts.commentID, opts.notificationAuthorID); err != nil {
-			log.Error("Was unable to create issue notification: %v", err)
+	for {
+		select {
+		case opts := <-ns.issueQueue:
+			ns.createIssueNotifications(opts)
+		case opts := <-ns.pushQueue:
+			if err := models.CreatePushNotifications(opts.repoID, opts.commitIDs, opts.pusherID); err != nil {
+				log.Error("Was unable to create push notification: %v", err)
+			}
+		case opts := <-ns.reactionQueue:
+			if err := models.CreateReactionNotification(opts.issueID, opts.commentID, opts.reactorID, opts.commentAuthorID); err != nil {
+				log.Error("Was unable to create reaction notification: %v", err)
+			}
+		case opts := <-ns.reviewRequestQueue:
+			if err := models.CreateReviewRequestNotification(opts.issueID, opts.reviewerID, opts.requesterID); err != nil {
+				log.Error("Was unable to create review request notification: %v", err)
+			}
 		}
 	}
 }
 
+func (ns *notificationService) createIssueNotifications(opts issueNotificationOpts) {
+	var err error
+	if opts.event == models.NotificationEventReopen {
+		err = models.CreateReopenNotifications(opts.issueID, opts.notificationAuthorID)
+	} else {
+		err = models.CreateOrUpdateIssueNotificationsForEvent(opts.issueID, opts.commentID, opts.notificationAuthorID, opts.event)
+	}
+	if err != nil {
+		log.Error("Was unable to create issue notification: %v", err)
+	}
+	if opts.reviewVerdict != "" {
+		if err := models.CreateReviewVerdictNotification(opts.issueID, opts.prAuthorID, opts.notificationAuthorID, opts.reviewVerdict); err != nil {
+			log.Error("Was unable to create review verdict notification: %v", err)
+		}
+	}
+	if len(opts.mentionedIDs) > 0 {
+		if err := models.CreateMentionNotifications(opts.issueID, opts.commentID, opts.notificationAuthorID, opts.mentionedIDs); err != nil {
+			log.Error("Was unable to create mention notification: %v", err)
+		}
+	}
+}
+
+// mentionedUserIDs returns the IDs of the users mentioned in content who can read the issue
+func mentionedUserIDs(issue *models.Issue, doer *models.User, content string) []int64 {
+	mentions, err := issue.ResolveMentionsByVisibility(models.DefaultDBContext(), doer, references.FindAllMentionsMarkdown(content))
+	if err != nil {
+		log.Error("ResolveMentionsByVisibility [%d]: %v", issue.ID, err)
+		return nil
+	}
+	ids := make([]int64, len(mentions))
+	for i, u := range mentions {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
 func (ns *notificationService) NotifyCreateIssueComment(doer *models.User, repo *models.Repository,
 	issue *models.Issue, comment *models.Comment) {
 	var opts = issueNotificationOpts{
@@ -51,6 +136,7 @@ func (ns *notificationService) NotifyCreateIssueComment(doer *models.User, repo
 	}
 	if comment != nil {
 		opts.commentID = comment.ID
+		opts.mentionedIDs = mentionedUserIDs(issue, doer, comment.Content)
 	}
 	ns.issueQueue <- opts
 }
@@ -59,37 +145,97 @@ func (ns *notificationService) NotifyNewIssue(issue *models.Issue) {
 	ns.issueQueue <- issueNotificationOpts{
 		issueID:              issue.ID,
 		notificationAuthorID: issue.Poster.ID,
+		mentionedIDs:         mentionedUserIDs(issue, issue.Poster, issue.Content),
 	}
 }
 
 func (ns *notificationService) NotifyIssueChangeStatus(doer *models.User, issue *models.Issue, actionComment *models.Comment, isClosed bool) {
-	ns.issueQueue <- issueNotificationOpts{
+	var opts = issueNotificationOpts{
 		issueID:              issue.ID,
 		notificationAuthorID: doer.ID,
+		event:                models.NotificationEventReopen,
 	}
+	if isClosed {
+		opts.event = models.NotificationEventClose
+	}
+	ns.issueQueue <- opts
 }
 
 func (ns *notificationService) NotifyMergePullRequest(pr *models.PullRequest, doer *models.User, gitRepo *git.Repository) {
 	ns.issueQueue <- issueNotificationOpts{
 		issueID:              pr.Issue.ID,
 		notificationAuthorID: doer.ID,
+		event:                models.NotificationEventMerge,
 	}
 }
 
 func (ns *notificationService) NotifyNewPullRequest(pr *models.PullRequest) {
-	ns.issueQueue <- issueNotificationOpts{
+	var opts = issueNotificationOpts{
 		issueID:              pr.Issue.ID,
 		notificationAuthorID: pr.Issue.PosterID,
 	}
+	if err := pr.Issue.LoadPoster(); err != nil {
+		log.Error("LoadPoster: %v", err)
+	} else {
+		opts.mentionedIDs = mentionedUserIDs(pr.Issue, pr.Issue.Poster, pr.Issue.Content)
+	}
+	ns.issueQueue <- opts
 }
 
 func (ns *notificationService) NotifyPullRequestReview(pr *models.PullRequest, r *models.Review, c *models.Comment) {
 	var opts = issueNotificationOpts{
 		issueID:              pr.Issue.ID,
 		notificationAuthorID: r.Reviewer.ID,
+		prAuthorID:           pr.Issue.PosterID,
+	}
+	switch r.Type {
+	case models.ReviewTypeApprove:
+		opts.reviewVerdict = models.NotificationActionReviewApprove
+	case models.ReviewTypeReject:
+		opts.reviewVerdict = models.NotificationActionReviewReject
+	case models.ReviewTypeComment:
+		opts.reviewVerdict = models.NotificationActionReviewComment
 	}
 	if c != nil {
 		opts.commentID = c.ID
 	}
 	ns.issueQueue <- opts
 }
+
+// NotifyIssueChangeAssignee requests the review of the pull request from the assignee
+func (ns *notificationService) NotifyIssueChangeAssignee(doer *models.User, issue *models.Issue, assignee *models.User, removed bool, comment *models.Comment) {
+	if !issue.IsPull || removed {
+		return
+	}
+
+	ns.reviewRequestQueue <- reviewRequestNotificationOpts{
+		issueID:     issue.ID,
+		reviewerID:  assignee.ID,
+		requesterID: doer.ID,
+	}
+}
+
+func (ns *notificationService) NotifyPushCommits(pusher *models.User, repo *models.Repository, refName, oldCommitID, newCommitID string, commits *models.PushCommits) {
+	if !setting.Service.NotificationOnPush || !strings.HasPrefix(refName, git.BranchPrefix) || commits == nil || len(commits.Commits) == 0 {
+		return
+	}
+
+	var opts = pushNotificationOpts{
+		repoID:    repo.ID,
+		commitIDs: make([]string, 0, len(commits.Commits)),
+		pusherID:  pusher.ID,
+	}
+	for _, commit := range commits.Commits {
+		opts.commitIDs = append(opts.commitIDs, commit.Sha1)
+	}
+	ns.pushQueue <- opts
+}
+
+func (ns *notificationService) NotifyReaction(doer *models.User, c *models.Comment, reaction *models.Reaction) {
+	ns.reactionQueue <- reactionNotificationOpts{
+		issueID:         c.IssueID,
+		commentID:       c.ID,
+		reactorID:       doer.ID,
+		commentAuthorID: c.PosterID,
+	}
+}
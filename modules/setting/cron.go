@@ -52,6 +52,22 @@ var (
 		UpdateMigrationPosterID struct {
 			Schedule string
 		} `ini:"cron.update_migration_poster_id"`
+		WakeNotificationSnoozes struct {
+			Enabled    bool
+			RunAtStart bool
+			Schedule   string
+		} `ini:"cron.wake_notification_snoozes"`
+		FireNotificationReminders struct {
+			Enabled    bool
+			RunAtStart bool
+			Schedule   string
+		} `ini:"cron.fire_notification_reminders"`
+		PurgeDeletedNotifications struct {
+			Enabled    bool
+			RunAtStart bool
+			Schedule   string
+			OlderThan  time.Duration
+		} `ini:"cron.purge_deleted_notifications"`
 	}{
 		UpdateMirror: struct {
 			Enabled    bool
@@ -122,6 +138,35 @@ var (
 		}{
 			Schedule: "@every 24h",
 		},
+		WakeNotificationSnoozes: struct {
+			Enabled    bool
+			RunAtStart bool
+			Schedule   string
+		}{
+			Enabled:    true,
+			RunAtStart: false,
+			Schedule:   "@every 10m",
+		},
+		FireNotificationReminders: struct {
+			Enabled    bool
+			RunAtStart bool
+			Schedule   string
+		}{
+			Enabled:    true,
+			RunAtStart: false,
+			Schedule:   "@every 5m",
+		},
+		PurgeDeletedNotifications: struct {
+			Enabled    bool
+			RunAtStart bool
+			Schedule   string
+			OlderThan  time.Duration
+		}{
+			Enabled:    true,
+			RunAtStart: false,
+			Schedule:   "@every 24h",
+			OlderThan:  7 * 24 * time.Hour,
+		},
 	}
 )
 
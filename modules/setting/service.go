@@ -6,6 +6,7 @@ package setting
 
 import (
 	"regexp"
+	"time"
 
 	"code.gitea.io/gitea/modules/structs"
 )
@@ -46,6 +47,12 @@ var Service struct {
 	EnableUserHeatmap                       bool
 	AutoWatchNewRepos                       bool
 	AutoWatchOnChanges                      bool
+	NotificationFanOutWorkers               int
+	NotificationRepoCap                     int
+	NotificationRepoCapWindow               time.Duration
+	NotificationInboxStatuses               []string
+	NotificationSkipBots                    bool
+	NotificationOnPush                      bool
 	DefaultOrgMemberVisible                 bool
 
 	// OpenID settings
@@ -89,6 +96,15 @@ func newService() {
 	Service.EnableUserHeatmap = sec.Key("ENABLE_USER_HEATMAP").MustBool(true)
 	Service.AutoWatchNewRepos = sec.Key("AUTO_WATCH_NEW_REPOS").MustBool(true)
 	Service.AutoWatchOnChanges = sec.Key("AUTO_WATCH_ON_CHANGES").MustBool(false)
+	Service.NotificationFanOutWorkers = sec.Key("NOTIFICATION_FAN_OUT_WORKERS").MustInt(1)
+	Service.NotificationRepoCap = sec.Key("NOTIFICATION_REPO_CAP").MustInt(0)
+	Service.NotificationRepoCapWindow = sec.Key("NOTIFICATION_REPO_CAP_WINDOW").MustDuration(time.Minute)
+	Service.NotificationInboxStatuses = sec.Key("NOTIFICATION_INBOX_STATUSES").Strings(",")
+	if len(Service.NotificationInboxStatuses) == 0 {
+		Service.NotificationInboxStatuses = []string{"unread"}
+	}
+	Service.NotificationSkipBots = sec.Key("NOTIFICATION_SKIP_BOTS").MustBool(true)
+	Service.NotificationOnPush = sec.Key("NOTIFICATION_ON_PUSH").MustBool(false)
 	Service.DefaultOrgVisibility = sec.Key("DEFAULT_ORG_VISIBILITY").In("public", structs.ExtractKeysFromMapString(structs.VisibilityModes))
 	Service.DefaultOrgVisibilityMode = structs.VisibilityModes[Service.DefaultOrgVisibility]
 	Service.DefaultOrgMemberVisible = sec.Key("DEFAULT_ORG_MEMBER_VISIBLE").MustBool()
@@ -187,6 +187,9 @@ var (
 		User struct {
 			RepoPagingNum int
 		} `ini:"ui.user"`
+		Notification struct {
+			MaxUnreadListSize int
+		} `ini:"ui.notification"`
 		Meta struct {
 			Author      string
 			Description string
@@ -222,6 +225,11 @@ var (
 		}{
 			RepoPagingNum: 15,
 		},
+		Notification: struct {
+			MaxUnreadListSize int
+		}{
+			MaxUnreadListSize: 500,
+		},
 		Meta: struct {
 			Author      string
 			Description string
@@ -15,14 +15,31 @@ type NotificationThread struct {
 	Subject    *NotificationSubject `json:"subject"`
 	Unread     bool                 `json:"unread"`
 	Pinned     bool                 `json:"pinned"`
+	PinNote    string               `json:"pin_note"`
 	UpdatedAt  time.Time            `json:"updated_at"`
+	UpdatedAgo string               `json:"updated_ago"`
 	URL        string               `json:"url"`
+	UserTags   []*NotificationTag   `json:"user_tags"`
+	// ActionSinceRead is how the state of the subject changed since the notification has been read,
+	// i.e. closed, merged or reopened, or empty if it did not change
+	ActionSinceRead string `json:"action_since_read"`
 }
 
-// NotificationSubject contains the notification subject (Issue/Pull/Commit)
+// NotificationTag is a personal tag a user put on a notification thread
+type NotificationTag struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// NotificationSubject contains the notification subject (Issue/Pull/Commit/System)
 type NotificationSubject struct {
-	Title            string `json:"title"`
-	URL              string `json:"url"`
-	LatestCommentURL string `json:"latest_comment_url"`
-	Type             string `json:"type" binding:"In(Issue,Pull,Commit)"`
+	Title            string  `json:"title"`
+	URL              string  `json:"url"`
+	LatestCommentURL string  `json:"latest_comment_url"`
+	Type             string  `json:"type" binding:"In(Issue,Pull,Commit,System,Repository)"`
+	Participants     []*User `json:"participants"`
+	IconName         string  `json:"icon_name"`
+	Action           string  `json:"action"`
+	// swagger:strfmt date-time
+	DueDate *time.Time `json:"due_date"`
 }
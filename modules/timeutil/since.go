@@ -141,6 +141,11 @@ func RawTimeSince(t time.Time, lang string) string {
 	return timeSince(t, time.Now(), lang)
 }
 
+// RawTimeSinceUnix returns the user-friendly time interval between then and now
+func RawTimeSinceUnix(then, now TimeStamp, lang string) string {
+	return timeSinceUnix(int64(then), int64(now), lang)
+}
+
 // TimeSince calculates the time interval and generate user-friendly string.
 func TimeSince(then time.Time, lang string) template.HTML {
 	return htmlTimeSince(then, time.Now(), lang)
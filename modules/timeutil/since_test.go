@@ -70,6 +70,13 @@ func TestTimeSince(t *testing.T) {
 	test("2 years", 2*YearDur, 2*YearDur+6*MonthDur)
 }
 
+func TestRawTimeSinceUnix(t *testing.T) {
+	then := TimeStamp(BaseDate.Unix())
+	assert.Equal(t, "now", RawTimeSinceUnix(then, then, "en"))
+	assert.Equal(t, "3 hours ago", RawTimeSinceUnix(then, then.Add(3*60*60), "en"))
+	assert.Equal(t, "2 days from now", RawTimeSinceUnix(then.Add(2*24*60*60), then, "en"))
+}
+
 func TestTimeSincePro(t *testing.T) {
 	assert.Equal(t, "now", timeSincePro(BaseDate, BaseDate, "en"))
 
@@ -5,6 +5,7 @@
 package notify
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -65,6 +66,7 @@ func ListRepoNotifications(ctx *context.APIContext) {
 		RepoID:            ctx.Repo.Repository.ID,
 		UpdatedBeforeUnix: before,
 		UpdatedAfterUnix:  since,
+		AccessibleBy:      ctx.User,
 	}
 	qAll := strings.Trim(ctx.Query("all"), " ")
 	if qAll != "true" {
@@ -75,13 +77,23 @@ func ListRepoNotifications(ctx *context.APIContext) {
 		ctx.InternalServerError(err)
 		return
 	}
+	count, err := models.CountNotifications(opts)
+	if err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
 	err = nl.LoadAttributes()
 	if err != nil {
 		ctx.InternalServerError(err)
 		return
 	}
+	if err = nl.LoadParticipants(); err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
 
-	ctx.JSON(http.StatusOK, nl.APIFormat())
+	ctx.Header().Set("X-Total-Count", fmt.Sprintf("%d", count))
+	ctx.JSON(http.StatusOK, nl.APIFormat(ctx.Locale.Language()))
 }
 
 // ReadRepoNotifications mark notification threads as read on a specific repo
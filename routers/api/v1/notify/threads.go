@@ -5,7 +5,6 @@
 package notify
 
 import (
-	"fmt"
 	"net/http"
 
 	"code.gitea.io/gitea/models"
@@ -30,8 +29,6 @@ func GetThread(ctx *context.APIContext) {
 	// responses:
 	//   "200":
 	//     "$ref": "#/responses/NotificationThread"
-	//   "403":
-	//     "$ref": "#/responses/forbidden"
 	//   "404":
 	//     "$ref": "#/responses/notFound"
 
@@ -43,8 +40,12 @@ func GetThread(ctx *context.APIContext) {
 		ctx.InternalServerError(err)
 		return
 	}
+	if err := (models.NotificationList{n}).LoadParticipants(); err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
 
-	ctx.JSON(http.StatusOK, n.APIFormat())
+	ctx.JSON(http.StatusOK, n.APIFormat(ctx.Locale.Language()))
 }
 
 // ReadThread mark notification as read by ID
@@ -65,8 +66,6 @@ func ReadThread(ctx *context.APIContext) {
 	// responses:
 	//   "205":
 	//     "$ref": "#/responses/empty"
-	//   "403":
-	//     "$ref": "#/responses/forbidden"
 	//   "404":
 	//     "$ref": "#/responses/notFound"
 
@@ -75,7 +74,17 @@ func ReadThread(ctx *context.APIContext) {
 		return
 	}
 
-	err := models.SetNotificationStatus(n.ID, ctx.User, models.NotificationStatusRead)
+	// administrators mark the notifications of other users as read on their behalf
+	owner := ctx.User
+	if n.UserID != ctx.User.ID {
+		var err error
+		if owner, err = models.GetUserByID(n.UserID); err != nil {
+			ctx.InternalServerError(err)
+			return
+		}
+	}
+
+	err := models.SetNotificationStatus(n.ID, owner, models.NotificationStatusRead)
 	if err != nil {
 		ctx.InternalServerError(err)
 		return
@@ -83,19 +92,20 @@ func ReadThread(ctx *context.APIContext) {
 	ctx.Status(http.StatusResetContent)
 }
 
+// getThread returns the notification of the id parameter if it belongs to the user, or to anybody if the user is
+// an administrator. The notifications of other users are hidden from the other users as if they did not exist.
 func getThread(ctx *context.APIContext) *models.Notification {
-	n, err := models.GetNotificationByID(ctx.ParamsInt64(":id"))
+	n, err := models.GetOwnedNotification(ctx.User, ctx.ParamsInt64(":id"))
+	if models.IsErrNotificationForbidden(err) && ctx.User.IsAdmin {
+		n, err = models.GetNotificationByID(ctx.ParamsInt64(":id"))
+	}
 	if err != nil {
-		if models.IsErrNotExist(err) {
-			ctx.Error(http.StatusNotFound, "GetNotificationByID", err)
+		if models.IsErrNotificationNotExist(err) || models.IsErrNotificationForbidden(err) {
+			ctx.NotFound()
 		} else {
 			ctx.InternalServerError(err)
 		}
 		return nil
 	}
-	if n.UserID != ctx.User.ID && !ctx.User.IsAdmin {
-		ctx.Error(http.StatusForbidden, "GetNotificationByID", fmt.Errorf("only user itself and admin are allowed to read/change this thread %d", n.ID))
-		return nil
-	}
 	return n
 }
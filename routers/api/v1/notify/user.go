@@ -5,6 +5,7 @@
 package notify
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -54,6 +55,7 @@ func ListNotifications(ctx *context.APIContext) {
 		UserID:            ctx.User.ID,
 		UpdatedBeforeUnix: before,
 		UpdatedAfterUnix:  since,
+		AccessibleBy:      ctx.User,
 	}
 	qAll := strings.Trim(ctx.Query("all"), " ")
 	if qAll != "true" {
@@ -64,13 +66,23 @@ func ListNotifications(ctx *context.APIContext) {
 		ctx.InternalServerError(err)
 		return
 	}
+	count, err := models.CountNotifications(opts)
+	if err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
 	err = nl.LoadAttributes()
 	if err != nil {
 		ctx.InternalServerError(err)
 		return
 	}
+	if err = nl.LoadParticipants(); err != nil {
+		ctx.InternalServerError(err)
+		return
+	}
 
-	ctx.JSON(http.StatusOK, nl.APIFormat())
+	ctx.Header().Set("X-Total-Count", fmt.Sprintf("%d", count))
+	ctx.JSON(http.StatusOK, nl.APIFormat(ctx.Locale.Language()))
 }
 
 // ReadNotifications mark notification threads as read
@@ -10,6 +10,7 @@ import (
 
 	"code.gitea.io/gitea/models"
 	"code.gitea.io/gitea/modules/context"
+	"code.gitea.io/gitea/modules/notification"
 	api "code.gitea.io/gitea/modules/structs"
 )
 
@@ -202,6 +203,8 @@ func changeIssueCommentReaction(ctx *context.APIContext, form api.EditReactionOp
 			return
 		}
 
+		notification.NotifyReaction(ctx.User, comment, reaction)
+
 		ctx.JSON(http.StatusCreated, api.Reaction{
 			User:     ctx.User.APIFormat(),
 			Reaction: reaction.Type,
@@ -53,5 +53,12 @@ func IssueWatch(ctx *context.Context) {
 		return
 	}
 
+	if watch {
+		if err := models.SeedIssueNotificationOnSubscribe(ctx.User.ID, issue.ID); err != nil {
+			ctx.ServerError("SeedIssueNotificationOnSubscribe", err)
+			return
+		}
+	}
+
 	ctx.Redirect(issue.HTMLURL(), http.StatusSeeOther)
 }
@@ -951,6 +951,7 @@ func RegisterRoutes(m *macaron.Macaron) {
 
 	m.Group("/notifications", func() {
 		m.Get("", user.Notifications)
+		m.Get("/threads/:id", user.NotificationOpen)
 		m.Post("/status", user.NotificationStatusPost)
 		m.Post("/purge", user.NotificationPurgePost)
 	}, reqSignIn)
@@ -30,9 +30,9 @@ func GetNotificationCount(c *context.Context) {
 		return
 	}
 
-	count, err := models.GetNotificationCount(c.User, models.NotificationStatusUnread)
+	count, err := models.GetCachedUnreadCount(c.User)
 	if err != nil {
-		c.ServerError("GetNotificationCount", err)
+		c.ServerError("GetCachedUnreadCount", err)
 		return
 	}
 
@@ -54,17 +54,19 @@ func Notifications(c *context.Context) {
 		perPage = 20
 	}
 
+	var statuses []models.NotificationStatus
 	switch keyword {
 	case "read":
 		status = models.NotificationStatusRead
+		statuses = []models.NotificationStatus{status, models.NotificationStatusPinned}
 	default:
 		status = models.NotificationStatusUnread
+		statuses = append(models.InboxStatuses(), models.NotificationStatusPinned)
 	}
 
-	statuses := []models.NotificationStatus{status, models.NotificationStatusPinned}
-	notifications, err := models.NotificationsForUser(c.User, statuses, page, perPage)
+	notifications, err := models.AccessibleNotificationsForUser(c.User, statuses, page, perPage)
 	if err != nil {
-		c.ServerError("ErrNotificationsForUser", err)
+		c.ServerError("AccessibleNotificationsForUser", err)
 		return
 	}
 
@@ -87,15 +89,22 @@ func Notifications(c *context.Context) {
 		return
 	}
 
-	total, err := models.GetNotificationCount(c.User, status)
+	total, err := models.CountAccessibleNotificationsForUser(c.User, statuses)
 	if err != nil {
-		c.ServerError("ErrGetNotificationCount", err)
+		c.ServerError("CountAccessibleNotificationsForUser", err)
 		return
 	}
 
 	title := c.Tr("notifications")
-	if status == models.NotificationStatusUnread && total > 0 {
-		title = fmt.Sprintf("(%d) %s", total, title)
+	if status == models.NotificationStatusUnread {
+		inboxCount, err := models.CountAccessibleNotificationsForUser(c.User, models.InboxStatuses())
+		if err != nil {
+			c.ServerError("CountAccessibleNotificationsForUser", err)
+			return
+		}
+		if inboxCount > 0 {
+			title = fmt.Sprintf("(%d) %s", inboxCount, title)
+		}
 	}
 	c.Data["Title"] = title
 	c.Data["Keyword"] = keyword
@@ -109,6 +118,26 @@ func Notifications(c *context.Context) {
 	c.HTML(200, tplNotification)
 }
 
+// NotificationOpen is a route for opening the thread of a notification, which is marked as read
+// before redirecting to its subject
+func NotificationOpen(c *context.Context) {
+	notification, err := models.OpenNotification(c.User, c.ParamsInt64(":id"))
+	if err != nil {
+		if models.IsErrNotificationNotExist(err) || models.IsErrNotificationForbidden(err) {
+			c.NotFound("OpenNotification", err)
+		} else {
+			c.ServerError("OpenNotification", err)
+		}
+		return
+	}
+
+	url := notification.HTMLURL()
+	if len(url) == 0 {
+		url = fmt.Sprintf("%s/notifications", setting.AppSubURL)
+	}
+	c.Redirect(url)
+}
+
 // NotificationStatusPost is a route for changing the status of a notification
 func NotificationStatusPost(c *context.Context) {
 	var (
@@ -129,8 +158,18 @@ func NotificationStatusPost(c *context.Context) {
 		return
 	}
 
-	if err := models.SetNotificationStatus(notificationID, c.User, status); err != nil {
-		c.ServerError("SetNotificationStatus", err)
+	var err error
+	if status == models.NotificationStatusPinned {
+		err = models.PinNotification(notificationID, c.User, c.Req.PostFormValue("pin_note"))
+	} else {
+		err = models.SetNotificationStatus(notificationID, c.User, status)
+	}
+	if err != nil {
+		if models.IsErrNotificationNotExist(err) || models.IsErrNotificationForbidden(err) {
+			c.NotFound("SetNotificationStatus", err)
+		} else {
+			c.ServerError("SetNotificationStatus", err)
+		}
 		return
 	}
 
@@ -140,9 +179,9 @@ func NotificationStatusPost(c *context.Context) {
 
 // NotificationPurgePost is a route for 'purging' the list of notifications - marking all unread as read
 func NotificationPurgePost(c *context.Context) {
-	err := models.UpdateNotificationStatuses(c.User, models.NotificationStatusUnread, models.NotificationStatusRead)
+	_, err := models.MarkAllReadKeepPinned(c.User)
 	if err != nil {
-		c.ServerError("ErrUpdateNotificationStatuses", err)
+		c.ServerError("MarkAllReadKeepPinned", err)
 		return
 	}
 
@@ -6,6 +6,7 @@ package comments
 
 import (
 	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/log"
 	"code.gitea.io/gitea/modules/notification"
 )
 
@@ -23,6 +24,11 @@ func CreateIssueComment(doer *models.User, repo *models.Repository, issue *model
 		return nil, err
 	}
 
+	// the commenter is obviously caught up with the issue
+	if err = models.MarkIssueNotificationReadForUser(doer.ID, issue.ID); err != nil {
+		log.Error("MarkIssueNotificationReadForUser [%d, %d]: %v", doer.ID, issue.ID, err)
+	}
+
 	notification.NotifyCreateIssueComment(doer, repo, issue, comment)
 
 	return comment, nil
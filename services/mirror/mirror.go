@@ -164,6 +164,48 @@ func parseRemoteUpdateOutput(output string) []*mirrorSyncResult {
 	return results
 }
 
+// notifyMirrorFailure notifies the administrators of the mirror repository
+// that a sync has failed.
+func notifyMirrorFailure(repo *models.Repository, reason string) {
+	if err := repo.GetOwner(); err != nil {
+		log.Error("GetOwner: %v", err)
+		return
+	}
+
+	var adminIDs []int64
+	if repo.Owner.IsOrganization() {
+		team, err := repo.Owner.GetOwnerTeam()
+		if err != nil {
+			log.Error("GetOwnerTeam: %v", err)
+			return
+		}
+		if err = team.GetMembers(); err != nil {
+			log.Error("GetMembers: %v", err)
+			return
+		}
+		for _, member := range team.Members {
+			adminIDs = append(adminIDs, member.ID)
+		}
+	} else {
+		adminIDs = append(adminIDs, repo.OwnerID)
+	}
+
+	collaborators, err := repo.GetCollaborators()
+	if err != nil {
+		log.Error("GetCollaborators: %v", err)
+		return
+	}
+	for _, collaborator := range collaborators {
+		if collaborator.Collaboration.Mode >= models.AccessModeAdmin {
+			adminIDs = append(adminIDs, collaborator.ID)
+		}
+	}
+
+	if err = models.CreateMirrorFailureNotification(repo.ID, adminIDs, reason); err != nil {
+		log.Error("CreateMirrorFailureNotification: %v", err)
+	}
+}
+
 // runSync returns true if sync finished without error.
 func runSync(m *models.Mirror) ([]*mirrorSyncResult, bool) {
 	repoPath := m.Repo.RepoPath()
@@ -202,6 +244,7 @@ func runSync(m *models.Mirror) ([]*mirrorSyncResult, bool) {
 		if err = models.CreateRepositoryNotice(desc); err != nil {
 			log.Error("CreateRepositoryNotice: %v", err)
 		}
+		notifyMirrorFailure(m.Repo, stderrMessage)
 		return nil, false
 	}
 	output := stderrBuilder.String()
@@ -249,6 +292,7 @@ func runSync(m *models.Mirror) ([]*mirrorSyncResult, bool) {
 			if err = models.CreateRepositoryNotice(desc); err != nil {
 				log.Error("CreateRepositoryNotice: %v", err)
 			}
+			notifyMirrorFailure(m.Repo, stderrMessage)
 			return nil, false
 		}
 	}